@@ -0,0 +1,2 @@
+/* the adapter specific settings of the registry, e.g. the timeouts, encoded as a JSON object */
+ALTER TABLE registry ADD COLUMN IF NOT EXISTS settings text;
@@ -103,7 +103,17 @@ func (t *transfer) Transfer(src *model.Resource, dst *model.Resource, opts *tran
 	}
 
 	// copy the repository from source registry to the destination
-	return t.copy(t.convert(src), t.convert(dst), dst.Override, opts)
+	err := t.copy(t.convert(src), t.convert(dst), dst.Override, opts)
+	t.logPushStats()
+	return err
+}
+
+// logPushStats logs the statistics of the content pushed to the destination registry by the job
+// if the adapter counts them
+func (t *transfer) logPushStats() {
+	if reporter, ok := t.dst.(adapter.PushStatsReporter); ok {
+		t.logger.Infof("push statistics of the destination registry: %s", reporter.PushStatsSummary())
+	}
 }
 
 func (t *transfer) convert(resource *model.Resource) *repository {
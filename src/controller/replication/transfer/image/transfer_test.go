@@ -194,3 +194,25 @@ func TestDelete(t *testing.T) {
 	err := tr.delete(repo)
 	require.Nil(t, err)
 }
+
+type fakeStatsRegistry struct {
+	fakeRegistry
+}
+
+func (f *fakeStatsRegistry) PushStatsSummary() string {
+	return "1 blobs pushed"
+}
+
+func TestLogPushStats(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tr := &transfer{
+		logger: log.New(buf, log.NewTextFormatter(), log.InfoLevel),
+		dst:    &fakeRegistry{},
+	}
+	tr.logPushStats()
+	assert.Empty(t, buf.String())
+
+	tr.dst = &fakeStatsRegistry{}
+	tr.logPushStats()
+	assert.Contains(t, buf.String(), "push statistics of the destination registry: 1 blobs pushed")
+}
@@ -69,6 +69,13 @@ type ArtifactRegistry interface {
 	ListTags(repository string) (tags []string, err error)
 }
 
+// PushStatsReporter is implemented by the destination adapters counting the content pushed by each
+// replication job, the transfer logs the summary once the job ends
+type PushStatsReporter interface {
+	// PushStatsSummary summarizes the content pushed and skipped by the job
+	PushStatsSummary() string
+}
+
 // RegisterFactory registers one adapter factory to the registry
 func RegisterFactory(t string, factory Factory) error {
 	if len(t) == 0 {
@@ -0,0 +1,86 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// waitNamespaceReady waits for the namespace creation accepted asynchronously with 202 to complete, so
+// the pushes don't race ahead of it. The operation is polled via the "Location" header of the response
+// if it's set, otherwise the namespace is polled until it exists. ErrOperationTimeout is returned if the
+// operation doesn't complete in time, see WithAsyncPoll
+func (a *adapter) waitNamespaceReady(namespace, location string) error {
+	deadline := time.Now().Add(a.opts.asyncPollTimeout)
+	for {
+		time.Sleep(a.opts.asyncPollInterval)
+		done, err := a.pollNamespaceCreation(namespace, location)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: namespace %s isn't ready after %v", ErrOperationTimeout, namespace, a.opts.asyncPollTimeout)
+		}
+	}
+}
+
+// pollNamespaceCreation reports whether the asynchronous creation of the namespace completes, the operation
+// is polled bounded by the push timeout as the creation is, while the namespace is got bounded by the get
+// timeout, see WithOperationTimeouts
+func (a *adapter) pollNamespaceCreation(namespace, location string) (bool, error) {
+	if len(location) == 0 {
+		ns, err := a.GetNamespace(namespace)
+		if errors.Is(err, ErrNamespaceNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return ns.Name == namespace, nil
+	}
+
+	base, err := url.Parse(a.registry.URL)
+	if err != nil {
+		return false, err
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return false, fmt.Errorf("invalid location %s of the operation: %w", location, err)
+	}
+	r, err := http.NewRequest(http.MethodGet, base.ResolveReference(ref).String(), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := a.doWithTimeout(r, a.opts.pushTimeout)
+	if err != nil {
+		return false, classifyTransportError(err)
+	}
+	defer resp.Body.Close()
+	code := resp.StatusCode
+	if code == http.StatusAccepted {
+		return false, nil
+	}
+	if code >= 300 || code < 200 {
+		return false, classifyStatusError(a.newError(resp))
+	}
+	return true, nil
+}
@@ -0,0 +1,102 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestAdapter_CreateNamespaceAcceptedPollsNamespace(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Post("/dockyard/v2/namespaces").
+		Reply(202)
+	mockSequence("GET", "/dockyard/v2/namespaces/async_ns",
+		mockResponse{status: 404, body: `{"error_msg":"namespace not found"}`},
+		mockResponse{status: 200, body: map[string]string{"name": "async_ns"}},
+	)
+
+	a := getMockAdapter(t, WithAsyncPoll(time.Millisecond, time.Second))
+	assert.NoError(t, a.CreateNamespace("async_ns", NamespaceAuthPrivate))
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_CreateNamespaceAcceptedPollsLocation(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Post("/dockyard/v2/namespaces").
+		Reply(202).
+		SetHeader("Location", "/dockyard/v2/operations/42")
+	mockSequence("GET", "/dockyard/v2/operations/42",
+		mockResponse{status: 202},
+		mockResponse{status: 200, body: "{}"},
+	)
+
+	a := getMockAdapter(t, WithAsyncPoll(time.Millisecond, time.Second))
+	assert.NoError(t, a.CreateNamespace("async_ns", NamespaceAuthPrivate))
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_CreateNamespaceAcceptedFailed(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Post("/dockyard/v2/namespaces").
+		Reply(202).
+		SetHeader("Location", "/dockyard/v2/operations/42")
+	mockRequest().Get("/dockyard/v2/operations/42").
+		Reply(400).BodyString(`{"error_msg":"invalid namespace"}`)
+
+	a := getMockAdapter(t, WithAsyncPoll(time.Millisecond, time.Second))
+	err := a.CreateNamespace("async_ns", NamespaceAuthPrivate)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrOperationTimeout))
+}
+
+func TestAdapter_CreateNamespaceAcceptedTimeout(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Post("/dockyard/v2/namespaces").
+		Reply(202).
+		SetHeader("Location", "/dockyard/v2/operations/42")
+	mockRequest().Get("/dockyard/v2/operations/42").
+		Persist().
+		Reply(202)
+
+	a := getMockAdapter(t, WithAsyncPoll(time.Millisecond, 20*time.Millisecond))
+	err := a.CreateNamespace("async_ns", NamespaceAuthPrivate)
+	assert.True(t, errors.Is(err, ErrOperationTimeout))
+}
+
+func TestWithAsyncPoll(t *testing.T) {
+	o := newOptions(WithAsyncPoll(0, -time.Second))
+	assert.Equal(t, defaultAsyncPollInterval, o.asyncPollInterval)
+	assert.Equal(t, defaultAsyncPollTimeout, o.asyncPollTimeout)
+
+	o = newOptions(WithSettings(map[string]string{
+		SettingAsyncPollIntervalMS:     "250",
+		SettingAsyncPollTimeoutSeconds: "10",
+	}))
+	assert.Equal(t, 250*time.Millisecond, o.asyncPollInterval)
+	assert.Equal(t, 10*time.Second, o.asyncPollTimeout)
+}
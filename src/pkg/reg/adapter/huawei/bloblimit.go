@@ -0,0 +1,66 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import "sync"
+
+// blobUploadLimiter bounds the concurrent blob uploads per repository, so pushing an image of many layers
+// doesn't flood SWR, see WithMaxBlobUploads. A nil limiter doesn't bound anything
+type blobUploadLimiter struct {
+	mu    sync.Mutex
+	limit int
+	slots map[string]*blobUploadSlots
+}
+
+// blobUploadSlots are the upload slots of a repository, dropped once no upload holds or waits for them
+type blobUploadSlots struct {
+	sem   chan struct{}
+	users int
+}
+
+// newBlobUploadLimiter returns the limiter allowing limit uploads per repository, nil if limit isn't positive
+func newBlobUploadLimiter(limit int) *blobUploadLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &blobUploadLimiter{limit: limit, slots: map[string]*blobUploadSlots{}}
+}
+
+// acquire blocks until an upload to the repository is allowed, the returned function must be called
+// once the upload is done
+func (l *blobUploadLimiter) acquire(repository string) func() {
+	if l == nil {
+		return func() {}
+	}
+	l.mu.Lock()
+	slots, ok := l.slots[repository]
+	if !ok {
+		slots = &blobUploadSlots{sem: make(chan struct{}, l.limit)}
+		l.slots[repository] = slots
+	}
+	slots.users++
+	l.mu.Unlock()
+
+	slots.sem <- struct{}{}
+	return func() {
+		<-slots.sem
+		l.mu.Lock()
+		slots.users--
+		if slots.users == 0 {
+			delete(l.slots, repository)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/goharbor/harbor/src/testing/pkg/registry"
+)
+
+// concurrentUploadClient records the max concurrent uploads per repository and in total
+type concurrentUploadClient struct {
+	*registry.Client
+	mu       sync.Mutex
+	inflight map[string]int
+	peak     map[string]int
+	total    int
+	peakAll  int
+}
+
+func (c *concurrentUploadClient) PushBlob(repository, _ string, _ int64, _ io.Reader) error {
+	c.mu.Lock()
+	c.inflight[repository]++
+	c.total++
+	c.peak[repository] = max(c.peak[repository], c.inflight[repository])
+	c.peakAll = max(c.peakAll, c.total)
+	c.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	c.mu.Lock()
+	c.inflight[repository]--
+	c.total--
+	c.mu.Unlock()
+	return nil
+}
+
+func pushBlobsConcurrently(t *testing.T, opts ...Option) *concurrentUploadClient {
+	client := &concurrentUploadClient{inflight: map[string]int{}, peak: map[string]int{}}
+	a := getMockAdapter(t, opts...)
+	a.Adapter.Client = client
+	var wg sync.WaitGroup
+	for _, repository := range []string{"ns/app", "ns/other"} {
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			go func(repository string) {
+				defer wg.Done()
+				assert.NoError(t, a.PushBlob(repository, "sha256:layer", 5, strings.NewReader("layer")))
+			}(repository)
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, int64(12), a.PushStats().BlobsPushed)
+	assert.Empty(t, a.blobUploads.slots)
+	return client
+}
+
+func TestAdapter_MaxBlobUploads(t *testing.T) {
+	// the repositories don't share the slots
+	client := pushBlobsConcurrently(t, WithMaxBlobUploads(2))
+	assert.Equal(t, map[string]int{"ns/app": 2, "ns/other": 2}, client.peak)
+	assert.Equal(t, 4, client.peakAll)
+
+	// the adaptive concurrency bounds the uploads across the repositories
+	client = pushBlobsConcurrently(t, WithSettings(map[string]string{SettingMaxBlobUploads: "3"}), WithAdaptiveConcurrency(1, 1))
+	assert.Equal(t, 1, client.peakAll)
+
+	client = pushBlobsConcurrently(t)
+	assert.Equal(t, map[string]int{"ns/app": defaultMaxBlobUploads, "ns/other": defaultMaxBlobUploads}, client.peak)
+
+	assert.Nil(t, newBlobUploadLimiter(0))
+	release := (*blobUploadLimiter)(nil).acquire("ns/app")
+	release()
+}
@@ -0,0 +1,177 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/goharbor/harbor/src/lib/log"
+)
+
+// the states of the circuit breaker
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker stops sending the requests to SWR once it fails consecutively, so the replications
+// fail fast rather than each waiting for the timeouts during an outage. It opens after the threshold
+// of the consecutive failures, short-circuits the requests for the cooldown, and then half-opens to
+// let one request probe the recovery, which closes it on success or opens it again on failure
+type circuitBreaker struct {
+	sync.Mutex
+	name      string
+	threshold int
+	cooldown  time.Duration
+	state     int
+	failures  int
+	openedAt  time.Time
+}
+
+// sharedBreaker is the circuit breaker shared by the adapters along with the number of its holders
+type sharedBreaker struct {
+	breaker *circuitBreaker
+	holders int
+}
+
+// breakers are shared by the adapters of the same registry, as an adapter is created per replication
+var (
+	breakersLock sync.Mutex
+	breakers     = map[string]*sharedBreaker{}
+)
+
+// breakerKey identifies the circuit breaker of the registry with the settings
+func breakerKey(registryURL string, threshold int, cooldown time.Duration) string {
+	return fmt.Sprintf("%s|%d|%s", registryURL, threshold, cooldown)
+}
+
+// breakerFor returns the circuit breaker shared by the adapters of the registry with the same settings,
+// the caller holds it until releaseBreaker is called
+func breakerFor(registryURL string, threshold int, cooldown time.Duration) *circuitBreaker {
+	key := breakerKey(registryURL, threshold, cooldown)
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+	shared, ok := breakers[key]
+	if !ok {
+		shared = &sharedBreaker{breaker: &circuitBreaker{name: registryURL, threshold: threshold, cooldown: cooldown}}
+		breakers[key] = shared
+	}
+	shared.holders++
+	return shared.breaker
+}
+
+// releaseBreaker releases the circuit breaker once the adapter holding it is closed. The breaker is
+// dropped with its last holder, so the breakers of the deleted registries don't pile up while the
+// failures tracked are kept for the other adapters of the registry
+func releaseBreaker(key string) {
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+	shared, ok := breakers[key]
+	if !ok {
+		return
+	}
+	shared.holders--
+	if shared.holders <= 0 {
+		delete(breakers, key)
+	}
+}
+
+// allow reports whether a request can be sent, ErrCircuitOpen is returned if it's short-circuited
+func (b *circuitBreaker) allow() error {
+	b.Lock()
+	defer b.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if remaining := b.cooldown - time.Since(b.openedAt); remaining > 0 {
+			return fmt.Errorf("%w: %s failed %d times in a row, retry in %v", ErrCircuitOpen, b.name, b.failures, remaining.Round(time.Second))
+		}
+		// the request is the probe
+		b.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		return fmt.Errorf("%w: probing the recovery of %s", ErrCircuitOpen, b.name)
+	default:
+		return nil
+	}
+}
+
+// record records the result of the request allowed
+func (b *circuitBreaker) record(failed bool) {
+	b.Lock()
+	defer b.Unlock()
+	if !failed {
+		if b.state != circuitClosed {
+			log.Infof("the circuit breaker of Huawei SWR %s is closed", b.name)
+		}
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		if b.state != circuitOpen {
+			log.Warningf("the circuit breaker of Huawei SWR %s is open for %v after %d consecutive failures", b.name, b.cooldown, b.failures)
+		}
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// abort gives up the request allowed without the result, e.g. it's canceled by the caller, so the
+// probe of the half-open circuit is left to the next request
+func (b *circuitBreaker) abort() {
+	b.Lock()
+	defer b.Unlock()
+	if b.state == circuitHalfOpen {
+		b.state = circuitOpen
+	}
+}
+
+// breakerTransport applies the circuit breaker to the requests, the transport errors and the
+// server errors count as the failures, while the other responses mean SWR is up
+type breakerTransport struct {
+	next    http.RoundTripper
+	breaker *circuitBreaker
+}
+
+// RoundTrip sends the request unless the circuit is open
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.allow(); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil && errors.Is(err, context.Canceled) {
+		t.breaker.abort()
+		return resp, err
+	}
+	t.breaker.record(err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	return resp, err
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport
+func (t *breakerTransport) CloseIdleConnections() {
+	if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := &circuitBreaker{name: "swr", threshold: 3, cooldown: 20 * time.Millisecond}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.allow())
+		b.record(true)
+	}
+	// the success resets the consecutive failures
+	require.NoError(t, b.allow())
+	b.record(false)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.allow())
+		b.record(true)
+	}
+	assert.True(t, errors.Is(b.allow(), ErrCircuitOpen))
+
+	// only one request probes after the cooldown, the failed probe opens it again
+	time.Sleep(25 * time.Millisecond)
+	require.NoError(t, b.allow())
+	assert.True(t, errors.Is(b.allow(), ErrCircuitOpen))
+	b.record(true)
+	assert.True(t, errors.Is(b.allow(), ErrCircuitOpen))
+
+	// the aborted probe is left to the next request
+	time.Sleep(25 * time.Millisecond)
+	require.NoError(t, b.allow())
+	b.abort()
+	require.NoError(t, b.allow())
+	b.record(false)
+	assert.NoError(t, b.allow())
+}
+
+func TestAdapter_CircuitBreaker(t *testing.T) {
+	var requests, failing atomic.Int64
+	failing.Store(1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		if failing.Load() == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"namespaces":[]}`))
+	}))
+	defer server.Close()
+
+	newBreakerAdapter := func() *adapter {
+		adp, err := newAdapter(&model.Registry{
+			URL:        server.URL,
+			Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+		}, WithCircuitBreaker(2, 50*time.Millisecond))
+		require.NoError(t, err)
+		return adp.(*adapter)
+	}
+	a := newBreakerAdapter()
+	for i := 0; i < 2; i++ {
+		assert.False(t, errors.Is(a.PingRegistry(), ErrCircuitOpen))
+	}
+	// the other adapters of the registry share the open circuit
+	err := newBreakerAdapter().PingRegistry()
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.True(t, errors.Is(err, ErrUnreachable))
+	assert.False(t, isTransient(err))
+	assert.Equal(t, int64(2), requests.Load())
+
+	// the probe after the cooldown closes it once SWR recovers
+	failing.Store(0)
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, a.PingRegistry())
+	assert.NoError(t, a.PingRegistry())
+	assert.Equal(t, int64(4), requests.Load())
+}
+
+func TestAdapter_CircuitBreakerNativeClient(t *testing.T) {
+	var requests atomic.Int64
+	m := newMockRegistry(t, func(s *httptest.Server) {
+		s.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+	})
+	a := m.adapter(t, WithCircuitBreaker(2, time.Minute))
+	defer a.Close()
+
+	dgt := "sha256:" + strings.Repeat("b", 64)
+	assert.False(t, errors.Is(a.PushBlob("ns/app", dgt, 4, strings.NewReader("blob")), ErrCircuitOpen))
+	// the failures of the blob push open the circuit for the manifests too
+	_, err := a.PushManifest("ns/app", "v1", "application/vnd.oci.image.manifest.v1+json", []byte(`{}`))
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.True(t, errors.Is(a.PushBlob("ns/app", dgt, 4, strings.NewReader("blob")), ErrCircuitOpen))
+	assert.Equal(t, int64(2), requests.Load())
+}
+
+func TestReleaseBreaker(t *testing.T) {
+	url := "https://swr.release.myhuaweicloud.com"
+	newBreakerAdapter := func() *adapter {
+		adp, err := newAdapter(&model.Registry{
+			URL:        url,
+			Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+		}, WithCircuitBreaker(2, time.Minute))
+		require.NoError(t, err)
+		return adp.(*adapter)
+	}
+	key := breakerKey(url, 2, time.Minute)
+	holders := func() int {
+		breakersLock.Lock()
+		defer breakersLock.Unlock()
+		if shared, ok := breakers[key]; ok {
+			return shared.holders
+		}
+		return 0
+	}
+
+	// the breaker is kept for the other adapters holding it, closing again doesn't release it twice
+	a1, a2 := newBreakerAdapter(), newBreakerAdapter()
+	assert.Equal(t, 2, holders())
+	require.NoError(t, a1.Close())
+	require.NoError(t, a1.Close())
+	assert.Equal(t, 1, holders())
+	// the new adapter shares the breaker of the live one
+	a3 := newBreakerAdapter()
+	assert.Equal(t, 2, holders())
+
+	require.NoError(t, a2.Close())
+	require.NoError(t, a3.Close())
+	breakersLock.Lock()
+	assert.NotContains(t, breakers, key)
+	breakersLock.Unlock()
+}
+
+func TestWithCircuitBreaker(t *testing.T) {
+	o := newOptions()
+	assert.Equal(t, 0, o.breakerThreshold)
+
+	o = newOptions(WithSettings(map[string]string{
+		SettingCircuitBreakerThreshold:       "5",
+		SettingCircuitBreakerCooldownSeconds: "10",
+	}))
+	assert.Equal(t, 5, o.breakerThreshold)
+	assert.Equal(t, 10*time.Second, o.breakerCooldown)
+
+	o = newOptions(WithCircuitBreaker(3, 0))
+	assert.Equal(t, defaultBreakerCooldown, o.breakerCooldown)
+}
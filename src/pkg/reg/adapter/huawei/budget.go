@@ -0,0 +1,41 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"sync/atomic"
+)
+
+// retryBudget bounds the retries of all the requests in a replication job on top of the attempts
+// of each request, so a systemic failure of SWR fails the job fast rather than retrying every
+// request in turn. A non-positive limit means no budget. The budget is created per job rather than
+// held by the adapter, as the adapters are cached and shared by the concurrent jobs
+type retryBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// newRetryBudget returns the budget of a job allowing the retries set by WithRetryBudget
+func newRetryBudget(limit int) *retryBudget {
+	return &retryBudget{limit: int64(limit)}
+}
+
+// take consumes one retry from the budget, false is returned if the budget is exhausted
+func (b *retryBudget) take() bool {
+	if b.limit <= 0 {
+		return true
+	}
+	return b.used.Add(1) <= b.limit
+}
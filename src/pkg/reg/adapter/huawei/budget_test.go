@@ -0,0 +1,105 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	gock "gopkg.in/h2non/gock.v1"
+
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+func TestRetryBudget(t *testing.T) {
+	b := newRetryBudget(2)
+	assert.True(t, b.take())
+	assert.True(t, b.take())
+	assert.False(t, b.take())
+
+	unlimited := newRetryBudget(0)
+	for i := 0; i < 100; i++ {
+		assert.True(t, unlimited.take())
+	}
+}
+
+func TestAdapter_PrepareForPushRetryBudget(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// the third failure exhausts the budget before the attempts of the namespace are used up
+	mockRequest().Post("/dockyard/v2/namespaces").
+		Times(3).
+		Reply(500)
+
+	a := getMockAdapter(t,
+		WithNamespaceCreateRetry(5, time.Millisecond),
+		WithAlwaysCreateNamespaces(true),
+		WithRetryBudget(2))
+	resources := []*model.Resource{
+		{Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: "ns1/app"}}},
+		{Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: "ns2/app"}}},
+	}
+	err := a.PrepareForPush(resources)
+	assert.True(t, errors.Is(err, ErrRetryBudgetExhausted))
+	assert.True(t, errors.Is(err, ErrServer))
+	assert.False(t, isTransient(err))
+	assert.True(t, gock.IsDone())
+
+	// the next job starts with the full budget
+	mockRequest().Post("/dockyard/v2/namespaces").
+		Reply(500)
+	mockRequest().Post("/dockyard/v2/namespaces").
+		Times(2).
+		Reply(201)
+	assert.NoError(t, a.PrepareForPush(resources))
+	assert.True(t, gock.IsDone())
+
+	assert.Equal(t, 7, newOptions(WithSettings(map[string]string{SettingRetryBudget: "7"})).retryBudget)
+}
+
+func TestAdapter_PrepareForPushRetryBudgetPerJob(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// each job uses up its own budget, 3 attempts with 2 retries, rather than sharing one
+	mockRequest().Post("/dockyard/v2/namespaces").
+		Times(6).
+		Reply(500)
+
+	a := getMockAdapter(t,
+		WithNamespaceCreateRetry(5, time.Millisecond),
+		WithAlwaysCreateNamespaces(true),
+		WithRetryBudget(2))
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, name := range []string{"ns1/app", "ns2/app"} {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			errs[i] = a.PrepareForPush([]*model.Resource{
+				{Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: name}}},
+			})
+		}(i, name)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assert.True(t, errors.Is(err, ErrRetryBudgetExhausted))
+	}
+	assert.True(t, gock.IsDone())
+}
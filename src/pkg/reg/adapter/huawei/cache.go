@@ -0,0 +1,200 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/goharbor/harbor/src/lib/log"
+	adp "github.com/goharbor/harbor/src/pkg/reg/adapter"
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+// tokenExpiryMargin makes the cached token be refreshed a bit before it expires
+// to avoid it expiring in the middle of the request
+const tokenExpiryMargin = 30 * time.Second
+
+type cachedToken struct {
+	token     jwtToken
+	expiresAt time.Time
+}
+
+// tokenCache caches the JWT tokens per repository until they are about to expire
+type tokenCache struct {
+	sync.Mutex
+	tokens map[string]*cachedToken
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{
+		tokens: map[string]*cachedToken{},
+	}
+}
+
+func (c *tokenCache) get(repository string) (jwtToken, bool) {
+	c.Lock()
+	defer c.Unlock()
+	cached, ok := c.tokens[repository]
+	if !ok {
+		return jwtToken{}, false
+	}
+	if time.Now().After(cached.expiresAt.Add(-tokenExpiryMargin)) {
+		delete(c.tokens, repository)
+		return jwtToken{}, false
+	}
+	return cached.token, true
+}
+
+// set caches the token, the token without the expiration isn't cached
+func (c *tokenCache) set(repository string, token jwtToken) {
+	if token.ExpiresIn <= 0 {
+		return
+	}
+	issuedAt := token.IssuedAt
+	if issuedAt.IsZero() {
+		issuedAt = time.Now()
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.tokens[repository] = &cachedToken{
+		token:     token,
+		expiresAt: issuedAt.Add(time.Duration(token.ExpiresIn) * time.Second),
+	}
+}
+
+func (c *tokenCache) clear() {
+	c.Lock()
+	defer c.Unlock()
+	c.tokens = map[string]*cachedToken{}
+}
+
+// adapterIdleTTL is how long the cached adapter is kept without being used, so the adapters of the
+// registries deleted or not replicated anymore are closed rather than kept for good
+const adapterIdleTTL = time.Hour
+
+type cachedAdapter struct {
+	fingerprint string
+	adapter     adp.Adapter
+	lastUsed    time.Time
+}
+
+// adapterCache keeps the adapters per registry ID, so the per event operations reuse
+// the tokens and the connections rather than authenticating every time
+type adapterCache struct {
+	sync.Mutex
+	adapters map[int64]*cachedAdapter
+}
+
+// get returns the cached adapter of the registry, or creates one by the create function if
+// the cached one doesn't exist or is created with the different endpoint, credential or settings.
+// The adapters unused for adapterIdleTTL are evicted and closed meanwhile
+func (c *adapterCache) get(registry *model.Registry, create func() (adp.Adapter, error)) (adp.Adapter, error) {
+	fp := fingerprint(registry)
+	now := time.Now()
+	c.Lock()
+	defer c.Unlock()
+	c.evictIdle(now)
+	if cached, ok := c.adapters[registry.ID]; ok && cached.fingerprint == fp {
+		cached.lastUsed = now
+		return cached.adapter, nil
+	}
+	a, err := create()
+	if err != nil {
+		return nil, err
+	}
+	// the registry is reconfigured, release the connections of the stale adapter
+	if cached, ok := c.adapters[registry.ID]; ok {
+		closeAdapter(cached.adapter)
+	}
+	if c.adapters == nil {
+		c.adapters = map[int64]*cachedAdapter{}
+	}
+	c.adapters[registry.ID] = &cachedAdapter{
+		fingerprint: fp,
+		adapter:     a,
+		lastUsed:    now,
+	}
+	return a, nil
+}
+
+// evictIdle closes and drops the adapters unused for adapterIdleTTL, the jobs still holding them can
+// keep using them as closing only releases the connections and the tokens
+func (c *adapterCache) evictIdle(now time.Time) {
+	for id, cached := range c.adapters {
+		if now.Sub(cached.lastUsed) < adapterIdleTTL {
+			continue
+		}
+		log.Debugf("the adapter of the registry %d is unused for %v, closing it", id, now.Sub(cached.lastUsed).Round(time.Second))
+		closeAdapter(cached.adapter)
+		delete(c.adapters, id)
+	}
+}
+
+// closeAdapter releases the connections of the adapter, both the single and the multiple
+// region adapters support it
+func closeAdapter(a adp.Adapter) {
+	if closer, ok := a.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
+
+// fingerprint digests the settings of the registry that the adapter depends on
+func fingerprint(registry *model.Registry) string {
+	data := fmt.Sprintf("%s|%t", registry.URL, registry.Insecure)
+	if registry.Credential != nil {
+		data += fmt.Sprintf("|%s|%s|%s", registry.Credential.Type,
+			registry.Credential.AccessKey, registry.Credential.AccessSecret)
+	}
+	keys := make([]string, 0, len(registry.Settings))
+	for k := range registry.Settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		data += fmt.Sprintf("|%s=%s", k, registry.Settings[k])
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+}
+
+// healthCache keeps the last result of the health check until it expires
+type healthCache struct {
+	sync.Mutex
+	status    string
+	err       error
+	expiresAt time.Time
+}
+
+// get returns the cached status and error, ok is false if nothing is cached or it expires
+func (c *healthCache) get() (status string, ok bool, err error) {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.status) == 0 || !time.Now().Before(c.expiresAt) {
+		return "", false, nil
+	}
+	return c.status, true, c.err
+}
+
+func (c *healthCache) set(status string, err error, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.status = status
+	c.err = err
+	c.expiresAt = time.Now().Add(ttl)
+}
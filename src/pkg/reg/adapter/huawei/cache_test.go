@@ -0,0 +1,212 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gock "gopkg.in/h2non/gock.v1"
+
+	adp "github.com/goharbor/harbor/src/pkg/reg/adapter"
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+func TestTokenCache(t *testing.T) {
+	c := newTokenCache()
+
+	// tokens without expiration are not cached
+	c.set("ns/repo", jwtToken{Token: "no-expiration"})
+	_, ok := c.get("ns/repo")
+	assert.False(t, ok)
+
+	c.set("ns/repo", jwtToken{Token: "valid", ExpiresIn: 3600, IssuedAt: time.Now()})
+	token, ok := c.get("ns/repo")
+	assert.True(t, ok)
+	assert.Equal(t, "valid", token.Token)
+
+	// the token about to expire is refreshed
+	c.set("ns/repo", jwtToken{Token: "expiring", ExpiresIn: 10, IssuedAt: time.Now()})
+	_, ok = c.get("ns/repo")
+	assert.False(t, ok)
+
+	c.set("ns/repo", jwtToken{Token: "valid", ExpiresIn: 3600})
+	c.clear()
+	_, ok = c.get("ns/repo")
+	assert.False(t, ok)
+}
+
+func TestAdapter_TokenCached(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/swr/auth/v2/registry/auth").
+		MatchParam("scope", "repository:ns/repo:push,pull").
+		Reply(200).
+		JSON(jwtToken{Token: "token", ExpiresIn: 3600, IssuedAt: time.Now()})
+	for i := 0; i < 2; i++ {
+		mockRequest().Delete("/v2/ns/repo/manifests/latest").
+			MatchHeader("Authorization", "Bearer token").
+			Reply(200)
+	}
+
+	a := getHwMockAdapter(t, WithDeletionScope("ns/**"))
+	assert.NoError(t, a.DeleteManifest("ns/repo", "latest"))
+	assert.NoError(t, a.DeleteManifest("ns/repo", "latest"))
+	assert.True(t, gock.IsDone())
+}
+
+func TestFactory_Create(t *testing.T) {
+	f := &factory{}
+	newRegistry := func(id int64, secret string) *model.Registry {
+		return &model.Registry{
+			ID:         id,
+			Type:       model.RegistryTypeHuawei,
+			URL:        "https://swr.cn-north-1.myhuaweicloud.com",
+			Credential: &model.Credential{AccessKey: "ak", AccessSecret: secret},
+		}
+	}
+
+	a1, err := f.Create(newRegistry(1, "sk"))
+	require.NoError(t, err)
+	a2, err := f.Create(newRegistry(1, "sk"))
+	require.NoError(t, err)
+	// each caller gets its own view of the cached adapter
+	assert.NotSame(t, a1, a2)
+	assert.Same(t, a1.(*jobAdapter).adapter, a2.(*jobAdapter).adapter)
+
+	// the credential is changed
+	a3, err := f.Create(newRegistry(1, "rotated"))
+	require.NoError(t, err)
+	assert.NotSame(t, a1.(*jobAdapter).adapter, a3.(*jobAdapter).adapter)
+
+	a4, err := f.Create(newRegistry(2, "rotated"))
+	require.NoError(t, err)
+	assert.NotSame(t, a3.(*jobAdapter).adapter, a4.(*jobAdapter).adapter)
+
+	// the unsaved registries are never cached
+	a5, err := f.Create(newRegistry(0, "sk"))
+	require.NoError(t, err)
+	a6, err := f.Create(newRegistry(0, "sk"))
+	require.NoError(t, err)
+	assert.NotSame(t, a5.(*jobAdapter).adapter, a6.(*jobAdapter).adapter)
+}
+
+func TestFactory_CreateWithSettings(t *testing.T) {
+	f := &factory{}
+	registry := &model.Registry{
+		ID:         1,
+		Type:       model.RegistryTypeHuawei,
+		URL:        "https://swr.cn-north-1.myhuaweicloud.com",
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+		Settings:   map[string]string{SettingTimeoutSeconds: "10"},
+	}
+
+	created, err := f.Create(registry)
+	require.NoError(t, err)
+	a := created.(*jobAdapter).adapter
+	assert.Equal(t, 10*time.Second, a.client.GetClient().Timeout)
+	assert.Equal(t, 10*time.Second, a.oriClient.Timeout)
+
+	// the changed settings take effect rather than reusing the cached adapter
+	registry.Settings = map[string]string{SettingTimeoutSeconds: "20"}
+	created, err = f.Create(registry)
+	require.NoError(t, err)
+	assert.NotSame(t, a, created.(*jobAdapter).adapter)
+	assert.Equal(t, 20*time.Second, created.(*jobAdapter).oriClient.Timeout)
+
+	// the registry being pinged applies the settings as well
+	registry.ID = 0
+	created, err = f.Create(registry)
+	require.NoError(t, err)
+	assert.Equal(t, 20*time.Second, created.(*jobAdapter).oriClient.Timeout)
+}
+
+func TestFactory_CreateMultiRegion(t *testing.T) {
+	f := &factory{}
+	registry := &model.Registry{
+		ID:         1,
+		Type:       model.RegistryTypeHuawei,
+		URL:        "https://swr.cn-north-1.myhuaweicloud.com",
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+		Settings:   map[string]string{SettingRegions: "cn-north-1,cn-east-3"},
+	}
+
+	a1, err := f.Create(registry)
+	require.NoError(t, err)
+	assert.IsType(t, &multiRegionAdapter{}, a1)
+	a2, err := f.Create(registry)
+	require.NoError(t, err)
+	assert.Same(t, a1, a2)
+
+	// the reconfigured registry replaces the cached multiple region adapter
+	registry.Settings = nil
+	a3, err := f.Create(registry)
+	require.NoError(t, err)
+	assert.IsType(t, &jobAdapter{}, a3)
+}
+
+func TestAdapterCache_EvictIdle(t *testing.T) {
+	c := &adapterCache{}
+	create := func(r *model.Registry) func() (adp.Adapter, error) {
+		return func() (adp.Adapter, error) { return newAdapter(r) }
+	}
+	idle := &model.Registry{ID: 1, URL: "https://swr.cn-north-1.myhuaweicloud.com",
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"}}
+	active := &model.Registry{ID: 2, URL: "https://swr.cn-east-3.myhuaweicloud.com",
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"}}
+
+	a1, err := c.get(idle, create(idle))
+	require.NoError(t, err)
+	a1.(*adapter).tokens.set("ns/repo", jwtToken{Token: "token", ExpiresIn: 3600})
+	_, err = c.get(active, create(active))
+	require.NoError(t, err)
+
+	// the registry is deleted, so its adapter isn't used anymore
+	c.adapters[1].lastUsed = time.Now().Add(-adapterIdleTTL)
+	_, err = c.get(active, create(active))
+	require.NoError(t, err)
+	assert.NotContains(t, c.adapters, int64(1))
+	assert.Contains(t, c.adapters, int64(2))
+	_, ok := a1.(*adapter).tokens.get("ns/repo")
+	assert.False(t, ok)
+
+	// the registry used again gets a new adapter
+	a2, err := c.get(idle, create(idle))
+	require.NoError(t, err)
+	assert.NotSame(t, a1, a2)
+}
+
+func TestFingerprint(t *testing.T) {
+	registry := &model.Registry{URL: "https://swr.com"}
+	fp := fingerprint(registry)
+	assert.Equal(t, fp, fingerprint(&model.Registry{URL: "https://swr.com"}))
+
+	registry.Insecure = true
+	assert.NotEqual(t, fp, fingerprint(registry))
+
+	fp = fingerprint(registry)
+	registry.Settings = map[string]string{SettingTimeoutSeconds: "10", SettingMaxRetries: "3"}
+	assert.NotEqual(t, fp, fingerprint(registry))
+	assert.Equal(t, fingerprint(registry), fingerprint(&model.Registry{URL: "https://swr.com", Insecure: true,
+		Settings: map[string]string{SettingMaxRetries: "3", SettingTimeoutSeconds: "10"}}))
+
+	registry.Credential = &model.Credential{AccessKey: "ak", AccessSecret: "sk"}
+	assert.NotContains(t, fingerprint(registry), "sk")
+	assert.Len(t, fingerprint(registry), len(fmt.Sprintf("%x", [32]byte{})))
+}
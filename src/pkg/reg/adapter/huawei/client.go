@@ -0,0 +1,207 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/goharbor/harbor/src/lib/log"
+)
+
+// getJSON sends a GET request of the listings to the management API of Huawei SWR
+// bounded by the listing timeout and decodes the JSON response body into v, the
+// request is logged with the logger of the operation carried by the context, see
+// withOperation
+func (a *adapter) getJSON(ctx context.Context, urls string, v interface{}) error {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, urls, nil)
+	if err != nil {
+		return err
+	}
+
+	r.Header.Add("content-type", "application/json; charset=utf-8")
+
+	start := time.Now()
+	resp, err := a.doWithTimeout(r, a.opts.listTimeout)
+	logResponse(log.G(ctx), r, resp, err, start)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	code := resp.StatusCode
+	if code >= 300 || code < 200 {
+		e := a.newError(resp)
+		if isAPIMismatch(e) {
+			return a.checkAPIVersion(e)
+		}
+		return e
+	}
+	if err = a.decodeBody(resp, v); err != nil {
+		if isAPIMismatch(err) {
+			return a.checkAPIVersion(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// apiURL builds the URL of the management API from the path elements, see joinURL
+func (a *adapter) apiURL(elem ...string) string {
+	return joinURL(a.apiBaseURL, elem...)
+}
+
+// registryURL builds the URL of the registry and the auth APIs from the path elements, see joinURL
+func (a *adapter) registryURL(elem ...string) string {
+	return joinURL(a.registry.URL, elem...)
+}
+
+// joinURL joins the base URL, which may carry a path or a trailing slash, and the path elements.
+// The characters not allowed in the path, e.g. the spaces and "#", are percent-encoded while the
+// slashes and the escapes in the elements are kept, as the repository "ns/app" spans two segments
+// of the registry API. The names of the namespaces and the references must go through pathSegment
+func joinURL(base string, elem ...string) string {
+	u, err := url.JoinPath(base, elem...)
+	if err != nil {
+		// leave the invalid base URL to be reported when sending the request
+		return strings.TrimRight(base, "/") + "/" + strings.Join(elem, "/")
+	}
+	return u
+}
+
+// pathSegment percent-encodes the name as a single path segment for joinURL, so the slashes,
+// the percent signs and the dot segments in the name can't change the path of the request
+func pathSegment(name string) string {
+	switch name {
+	case ".":
+		return "%2E"
+	case "..":
+		return "%2E%2E"
+	}
+	return url.PathEscape(name)
+}
+
+// isEmptyBody reports whether the body is empty or only contains whitespaces
+func isEmptyBody(body []byte) bool {
+	return len(bytes.TrimSpace(body)) == 0
+}
+
+// enterpriseProjectHeader carries the enterprise project the requests belong to, see WithEnterpriseProjectID
+const enterpriseProjectHeader = "Enterprise-Project-Id"
+
+// reservedHeaders are set by the adapter itself, e.g. the authorization and the signature, so they can't
+// be overridden by the static headers, see WithHeaders
+var reservedHeaders = map[string]struct{}{
+	"Authorization":         {},
+	"Proxy-Authorization":   {},
+	"Host":                  {},
+	"Content-Type":          {},
+	"Content-Length":        {},
+	"Accept":                {},
+	"X-Sdk-Date":            {},
+	enterpriseProjectHeader: {},
+}
+
+// headerModifier sets the header of the requests
+type headerModifier struct {
+	key   string
+	value string
+}
+
+// Modify ...
+func (h *headerModifier) Modify(req *http.Request) error {
+	req.Header.Set(h.key, h.value)
+	return nil
+}
+
+// doRegistry sends the request to the registry API of Huawei SWR with the raw client, the
+// authorization is set by the callers while the other modifiers of the adapter are applied here
+func (a *adapter) doRegistry(req *http.Request) (*http.Response, error) {
+	for _, m := range a.registryModifiers {
+		if err := m.Modify(req); err != nil {
+			return nil, err
+		}
+	}
+	return a.oriClient.Do(req)
+}
+
+// bodyReader returns the reader of the response body, the gzip encoded body is decoded here in case
+// the transport doesn't do it transparently, e.g. the "Accept-Encoding" is set explicitly or the
+// gateway in front of SWR compresses the body unrequested. The reader stops after the max response
+// body size plus one byte, so the callers can tell whether the body exceeds the limit. A nil reader
+// is returned for the empty body declared as gzip encoded.
+func (a *adapter) bodyReader(resp *http.Response) (*io.LimitedReader, func(), error) {
+	var reader io.Reader = resp.Body
+	closer := func() {}
+	if !resp.Uncompressed && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err == io.EOF {
+			return nil, closer, nil
+		}
+		if err != nil {
+			return nil, closer, err
+		}
+		reader = gz
+		closer = func() { gz.Close() }
+	}
+	return &io.LimitedReader{R: reader, N: a.opts.maxResponseBodySize + 1}, closer, nil
+}
+
+// readBody reads the whole body of the response, see bodyReader for the decoding of the body.
+// ErrResponseTooLarge is returned along with the body read so far if the body exceeds the max
+// response body size
+func (a *adapter) readBody(resp *http.Response) ([]byte, error) {
+	reader, closer, err := a.bodyReader(resp)
+	defer closer()
+	if err != nil || reader == nil {
+		return nil, err
+	}
+	limit := a.opts.maxResponseBodySize
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return body[:limit], fmt.Errorf("%w: exceeds %d bytes", ErrResponseTooLarge, limit)
+	}
+	return body, nil
+}
+
+// decodeBody decodes the JSON body of the response into v as a stream rather than reading the
+// whole body first, which halves the memory used by the large listings. v is left untouched if
+// the body is empty, as SWR responds some successful requests with an empty body
+func (a *adapter) decodeBody(resp *http.Response, v interface{}) error {
+	reader, closer, err := a.bodyReader(resp)
+	defer closer()
+	if err != nil || reader == nil {
+		return err
+	}
+	err = json.NewDecoder(reader).Decode(v)
+	if reader.N <= 0 {
+		return fmt.Errorf("%w: exceeds %d bytes", ErrResponseTooLarge, a.opts.maxResponseBodySize)
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
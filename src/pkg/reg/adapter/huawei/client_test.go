@@ -0,0 +1,211 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gock "gopkg.in/h2non/gock.v1"
+
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+func gzipBody(t *testing.T, body string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(body))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestAdapter_ListNamespacesGzip(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Content-Encoding", "gzip").
+		Body(bytes.NewReader(gzipBody(t, `{"namespaces":[{"id":1,"name":"compressed"}]}`)))
+
+	a := getMockAdapter(t)
+	namespaces, err := a.ListNamespaces(&model.NamespaceQuery{})
+	require.NoError(t, err)
+	require.Len(t, namespaces, 1)
+	assert.Equal(t, "compressed", namespaces[0].Name)
+}
+
+func TestNewErrorGzip(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/failed").
+		Reply(500).
+		SetHeader("Content-Encoding", "gzip").
+		Body(bytes.NewReader(gzipBody(t, "internal error")))
+
+	a := getMockAdapter(t)
+	_, err := a.GetNamespace("failed")
+	assert.EqualError(t, err, "[500][internal error]")
+}
+
+func TestAdapter_MaxResponseBodySize(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	body := `{"namespaces":[{"id":1,"name":"huge"}]}`
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).BodyString(body)
+	mockRequest().Get("/dockyard/v2/namespaces/failed").
+		Reply(500).BodyString("internal error")
+
+	a := getMockAdapter(t, WithMaxResponseBodySize(int64(len(body)-1)))
+	_, err := a.ListNamespaces(&model.NamespaceQuery{})
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+
+	// the error body is cut rather than failing
+	a = getMockAdapter(t, WithMaxResponseBodySize(8))
+	_, err = a.GetNamespace("failed")
+	assert.EqualError(t, err, "[500][internal]")
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).BodyString(body)
+	a = getMockAdapter(t, WithMaxResponseBodySize(int64(len(body))))
+	namespaces, err := a.ListNamespaces(&model.NamespaceQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, namespaces, 1)
+}
+
+func TestGetJSONEmptyBody(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/empty").
+		Reply(200).BodyString("\t ")
+	mockRequest().Get("/dockyard/v2/gzip").
+		Reply(200).SetHeader("Content-Encoding", "gzip")
+
+	a := getMockAdapter(t)
+	v := hwNamespace{Name: "untouched"}
+	assert.NoError(t, a.getJSON(context.Background(), a.apiBaseURL+"/empty", &v))
+	assert.Equal(t, "untouched", v.Name)
+	assert.NoError(t, a.getJSON(context.Background(), a.apiBaseURL+"/gzip", &v))
+	assert.Equal(t, "untouched", v.Name)
+}
+
+func TestAdapter_DecodeBody(t *testing.T) {
+	newResponse := func(body string) *http.Response {
+		return &http.Response{Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}
+	}
+	a := getMockAdapter(t, WithMaxResponseBodySize(32))
+
+	var ns hwNamespace
+	assert.NoError(t, a.decodeBody(newResponse(`{"id":1,"name":"ns1"}`), &ns))
+	assert.Equal(t, "ns1", ns.Name)
+
+	// the empty body leaves the value untouched
+	assert.NoError(t, a.decodeBody(newResponse(""), &ns))
+	assert.Equal(t, "ns1", ns.Name)
+
+	err := a.decodeBody(newResponse(`{"id":1,"name":"`+strings.Repeat("x", 32)+`"}`), &ns)
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+}
+
+func TestJoinURL(t *testing.T) {
+	cases := []struct {
+		base     string
+		elem     []string
+		expected string
+	}{
+		{base: "https://swr.com", elem: []string{"v2", "ns/app", "manifests", "v1"}, expected: "https://swr.com/v2/ns/app/manifests/v1"},
+		{base: "https://swr.com/", elem: []string{"v2", "ns/app"}, expected: "https://swr.com/v2/ns/app"},
+		{base: "https://swr.com/gateway/", elem: []string{"namespaces"}, expected: "https://swr.com/gateway/namespaces"},
+		{base: "https://swr.com/dockyard/v2", elem: []string{"namespaces", "team #1"}, expected: "https://swr.com/dockyard/v2/namespaces/team%20%231"},
+		{base: "https://swr.com/dockyard/v2", elem: []string{"namespaces", "ns?x=1"}, expected: "https://swr.com/dockyard/v2/namespaces/ns%3Fx=1"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, joinURL(c.base, c.elem...))
+	}
+}
+
+func TestAdapter_GetNamespaceSpecialCharacters(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/team #1").
+		Reply(200).BodyString(`{"id":1,"name":"team #1"}`)
+
+	registry := &model.Registry{
+		Type:       model.RegistryTypeHuawei,
+		URL:        "https://swr.cn-north-1.myhuaweicloud.com/",
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+	}
+	adp, err := newAdapter(registry)
+	require.NoError(t, err)
+	a := adp.(*adapter)
+	gock.InterceptClient(a.client.GetClient())
+
+	ns, err := a.GetNamespace("team #1")
+	require.NoError(t, err)
+	assert.Equal(t, "team #1", ns.Name)
+	assert.True(t, gock.IsDone())
+}
+
+func TestPathSegment(t *testing.T) {
+	assert.Equal(t, "ns", pathSegment("ns"))
+	assert.Equal(t, "a%2Fb", pathSegment("a/b"))
+	assert.Equal(t, "a%2541", pathSegment("a%41"))
+	assert.Equal(t, "%2E%2E", pathSegment(".."))
+	assert.Equal(t, "lib$base", pathSegment("lib$base"))
+}
+
+func TestAdapter_GetNamespaceEncoded(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		_, _ = w.Write([]byte(`{"id":1,"name":"ns"}`))
+	}))
+	defer server.Close()
+
+	registry := &model.Registry{
+		Type:       model.RegistryTypeHuawei,
+		URL:        server.URL,
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+	}
+	adp, err := newAdapter(registry)
+	require.NoError(t, err)
+	a := adp.(*adapter)
+
+	for _, name := range []string{"a/b", "a%41", "..", "../repositories"} {
+		_, err := a.GetNamespace(name)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{
+		"/dockyard/v2/namespaces/a%2Fb",
+		"/dockyard/v2/namespaces/a%2541",
+		"/dockyard/v2/namespaces/%2E%2E",
+		"/dockyard/v2/namespaces/..%2Frepositories",
+	}, paths)
+}
@@ -0,0 +1,99 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	liberrors "github.com/goharbor/harbor/src/lib/errors"
+)
+
+// adaptiveLatencyTarget is the latency under which the successful operations ramp up the concurrency
+const adaptiveLatencyTarget = time.Second
+
+// adaptiveLimiter bounds the concurrent operations sent to Huawei SWR with a limit adapting to how SWR
+// responds: the limit is halved when the operations are throttled or SWR is overloaded, and increased
+// by one per round of the fast successful operations, within the bounds set by WithAdaptiveConcurrency.
+// A nil limiter doesn't bound anything
+type adaptiveLimiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	min      float64
+	max      float64
+	limit    float64
+	inflight int
+}
+
+// newAdaptiveLimiter returns the limiter starting from the lower bound
+func newAdaptiveLimiter(minConcurrency, maxConcurrency int) *adaptiveLimiter {
+	l := &adaptiveLimiter{
+		min:   float64(minConcurrency),
+		max:   float64(maxConcurrency),
+		limit: float64(minConcurrency),
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire blocks until the operation is allowed under the current limit, the returned
+// function must be called with the result of the operation once it's done
+func (l *adaptiveLimiter) acquire() func(error) {
+	if l == nil {
+		return func(error) {}
+	}
+	l.mu.Lock()
+	for l.inflight >= int(l.limit) {
+		l.cond.Wait()
+	}
+	l.inflight++
+	l.mu.Unlock()
+
+	start := time.Now()
+	return func(err error) {
+		l.release(time.Since(start), err)
+	}
+}
+
+// release adjusts the limit with the latency and the result of the finished operation
+func (l *adaptiveLimiter) release(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	switch {
+	case isOverloaded(err):
+		l.limit = math.Max(l.min, l.limit/2)
+	case err == nil && latency <= adaptiveLatencyTarget:
+		// one more slot after a round of "limit" fast successes
+		l.limit = math.Min(l.max, l.limit+1/l.limit)
+	}
+	l.cond.Broadcast()
+}
+
+// current returns the current limit
+func (l *adaptiveLimiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// isOverloaded reports whether the operation failing with err indicates SWR is throttling
+// the requests or overloaded, the 429 returned by the native registry client is covered as well
+func isOverloaded(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServer) || errors.Is(err, ErrMaintenance) ||
+		liberrors.IsRateLimitError(err)
+}
@@ -0,0 +1,100 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	gock "gopkg.in/h2non/gock.v1"
+
+	liberrors "github.com/goharbor/harbor/src/lib/errors"
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	l := newAdaptiveLimiter(1, 4)
+	assert.Equal(t, 1, l.current())
+
+	// ramps up with the fast successes
+	for i := 0; i < 20; i++ {
+		l.acquire()(nil)
+	}
+	assert.Equal(t, 4, l.current())
+
+	// backs off when throttled
+	l.acquire()(&Error{StatusCode: 429})
+	assert.Equal(t, 2, l.current())
+	l.acquire()(liberrors.New(nil).WithCode(liberrors.RateLimitCode))
+	assert.Equal(t, 1, l.current())
+	// never below the lower bound
+	l.acquire()(fmt.Errorf("%w: overloaded", ErrServer))
+	assert.Equal(t, 1, l.current())
+
+	// the slow successes and other errors keep the limit
+	l.inflight++
+	l.release(2*adaptiveLatencyTarget, nil)
+	l.acquire()(ErrNotFound)
+	assert.Equal(t, 1, l.current())
+
+	// the nil limiter bounds nothing
+	var nilLimiter *adaptiveLimiter
+	nilLimiter.acquire()(nil)
+}
+
+func TestAdaptiveLimiterBlocks(t *testing.T) {
+	l := newAdaptiveLimiter(1, 1)
+	release := l.acquire()
+
+	var acquired atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		l.acquire()(nil)
+		acquired.Store(true)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, acquired.Load())
+
+	release(nil)
+	<-done
+	assert.True(t, acquired.Load())
+}
+
+func TestAdapter_PrepareForPushConcurrently(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	for _, ns := range []string{"ns1", "ns2", "ns3"} {
+		mockRequest().Get("/dockyard/v2/namespaces/" + ns).Reply(200).BodyString("{}")
+	}
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"ns1","auth":0,"description":"Managed by Harbor replication"}`).Reply(201)
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"ns2","auth":0,"description":"Managed by Harbor replication"}`).Reply(400)
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"ns3","auth":0,"description":"Managed by Harbor replication"}`).Reply(201)
+
+	a := getMockAdapter(t, WithAdaptiveConcurrency(2, 4))
+	var resources []*model.Resource
+	for _, ns := range []string{"ns1", "ns2", "ns3"} {
+		resources = append(resources, &model.Resource{
+			Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: ns + "/app"}},
+		})
+	}
+	err := a.PrepareForPush(resources)
+	assert.EqualError(t, err, "failed to create namespace ns2 (namespaces created: ns1, ns3): [400][]")
+	assert.True(t, gock.IsDone())
+}
@@ -0,0 +1,89 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/goharbor/harbor/src/lib"
+	"github.com/goharbor/harbor/src/pkg/registry/auth"
+)
+
+// Credential is the access key and secret of Huawei SWR returned by a CredentialProvider
+type Credential struct {
+	AccessKey    string
+	AccessSecret string
+}
+
+// CredentialProvider returns the current credential of Huawei SWR, see WithCredentialProvider.
+// It's called for every request, so it's expected to cache the credential until it's rotated
+type CredentialProvider func() (Credential, error)
+
+// credential returns the current credential from the provider, ErrNoCredential is returned
+// if the provider returns an empty one
+func credential(provider CredentialProvider) (Credential, error) {
+	cred, err := provider()
+	if err != nil {
+		return cred, fmt.Errorf("failed to get the credential of huawei SWR: %w", err)
+	}
+	if len(cred.AccessKey) == 0 || len(cred.AccessSecret) == 0 {
+		return cred, ErrNoCredential
+	}
+	return cred, nil
+}
+
+// providerAuthorizer sets the basic authorization of the requests with the current credential of the provider
+type providerAuthorizer struct {
+	provider CredentialProvider
+}
+
+// Modify ...
+func (p *providerAuthorizer) Modify(req *http.Request) error {
+	cred, err := credential(p.provider)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(cred.AccessKey, cred.AccessSecret)
+	return nil
+}
+
+// rotatingAuthorizer authorizes the requests of the registry API sent by the native adapter with the
+// current credential of the provider. The underlying authorizer, which resolves the auth scheme and
+// caches the bearer tokens, is rebuilt once the credential is rotated
+type rotatingAuthorizer struct {
+	sync.Mutex
+	provider   CredentialProvider
+	transport  http.RoundTripper
+	current    Credential
+	authorizer lib.Authorizer
+}
+
+// Modify ...
+func (r *rotatingAuthorizer) Modify(req *http.Request) error {
+	cred, err := credential(r.provider)
+	if err != nil {
+		return err
+	}
+	r.Lock()
+	if r.authorizer == nil || cred != r.current {
+		r.authorizer = auth.NewAuthorizerWithTransport(cred.AccessKey, cred.AccessSecret, r.transport)
+		r.current = cred
+	}
+	authorizer := r.authorizer
+	r.Unlock()
+	return authorizer.Modify(req)
+}
@@ -0,0 +1,95 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gock "gopkg.in/h2non/gock.v1"
+
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+func TestAdapter_WithCredentialProvider(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		BasicAuth("ak1", "sk1").
+		Reply(200).BodyString(`{"namespaces":[]}`)
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		BasicAuth("ak2", "sk2").
+		Reply(200).BodyString(`{"namespaces":[]}`)
+
+	cred := Credential{AccessKey: "ak1", AccessSecret: "sk1"}
+	var providerErr error
+	provider := func() (Credential, error) {
+		return cred, providerErr
+	}
+	// no static credential is needed with the provider
+	registry := &model.Registry{
+		Type: model.RegistryTypeHuawei,
+		URL:  "https://swr.cn-north-1.myhuaweicloud.com",
+	}
+	adp, err := newAdapter(registry, WithCredentialProvider(provider))
+	require.NoError(t, err)
+	a := adp.(*adapter)
+	gock.InterceptClient(a.client.GetClient())
+
+	_, err = a.ListNamespaces(nil)
+	assert.NoError(t, err)
+	// the rotated credential is used without recreating the adapter
+	cred = Credential{AccessKey: "ak2", AccessSecret: "sk2"}
+	_, err = a.ListNamespaces(nil)
+	assert.NoError(t, err)
+	assert.True(t, gock.IsDone())
+
+	providerErr = errors.New("secrets manager unavailable")
+	_, err = a.ListNamespaces(nil)
+	assert.ErrorIs(t, err, providerErr)
+
+	providerErr = nil
+	cred = Credential{}
+	_, err = a.ListNamespaces(nil)
+	assert.ErrorIs(t, err, ErrNoCredential)
+}
+
+func TestRotatingAuthorizer(t *testing.T) {
+	cred := Credential{AccessKey: "ak1", AccessSecret: "sk1"}
+	r := &rotatingAuthorizer{provider: func() (Credential, error) { return cred, nil }}
+
+	// the registry without the auth challenge is accessed anonymously
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v2/", nil)
+	require.NoError(t, err)
+	require.NoError(t, r.Modify(req))
+	first := r.authorizer
+
+	require.NoError(t, r.Modify(req))
+	assert.Same(t, first, r.authorizer)
+
+	cred = Credential{AccessKey: "ak2", AccessSecret: "sk2"}
+	require.NoError(t, r.Modify(req))
+	assert.NotSame(t, first, r.authorizer)
+	assert.Equal(t, cred, r.current)
+}
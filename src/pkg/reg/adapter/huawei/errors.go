@@ -0,0 +1,260 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// ErrUnreachable indicates Huawei SWR can't be reached, e.g. DNS, network or TLS failures
+	ErrUnreachable = errors.New("huawei SWR is unreachable")
+	// ErrUnauthorized indicates Huawei SWR rejected the configured credential
+	ErrUnauthorized = errors.New("huawei SWR rejected the credential")
+	// ErrDNSResolution indicates the host of Huawei SWR can't be resolved
+	ErrDNSResolution = errors.New("DNS resolution failed")
+	// ErrConnectionRefused indicates the connection to Huawei SWR is refused
+	ErrConnectionRefused = errors.New("connection refused")
+	// ErrTLS indicates the TLS handshake with Huawei SWR failed, e.g. the certificate can't be verified
+	ErrTLS = errors.New("TLS handshake failed")
+	// ErrServer indicates Huawei SWR responded with a 5xx status code
+	ErrServer = errors.New("huawei SWR server error")
+	// ErrResponseTooLarge indicates the response body exceeds the max response body size
+	ErrResponseTooLarge = errors.New("response body too large")
+	// ErrMaintenance indicates Huawei SWR responded with 503, which is usually returned with
+	// an HTML page during the maintenance windows, the callers are expected to back off
+	ErrMaintenance = errors.New("huawei SWR is unavailable, maybe in maintenance")
+	// ErrUnsupportedAPIVersion indicates the management API of the SWR deployment isn't the version
+	// the adapter speaks, e.g. the API is changed or the base path points to a different service
+	ErrUnsupportedAPIVersion = errors.New("unsupported SWR API version")
+	// ErrUnsupported indicates the SWR deployment doesn't provide the API of the operation, e.g. the triggers
+	ErrUnsupported = errors.New("operation not supported by huawei SWR")
+	// ErrNoCredential indicates the registry has no credential, which all the APIs of Huawei SWR require
+	ErrNoCredential = errors.New("no credentials configured for huawei SWR")
+	// ErrNamespaceExists indicates the namespace to be created already exists on Huawei SWR
+	ErrNamespaceExists = errors.New("namespace already exists")
+	// ErrInvalidNamespaceName indicates the namespace name violates the naming rules of SWR, see ValidateNamespaceName
+	ErrInvalidNamespaceName = errors.New("invalid namespace name")
+	// ErrDeletionNotAllowed indicates the artifact to be deleted is out of the scope set by WithDeletionScope,
+	// or no scope is set
+	ErrDeletionNotAllowed = errors.New("deletion not allowed")
+	// ErrImmutableTag indicates Huawei SWR rejected overwriting the tag protected by the immutability rules of
+	// the namespace, retrying the push doesn't help until the rules are changed
+	ErrImmutableTag = errors.New("tag is immutable in SWR")
+	// ErrRetryBudgetExhausted indicates the retries of the job exceed the budget set by WithRetryBudget
+	ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+	// ErrCircuitOpen indicates the request isn't sent as Huawei SWR keeps failing, see WithCircuitBreaker
+	ErrCircuitOpen = errors.New("circuit open")
+	// ErrPaginationLimitExceeded indicates a listing returns more pages or items than allowed, which
+	// usually means the endpoint never signals the last page
+	ErrPaginationLimitExceeded = errors.New("pagination limit exceeded")
+	// ErrNotFound indicates Huawei SWR responded with 404
+	ErrNotFound = errors.New("resource not found on huawei SWR")
+	// ErrRateLimited indicates Huawei SWR responded with 429, the callers are expected to back off
+	ErrRateLimited = errors.New("requests are throttled by huawei SWR")
+	// ErrNamespaceNotFound indicates the namespace doesn't exist on Huawei SWR, it's returned along with ErrNotFound
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	// ErrOperationTimeout indicates an operation accepted asynchronously by Huawei SWR doesn't complete in time
+	ErrOperationTimeout = errors.New("asynchronous operation timed out")
+)
+
+// Error is returned when Huawei SWR responds with an unexpected status code, the request ID and trace ID
+// are kept for the support escalation
+type Error struct {
+	StatusCode int
+	Body       string
+	RequestID  string
+	TraceID    string
+	// RetryAfter is how long SWR asks to wait before retrying the throttled request, zero if
+	// the response isn't 429 or has no valid "Retry-After" header
+	RetryAfter time.Duration
+}
+
+// Error ...
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("[%d][%s]", e.StatusCode, e.Body)
+	if len(e.RequestID) > 0 {
+		msg += fmt.Sprintf("[request id: %s]", e.RequestID)
+	}
+	if len(e.TraceID) > 0 {
+		msg += fmt.Sprintf("[trace id: %s]", e.TraceID)
+	}
+	return msg
+}
+
+// statusSentinels are the sentinel errors matched by the Error of the common status codes
+var statusSentinels = map[int]error{
+	http.StatusUnauthorized:       ErrUnauthorized,
+	http.StatusForbidden:          ErrUnauthorized,
+	http.StatusNotFound:           ErrNotFound,
+	http.StatusTooManyRequests:    ErrRateLimited,
+	http.StatusServiceUnavailable: ErrMaintenance,
+}
+
+// Is makes the Error match the sentinel error of its status code, e.g. the Error of 503
+// matches ErrMaintenance, so the callers needn't check the status codes, see statusSentinels
+func (e *Error) Is(target error) bool {
+	sentinel, ok := statusSentinels[e.StatusCode]
+	return ok && sentinel == target
+}
+
+// newError builds the Error from the response, the body of the response is consumed and
+// cut at the max response body size, then sanitized for the errors and the logs, see sanitizeBody
+func (a *adapter) newError(resp *http.Response) *Error {
+	body, _ := a.readBody(resp)
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		Body:       sanitizeBody(body, a.opts.errorBodyLength),
+		RequestID:  resp.Header.Get(requestIDHeader),
+		TraceID:    resp.Header.Get("X-Trace-Id"),
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		e.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return e
+}
+
+// parseRetryAfter parses the "Retry-After" header in either the delay seconds or the HTTP-date form,
+// zero is returned if it's absent, invalid or the date is already past now
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0
+	}
+	return max(date.Sub(now), 0)
+}
+
+// retryAfter returns the wait SWR asks for if err is the 429 response carrying the "Retry-After" header
+func retryAfter(err error) (time.Duration, bool) {
+	var e *Error
+	if errors.As(err, &e) && e.StatusCode == http.StatusTooManyRequests && e.RetryAfter > 0 {
+		return e.RetryAfter, true
+	}
+	return 0, false
+}
+
+// sanitizeBody makes the response body safe to be put into the errors and the logs, the line breaks
+// and the tabs are replaced with spaces, the other control characters and the invalid UTF-8 sequences
+// are dropped, and the body longer than length bytes is cut at a rune boundary with "..." appended
+func sanitizeBody(body []byte, length int) string {
+	var b strings.Builder
+	for _, r := range strings.ToValidUTF8(string(body), "") {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			r = ' '
+		case unicode.IsControl(r):
+			continue
+		}
+		if b.Len()+utf8.RuneLen(r) > length {
+			b.WriteString("...")
+			break
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// classifyTransportError wraps the error returned when sending the request with ErrUnreachable
+// and the sentinel describing the reason if it can be recognized
+func classifyTransportError(err error) error {
+	var (
+		dnsErr       *net.DNSError
+		verifyErr    *tls.CertificateVerificationError
+		recordErr    tls.RecordHeaderError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return fmt.Errorf("%w: %w", ErrUnreachable, err)
+	case errors.As(err, &dnsErr):
+		return fmt.Errorf("%w: %w: %v", ErrUnreachable, ErrDNSResolution, err)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Errorf("%w: %w: %v", ErrUnreachable, ErrConnectionRefused, err)
+	// the alert isn't exposed as tls.AlertError through the transport
+	case strings.Contains(err.Error(), "protocol version not supported"), strings.Contains(err.Error(), "unsupported protocol version"):
+		return fmt.Errorf("%w: %w: the TLS version of the endpoint is below the minimum: %v", ErrUnreachable, ErrTLS, err)
+	case errors.As(err, &verifyErr), errors.As(err, &recordErr), errors.As(err, &authorityErr),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return fmt.Errorf("%w: %w: %v", ErrUnreachable, ErrTLS, err)
+	default:
+		return fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+}
+
+// classifyStatusError wraps the error built from the unexpected status code
+// with ErrUnauthorized for 401/403 and ErrServer for 5xx
+func classifyStatusError(e *Error) error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrUnauthorized, e)
+	case e.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("%w: %w", ErrServer, e)
+	default:
+		return e
+	}
+}
+
+// isTransient reports whether the request failing with err is worth retrying, which are the
+// 5xx and 429 responses and the connection failures other than the DNS and TLS ones
+func isTransient(err error) bool {
+	switch {
+	// the exhausted budget wraps the last error, which may be transient itself
+	case errors.Is(err, ErrRetryBudgetExhausted):
+		return false
+	case errors.Is(err, ErrServer), errors.Is(err, ErrRateLimited):
+		return true
+	case errors.Is(err, ErrDNSResolution), errors.Is(err, ErrTLS), errors.Is(err, ErrCircuitOpen), errors.Is(err, ErrImmutableTag):
+		return false
+	default:
+		return errors.Is(err, ErrUnreachable)
+	}
+}
+
+// immutabilityMarkers are the phrases the rejections of the immutability rules are recognized by, SWR
+// responds with 400, 403 or 409 depending on the deployment but always mentions the immutability
+var immutabilityMarkers = []string{"immutable", "immutability"}
+
+// classifyPushError wraps the error of pushing the manifest with ErrImmutableTag if Huawei SWR rejected
+// it for the immutability rules, the other errors are returned as is
+func classifyPushError(repository, reference string, err error) error {
+	msg := strings.ToLower(err.Error())
+	for _, marker := range immutabilityMarkers {
+		if strings.Contains(msg, marker) {
+			return fmt.Errorf("%w: %s:%s can't be overwritten, check the immutability rules of the namespace: %w",
+				ErrImmutableTag, repository, reference, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gock "gopkg.in/h2non/gock.v1"
+
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+func TestError(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/failed").
+		Reply(500).
+		SetHeader("X-Request-Id", "5f3a2b").
+		SetHeader("X-Trace-Id", "c0ffee").
+		BodyString("internal error")
+
+	a := getMockAdapter(t)
+	_, err := a.GetNamespace("failed")
+
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, 500, e.StatusCode)
+	assert.Equal(t, "internal error", e.Body)
+	assert.Equal(t, "5f3a2b", e.RequestID)
+	assert.Equal(t, "c0ffee", e.TraceID)
+	assert.Equal(t, "[500][internal error][request id: 5f3a2b][trace id: c0ffee]", err.Error())
+
+	e = &Error{StatusCode: 404, Body: "not found"}
+	assert.Equal(t, "[404][not found]", e.Error())
+}
+
+func TestClassifyTransportError(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected error
+	}{
+		{err: &net.DNSError{Err: "no such host", Name: "swr.invalid"}, expected: ErrDNSResolution},
+		{err: &net.OpError{Op: "dial", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}, expected: ErrConnectionRefused},
+		{err: x509.UnknownAuthorityError{}, expected: ErrTLS},
+		{err: x509.HostnameError{Certificate: &x509.Certificate{}, Host: "swr.com"}, expected: ErrTLS},
+		{err: errors.New("unknown"), expected: ErrUnreachable},
+	}
+	for _, c := range cases {
+		err := classifyTransportError(c.err)
+		assert.ErrorIs(t, err, ErrUnreachable)
+		assert.ErrorIs(t, err, c.expected)
+	}
+}
+
+func TestClassifyStatusError(t *testing.T) {
+	assert.ErrorIs(t, classifyStatusError(&Error{StatusCode: 401}), ErrUnauthorized)
+	assert.ErrorIs(t, classifyStatusError(&Error{StatusCode: 403}), ErrUnauthorized)
+	assert.ErrorIs(t, classifyStatusError(&Error{StatusCode: 503}), ErrServer)
+
+	err := classifyStatusError(&Error{StatusCode: 404})
+	assert.NotErrorIs(t, err, ErrUnauthorized)
+	assert.NotErrorIs(t, err, ErrServer)
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, isTransient(classifyStatusError(&Error{StatusCode: http.StatusServiceUnavailable})))
+	assert.True(t, isTransient(&Error{StatusCode: http.StatusTooManyRequests}))
+	assert.True(t, isTransient(classifyTransportError(syscall.ECONNREFUSED)))
+	assert.False(t, isTransient(classifyTransportError(&net.DNSError{Err: "no such host", Name: "swr"})))
+	assert.False(t, isTransient(&Error{StatusCode: http.StatusBadRequest}))
+	assert.False(t, isTransient(ErrNamespaceExists))
+}
+
+func TestErrorMaintenance(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	page := "<html><body>" + strings.Repeat("SWR is under maintenance. ", 100) + "</body></html>"
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(503).
+		SetHeader("Content-Type", "text/html").
+		BodyString(page)
+
+	a := getMockAdapter(t)
+	_, err := a.ListNamespaces(nil)
+	assert.ErrorIs(t, err, ErrMaintenance)
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, 503, e.StatusCode)
+	assert.Equal(t, page[:defaultErrorBodyLength]+"...", e.Body)
+
+	assert.NotErrorIs(t, &Error{StatusCode: 500}, ErrMaintenance)
+	assert.ErrorIs(t, classifyStatusError(&Error{StatusCode: 503}), ErrMaintenance)
+}
+
+func TestSanitizeBody(t *testing.T) {
+	assert.Equal(t, `{"errors":"not found"}`, sanitizeBody([]byte(`{"errors":"not found"}`), 512))
+	assert.Equal(t, "line1  line2 tab[0m", sanitizeBody([]byte("line1\r\nline2\ttab\x1b[0m\x00"), 512))
+	assert.Equal(t, "ok", sanitizeBody([]byte("o\xffk"), 512))
+	// the body is cut at the rune boundary
+	assert.Equal(t, "界...", sanitizeBody([]byte("界界"), 4))
+	assert.Equal(t, "abcd...", sanitizeBody([]byte(strings.Repeat("abcd", 3)), 4))
+	assert.Equal(t, "abcd", sanitizeBody([]byte("abcd"), 4))
+}
+
+func TestErrorBodyLength(t *testing.T) {
+	defer gock.Off()
+	mockRequest().Get("/dockyard/v2/namespaces/failed").
+		Reply(500).
+		SetHeader("Content-Type", "application/json").
+		BodyString(`{"error_code":"SVCSTG.SWR.5000001","error_msg":"` + strings.Repeat("x", 100) + `"}`)
+
+	a := getMockAdapter(t, WithSettings(map[string]string{SettingErrorBodyLength: "32"}))
+	_, err := a.GetNamespace("failed")
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, `{"error_code":"SVCSTG.SWR.500000...`, e.Body)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter(" 30 ", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter("Wed, 01 May 2024 10:01:30 GMT", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter("Wednesday, 01-May-24 10:01:30 GMT", now))
+	// the past date, the negative delay and the invalid values are ignored
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Wed, 01 May 2024 09:59:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-5", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+}
+
+func TestErrorRetryAfter(t *testing.T) {
+	defer gock.Off()
+	mockRequest().Get("/dockyard/v2/namespaces/throttled").
+		Reply(429).SetHeader("Retry-After", "7")
+	mockRequest().Get("/dockyard/v2/namespaces/unavailable").
+		Reply(503).SetHeader("Retry-After", "7")
+
+	a := getMockAdapter(t)
+	_, err := a.GetNamespace("throttled")
+	d, ok := retryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, 7*time.Second, d)
+
+	// only the 429 responses are retried after the Retry-After
+	_, err = a.GetNamespace("unavailable")
+	_, ok = retryAfter(err)
+	assert.False(t, ok)
+	_, ok = retryAfter(&Error{StatusCode: http.StatusTooManyRequests})
+	assert.False(t, ok)
+}
+
+func TestErrorStatusSentinels(t *testing.T) {
+	assert.ErrorIs(t, &Error{StatusCode: http.StatusNotFound}, ErrNotFound)
+	assert.ErrorIs(t, &Error{StatusCode: http.StatusUnauthorized}, ErrUnauthorized)
+	assert.ErrorIs(t, &Error{StatusCode: http.StatusForbidden}, ErrUnauthorized)
+	assert.ErrorIs(t, &Error{StatusCode: http.StatusTooManyRequests}, ErrRateLimited)
+	assert.NotErrorIs(t, &Error{StatusCode: http.StatusBadRequest}, ErrNotFound)
+	assert.NotErrorIs(t, &Error{StatusCode: http.StatusNotFound}, ErrMaintenance)
+}
+
+func TestAdapter_GetNamespaceNotFound(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/missing").
+		Reply(404).BodyString(`{"errorCode":"SVCSTG.SWR.4040001","errorMessage":"namespace not found"}`)
+	mockRequest().Get("/dockyard/v2/namespaces/missing").
+		Reply(404)
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"missing","auth":0,"description":"Managed by Harbor replication"}`).
+		Reply(201)
+
+	a := getMockAdapter(t)
+	_, err := a.GetNamespace("missing")
+	assert.ErrorIs(t, err, ErrNamespaceNotFound)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// the missing namespace is created
+	resources := []*model.Resource{
+		{Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: "missing/app"}}},
+	}
+	assert.NoError(t, a.PrepareForPush(resources))
+	assert.True(t, gock.IsDone())
+}
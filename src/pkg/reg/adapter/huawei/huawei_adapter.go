@@ -16,18 +16,30 @@ package huawei
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
+	"path"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Masterminds/semver"
 
 	common_http "github.com/goharbor/harbor/src/common/http"
 	"github.com/goharbor/harbor/src/common/http/modifier"
+	"github.com/goharbor/harbor/src/lib"
 	"github.com/goharbor/harbor/src/lib/log"
 	adp "github.com/goharbor/harbor/src/pkg/reg/adapter"
 	"github.com/goharbor/harbor/src/pkg/reg/adapter/native"
 	"github.com/goharbor/harbor/src/pkg/reg/model"
+	"github.com/goharbor/harbor/src/pkg/reg/util"
+	"github.com/goharbor/harbor/src/pkg/registry/auth"
 	"github.com/goharbor/harbor/src/pkg/registry/auth/basic"
 )
 
@@ -41,11 +53,30 @@ func init() {
 }
 
 type factory struct {
+	cache adapterCache
 }
 
-// Create ...
+// Create returns the cached adapter of the registry if the endpoint, the credential and
+// the settings are not changed since the adapter is created, wrapped to count the pushes
+// of the caller alone, see jobAdapter
 func (f *factory) Create(r *model.Registry) (adp.Adapter, error) {
-	return newAdapter(r)
+	create := func() (adp.Adapter, error) {
+		return newAdapter(r, WithSettings(r.Settings))
+	}
+	var (
+		a   adp.Adapter
+		err error
+	)
+	// the registry isn't saved yet, e.g. it's being pinged during the setup
+	if r.ID == 0 {
+		a, err = create()
+	} else {
+		a, err = f.cache.get(r, create)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newJobAdapter(a), nil
 }
 
 // AdapterPattern ...
@@ -54,8 +85,9 @@ func (f *factory) AdapterPattern() *model.AdapterPattern {
 }
 
 var (
-	_ adp.Adapter          = (*adapter)(nil)
-	_ adp.ArtifactRegistry = (*adapter)(nil)
+	_ adp.Adapter           = (*adapter)(nil)
+	_ adp.ArtifactRegistry  = (*adapter)(nil)
+	_ adp.PushStatsReporter = (*jobAdapter)(nil)
 )
 
 // Adapter is for images replications between harbor and Huawei image repository(SWR)
@@ -67,14 +99,57 @@ type adapter struct {
 	// huawei's some api interface with basic authorization,
 	// some with bearer token authorization.
 	oriClient *http.Client
+	// authClient is used to get the token from the auth endpoint,
+	// which may have a different TLS verification setting
+	authClient *common_http.Client
+	// untimedClient is the client of the management API bounded by the timeouts of the operations
+	// instead of the client timeout, nil if no operation has a timeout, see WithOperationTimeouts
+	untimedClient *common_http.Client
+	opts          *options
+	tokens        *tokenCache
+	stats         *pushStats
+	health        *healthCache
+	version       *versionProbe
+	// registryModifiers are applied to the requests sent with oriClient
+	registryModifiers []modifier.Modifier
+	// tagConstraint filters the fetched tags, nil means all the tags are fetched
+	tagConstraint *semver.Constraints
+	// apiBaseURL is the URL of the management API resolved from the registry URL and the base path
+	apiBaseURL string
+	// limiter bounds the concurrent operations if the adaptive concurrency is enabled, see WithAdaptiveConcurrency
+	limiter *adaptiveLimiter
+	// blobUploads bounds the concurrent blob uploads per repository, see WithMaxBlobUploads
+	blobUploads *blobUploadLimiter
+	// uploads tracks the interrupted blob uploads, see WithResumableUploads
+	uploads *uploadSessions
+	// referrersUnsupported is set once SWR turns out not to support the OCI referrers API
+	referrersUnsupported atomic.Bool
+	// namespaceFilterRejectedAt is when SWR rejected the name filter of the namespace listing in unix
+	// nanoseconds, the filter isn't sent until namespaceFilterRetryInterval passes, zero if never rejected
+	namespaceFilterRejectedAt atomic.Int64
+	// breakerKey identifies the circuit breaker of the adapter released by Close, empty if it has none
+	breakerKey string
+	// breakerReleased is set once the circuit breaker is released, so closing again doesn't release it twice
+	breakerReleased atomic.Bool
+	// baseLogger is the logger the structured loggers of the operations derive from, the default
+	// logger is used if it's nil
+	baseLogger *log.Logger
 }
 
-// Info gets info about Huawei SWR
+// the load SWR takes without throttling the account, the scheduler can spread
+// the scheduled replications with them rather than firing all at once
+const (
+	safeConcurrency   = 5
+	advisoryRateLimit = 10
+)
+
+// Info gets info about Huawei SWR, the generic OCI artifacts, e.g. SBOMs,
+// signatures and WASM modules, go through the same push path as the images
 func (a *adapter) Info() (*model.RegistryInfo, error) {
 	registryInfo := model.RegistryInfo{
 		Type:                   model.RegistryTypeHuawei,
 		Description:            "Adapter for SWR -- The image registry of Huawei Cloud",
-		SupportedResourceTypes: []string{model.ResourceTypeImage},
+		SupportedResourceTypes: []string{model.ResourceTypeImage, model.ResourceTypeArtifact},
 		SupportedResourceFilters: []*model.FilterStyle{
 			{
 				Type:  model.FilterTypeName,
@@ -85,137 +160,834 @@ func (a *adapter) Info() (*model.RegistryInfo, error) {
 				Style: model.FilterStyleTypeText,
 			},
 		},
+		// the event based replications propagate the deletions as well, see DeleteManifest
 		SupportedTriggers: []string{
 			model.TriggerTypeManual,
 			model.TriggerTypeScheduled,
+			model.TriggerTypeEventBased,
 		},
+		SafeConcurrency:   safeConcurrency,
+		AdvisoryRateLimit: advisoryRateLimit,
 	}
 	return &registryInfo, nil
 }
 
+// Capabilities reports the operations the adapter actually implements, so the callers
+// programming against multiple adapters can skip the unsupported ones rather than getting
+// the errors at runtime
+type Capabilities struct {
+	// ImageReplication and ArtifactReplication are the resource types Info advertises
+	ImageReplication    bool
+	ArtifactReplication bool
+	// ChartReplication is always false, SWR doesn't host the helm charts
+	ChartReplication bool
+	ListNamespaces   bool
+	CreateNamespace  bool
+	ListTags         bool
+	DeleteManifest   bool
+	// DeleteTag is false, as SWR can't delete a tag without deleting the manifest it refers to
+	DeleteTag bool
+	// BlobMount is false, as SWR doesn't support the cross repository blob mount
+	BlobMount bool
+	// ScheduledTrigger and EventBasedTrigger are the triggers Info advertises
+	ScheduledTrigger  bool
+	EventBasedTrigger bool
+}
+
+// Capabilities returns the capabilities of the adapter, which are consistent with Info
+func (a *adapter) Capabilities() Capabilities {
+	caps := Capabilities{
+		ListNamespaces:  true,
+		CreateNamespace: true,
+		ListTags:        true,
+		DeleteManifest:  true,
+	}
+	info, err := a.Info()
+	if err != nil {
+		return caps
+	}
+	for _, t := range info.SupportedResourceTypes {
+		switch t {
+		case model.ResourceTypeImage:
+			caps.ImageReplication = true
+		case model.ResourceTypeArtifact:
+			caps.ArtifactReplication = true
+		}
+	}
+	for _, t := range info.SupportedTriggers {
+		switch t {
+		case model.TriggerTypeScheduled:
+			caps.ScheduledTrigger = true
+		case model.TriggerTypeEventBased:
+			caps.EventBasedTrigger = true
+		}
+	}
+	return caps
+}
+
 // ListNamespaces lists namespaces from Huawei SWR with the provided query conditions.
+// Only the namespaces visible to the user are listed unless the adapter is created
+// with WithAllNamespaces. The namespaces are de-duplicated and sorted by name.
 func (a *adapter) ListNamespaces(query *model.NamespaceQuery) ([]*model.Namespace, error) {
-	var namespaces []*model.Namespace
+	namespaces, _, err := a.ListNamespacesPage(query)
+	return namespaces, err
+}
+
+// ListNamespacesPage lists the namespaces matching the query like ListNamespaces and returns the
+// total count of the matched namespaces as well, so the callers can load the namespaces page by
+// page with the Page and PageSize of the query. SWR returns all the namespaces in one response,
+// so the pagination is applied on the matched namespaces.
+func (a *adapter) ListNamespacesPage(query *model.NamespaceQuery) ([]*model.Namespace, int64, error) {
+	list, err := a.listNamespaces(query, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	return list.Namespaces, list.Matched, nil
+}
+
+// NamespaceList is a page of the namespaces along with the counts, e.g. to show
+// "12 of 340 namespaces"
+type NamespaceList struct {
+	// Namespaces are the page of the namespaces matching the query
+	Namespaces []*model.Namespace
+	// Matched is the count of the namespaces matching the query before the pagination
+	Matched int64
+	// Total is the count of all the namespaces listed by SWR regardless of the query
+	Total int64
+}
+
+// ListNamespacesWithCounts lists the namespaces matching the query like ListNamespacesPage,
+// and returns the total count of the namespaces listed by SWR as well, which isn't paginated,
+// so no other listing is needed to get it. The name filter isn't sent to SWR, see
+// serverNamespaceFilter, so the total counts all the namespaces regardless of the query
+func (a *adapter) ListNamespacesWithCounts(query *model.NamespaceQuery) (*NamespaceList, error) {
+	return a.listNamespaces(query, false)
+}
 
-	urls := fmt.Sprintf("%s/dockyard/v2/visible/namespaces", a.registry.URL)
+// listNamespaces lists the namespaces matching the query, the name filter of the query is sent to
+// SWR if serverFilter is set, then the total only counts the namespaces passing the filter
+func (a *adapter) listNamespaces(query *model.NamespaceQuery, serverFilter bool) (*NamespaceList, error) {
+	var namespaces []*model.Namespace
+	urls := a.apiURL("visible", "namespaces")
+	if a.opts.listAllNamespaces {
+		urls = a.apiURL("namespaces")
+	}
+	var filter string
+	if serverFilter {
+		filter = a.serverNamespaceFilter(query)
+	}
+	if len(filter) > 0 {
+		urls = fmt.Sprintf("%s?namespace=%s", urls, url.QueryEscape(filter))
+	}
 
 	r, err := http.NewRequest("GET", urls, nil)
 	if err != nil {
-		return namespaces, err
+		return nil, err
 	}
 
 	r.Header.Add("content-type", "application/json; charset=utf-8")
 
-	resp, err := a.client.Do(r)
+	start := time.Now()
+	resp, err := a.doWithTimeout(r, a.opts.listTimeout)
+	logResponse(a.logger("ListNamespaces", nil), r, resp, err, start)
 	if err != nil {
-		return namespaces, err
+		return nil, err
 	}
 
 	defer resp.Body.Close()
 	code := resp.StatusCode
-	if code >= 300 || code < 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return namespaces, fmt.Errorf("[%d][%s]", code, string(body))
+	// the deployments not supporting the filter reject it, they're listed in full for a while, so a
+	// bad request caused by something else doesn't disable the filter for good
+	if code == http.StatusBadRequest && len(filter) > 0 {
+		log.Debugf("the name filter of the namespace listing is rejected by Huawei SWR %s, filtering the namespaces locally for %v: %v",
+			a.registry.URL, namespaceFilterRetryInterval, a.newError(resp))
+		a.namespaceFilterRejectedAt.Store(time.Now().UnixNano())
+		return a.listNamespaces(query, false)
 	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return namespaces, err
+	if code == http.StatusForbidden && len(a.opts.fallbackNamespaces) > 0 {
+		log.Warningf("the credential isn't allowed to list the namespaces of Huawei SWR %s, falling back to the namespaces %v: %v",
+			a.registry.URL, a.opts.fallbackNamespaces, a.newError(resp))
+		return a.listFallbackNamespaces(query)
+	}
+	if code >= 300 || code < 200 {
+		e := a.newError(resp)
+		if isAPIMismatch(e) {
+			return nil, a.checkAPIVersion(e)
+		}
+		return nil, e
 	}
-
 	var namespacesData hwNamespaceList
-	err = json.Unmarshal(body, &namespacesData)
-	if err != nil {
-		return namespaces, err
+	if err = a.decodeBody(resp, &namespacesData); err != nil {
+		if isAPIMismatch(err) {
+			return nil, a.checkAPIVersion(err)
+		}
+		return nil, err
 	}
-	reg := fmt.Sprintf(".*%s.*", strings.Replace(query.Name, " ", "", -1))
 
+	seen, listed := map[string]struct{}{}, map[string]struct{}{}
 	for _, namespaceData := range namespacesData.Namespace {
+		listed[namespaceData.Name] = struct{}{}
+		if !matchNamespaceOwner(query, namespaceData) {
+			continue
+		}
+		if a.opts.writableNamespacesOnly && !a.namespaceWritable(&namespaceData) {
+			continue
+		}
+		// keep the first one if the namespace is listed more than once
+		if _, ok := seen[namespaceData.Name]; ok {
+			continue
+		}
+		seen[namespaceData.Name] = struct{}{}
 		namespace := model.Namespace{
 			Name:     namespaceData.Name,
 			Metadata: namespaceData.metadata(),
 		}
-		b, err := regexp.MatchString(reg, namespace.Name)
+		b, err := matchNamespace(query, namespace.Name)
 		if err != nil {
-			return namespaces, nil
+			return nil, err
 		}
 		if b {
 			namespaces = append(namespaces, &namespace)
 		}
 	}
-	return namespaces, nil
+	// the namespaces are sorted by name for the stable output and pagination
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Name < namespaces[j].Name
+	})
+	return &NamespaceList{
+		Namespaces: paginateNamespaces(namespaces, query),
+		Matched:    int64(len(namespaces)),
+		Total:      int64(len(listed)),
+	}, nil
+}
+
+// listFallbackNamespaces lists the namespaces set by WithFallbackNamespaces matching the query, the
+// owner, the access and the image count of them are unknown, so the query of them and
+// WithWritableNamespacesOnly don't exclude them
+func (a *adapter) listFallbackNamespaces(query *model.NamespaceQuery) (*NamespaceList, error) {
+	var namespaces []*model.Namespace
+	seen := map[string]struct{}{}
+	for _, name := range a.opts.fallbackNamespaces {
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		b, err := matchNamespace(query, name)
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			namespaces = append(namespaces, &model.Namespace{Name: name})
+		}
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Name < namespaces[j].Name
+	})
+	return &NamespaceList{
+		Namespaces: paginateNamespaces(namespaces, query),
+		Matched:    int64(len(namespaces)),
+		Total:      int64(len(seen)),
+	}, nil
+}
+
+// paginateNamespaces returns the page of the namespaces selected by the query
+func paginateNamespaces(namespaces []*model.Namespace, query *model.NamespaceQuery) []*model.Namespace {
+	if query == nil || query.PageSize <= 0 {
+		return namespaces
+	}
+	page := query.Page
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * query.PageSize
+	if start >= int64(len(namespaces)) {
+		return []*model.Namespace{}
+	}
+	end := start + query.PageSize
+	if end > int64(len(namespaces)) {
+		end = int64(len(namespaces))
+	}
+	return namespaces[start:end]
+}
+
+// matchNamespace checks whether the namespace name matches the query name
+// according to the match style of the query
+func matchNamespace(query *model.NamespaceQuery, name string) (bool, error) {
+	if query == nil {
+		return true, nil
+	}
+	pattern := strings.Replace(query.Name, " ", "", -1)
+	switch query.MatchStyle {
+	case model.NamespaceMatchStyleGlob:
+		return util.Match(pattern, name)
+	case "", model.NamespaceMatchStyleSubstring:
+		return strings.Contains(name, pattern), nil
+	default:
+		return false, fmt.Errorf("unsupported namespace match style: %s", query.MatchStyle)
+	}
+}
+
+// namespaceFilterRetryInterval is how long the name filter isn't sent to SWR after it's rejected
+const namespaceFilterRetryInterval = 10 * time.Minute
+
+// serverNamespaceFilter returns the name filter SWR applies to the namespace listing, which finds the
+// namespaces whose name contains the filter. It's the name of the substring query, and the literal prefix
+// of the glob pattern, e.g. "team-" of "team-*", as SWR can't match the globs. No filter is sent if the
+// pattern starts with a wildcard, WithServerSideNamespaceFilter disables it or SWR rejected it within
+// namespaceFilterRetryInterval. The names are always matched locally as well, so the deployments ignoring
+// the filter list the same namespaces. Only ListNamespaces and ListNamespacesPage send the filter
+func (a *adapter) serverNamespaceFilter(query *model.NamespaceQuery) string {
+	if query == nil || !a.opts.serverNamespaceFilter {
+		return ""
+	}
+	if rejectedAt := a.namespaceFilterRejectedAt.Load(); rejectedAt > 0 &&
+		time.Since(time.Unix(0, rejectedAt)) < namespaceFilterRetryInterval {
+		return ""
+	}
+	pattern := strings.Replace(query.Name, " ", "", -1)
+	switch query.MatchStyle {
+	case "", model.NamespaceMatchStyleSubstring:
+		return pattern
+	case model.NamespaceMatchStyleGlob:
+		if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+			return pattern[:i]
+		}
+		return pattern
+	default:
+		return ""
+	}
+}
+
+// matchNamespaceOwner checks the creator, the domain and the image count of the namespace against
+// the query, SWR can't filter the namespaces by them so it's done on the listed namespaces
+func matchNamespaceOwner(query *model.NamespaceQuery, ns hwNamespace) bool {
+	if query == nil {
+		return true
+	}
+	if len(query.Creator) > 0 && query.Creator != ns.CreatorName {
+		return false
+	}
+	if len(query.Domain) > 0 && query.Domain != ns.DomainName {
+		return false
+	}
+	if query.MinImageCount != nil && ns.ImageCount < *query.MinImageCount {
+		return false
+	}
+	if query.MaxImageCount != nil && ns.ImageCount > *query.MaxImageCount {
+		return false
+	}
+	return true
 }
 
-// ConvertResourceMetadata convert resource metadata for Huawei SWR
+// ConvertResourceMetadata convert resource metadata for Huawei SWR, the artifacts are kept
+// along with their labels, see warnDroppedLabels for the labels SWR can't store. The repository is
+// the one of SWR the resource is pushed to, see WithDestinationPrefix, the push operations take the
+// source repository and apply the prefix themselves, so the converted one isn't passed to them
 func (a *adapter) ConvertResourceMetadata(resourceMetadata *model.ResourceMetadata, _ *model.Namespace) (*model.ResourceMetadata, error) {
 	metadata := &model.ResourceMetadata{
 		Repository: resourceMetadata.Repository,
+		Artifacts:  resourceMetadata.Artifacts,
 		Vtags:      resourceMetadata.Vtags,
 	}
+	if len(a.opts.destinationPrefix) > 0 && resourceMetadata.Repository != nil {
+		metadata.Repository = &model.Repository{
+			Name:     a.destinationRepository(resourceMetadata.Repository.Name),
+			Metadata: resourceMetadata.Repository.Metadata,
+		}
+	}
 	return metadata, nil
 }
 
-// PrepareForPush prepare for push to Huawei SWR
-func (a *adapter) PrepareForPush(resources []*model.Resource) error {
-	namespaces := map[string]struct{}{}
+// destinationRepository returns the repository of SWR the repository is pushed to, i.e. the one
+// prefixed by WithDestinationPrefix
+func (a *adapter) destinationRepository(repository string) string {
+	if len(a.opts.destinationPrefix) == 0 {
+		return repository
+	}
+	return applyDestinationPrefix(a.opts.destinationPrefix, repository)
+}
+
+// namespaceInvalidChars matches the characters not allowed in the namespaces of SWR
+var namespaceInvalidChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// maxNamespaceLength is the max length of the namespaces of SWR
+const maxNamespaceLength = 64
+
+// ValidateNamespaceName checks the name against the naming rules of the namespaces of SWR, so the
+// invalid ones are refused before any request: 1 to 64 lowercase letters, digits, periods, underscores
+// and hyphens, starting with a letter and ending with a letter or a digit, and no separators in a row
+// other than two underscores. Each segment of the organization-scoped namespaces, e.g. "org/team",
+// is checked on its own, see WithOrganizations. ErrInvalidNamespaceName is returned for the invalid name
+func ValidateNamespaceName(name string) error {
+	for _, segment := range strings.Split(name, "/") {
+		if reason := namespaceNameViolation(segment); len(reason) > 0 {
+			return fmt.Errorf("%w: %q %s", ErrInvalidNamespaceName, name, reason)
+		}
+	}
+	return nil
+}
+
+// namespaceNameViolation returns the rule the segment of the namespace violates, empty if none
+func namespaceNameViolation(segment string) string {
+	switch {
+	case len(segment) == 0:
+		return "has an empty segment"
+	case len(segment) > maxNamespaceLength:
+		return fmt.Sprintf("is longer than %d characters", maxNamespaceLength)
+	case namespaceInvalidChars.MatchString(segment):
+		return "contains characters other than the lowercase letters, digits, '.', '_' and '-'"
+	case segment[0] < 'a' || segment[0] > 'z':
+		return "doesn't start with a lowercase letter"
+	case isNamespaceSeparator(segment[len(segment)-1]):
+		return "doesn't end with a lowercase letter or a digit"
+	}
+	for i := 1; i < len(segment); i++ {
+		if !isNamespaceSeparator(segment[i-1]) || !isNamespaceSeparator(segment[i]) {
+			continue
+		}
+		if segment[i-1] == '_' && segment[i] == '_' && (i < 2 || segment[i-2] != '_') {
+			continue
+		}
+		return fmt.Sprintf("has the separators %q in a row", segment[i-1:i+1])
+	}
+	return ""
+}
+
+func isNamespaceSeparator(c byte) bool {
+	return c == '.' || c == '_' || c == '-'
+}
+
+// applyDestinationPrefix merges the prefix into the namespace of the repository as "<prefix>-<namespace>",
+// e.g. "myns/repo" becomes "prod-myns/repo" with the prefix "prod". Only the first segment is the namespace
+// of SWR, the other segments of a multi-segment repository stay in the repository name, e.g. "myns/team/repo"
+// becomes "prod-myns/team/repo". A repository without the namespace is put under the prefix, e.g. "repo"
+// becomes "prod/repo". The prefix is lower cased and the characters not allowed in the namespaces are
+// replaced with "-".
+func applyDestinationPrefix(prefix, repository string) string {
+	prefix = strings.Trim(namespaceInvalidChars.ReplaceAllString(strings.ToLower(prefix), "-"), "-")
+	if len(prefix) == 0 {
+		return repository
+	}
+	namespace, rest, found := strings.Cut(repository, "/")
+	if !found {
+		return prefix + "/" + repository
+	}
+	return prefix + "-" + namespace + "/" + rest
+}
+
+// warnDroppedLabels logs the Harbor labels of the artifacts to be pushed, SWR has no counterpart of
+// the labels so they're dropped. The OCI annotations are part of the manifests which are pushed as
+// they are, so they're always preserved.
+func warnDroppedLabels(resources []*model.Resource) {
 	for _, resource := range resources {
-		var namespace string
-		paths := strings.Split(resource.Metadata.Repository.Name, "/")
-		if len(paths) > 0 {
-			namespace = paths[0]
+		if resource.Metadata == nil || resource.Metadata.Repository == nil {
+			continue
 		}
-		ns, err := a.GetNamespace(namespace)
-		if err != nil {
-			return err
+		for _, artifact := range resource.Metadata.Artifacts {
+			if len(artifact.Labels) == 0 {
+				continue
+			}
+			ref := artifact.Digest
+			if len(artifact.Tags) > 0 {
+				ref = strings.Join(artifact.Tags, ",")
+			}
+			log.Warningf("the labels [%s] of %s:%s are dropped as Huawei SWR can't store labels",
+				strings.Join(artifact.Labels, ", "), resource.Metadata.Repository.Name, ref)
+		}
+	}
+}
+
+// PushPlan describes what PrepareForPush would do for the resources
+type PushPlan struct {
+	// Namespaces are the namespaces to be created, sorted by name
+	Namespaces []string
+	// Existing are the namespaces existing already, sorted by name, which aren't checked
+	// with WithAlwaysCreateNamespaces
+	Existing []string
+	// Repositories are the repositories to be pushed, sorted by name
+	Repositories []string
+}
+
+// PlanPush returns the namespaces PrepareForPush would create and the repositories would be pushed
+// for the resources without changing anything on Huawei SWR, only the existence of the namespaces
+// is checked, so the operators can review the impact of a replication rule before running it. The
+// namespaces violating the naming rules of SWR fail it upfront, see ValidateNamespaceName
+func (a *adapter) PlanPush(resources []*model.Resource) (*PushPlan, error) {
+	plan := &PushPlan{}
+	namespaces, repositories := a.pushTargets(resources)
+	for _, namespace := range namespaces {
+		if err := ValidateNamespaceName(namespace); err != nil {
+			return nil, err
+		}
+	}
+	plan.Repositories = repositories
+	// the existence isn't trusted, the creation of all the namespaces is attempted
+	if a.opts.alwaysCreateNamespaces {
+		plan.Namespaces = namespaces
+		sort.Strings(plan.Namespaces)
+		sort.Strings(plan.Repositories)
+		return plan, nil
+	}
+
+	existing, err := a.GetNamespaces(namespaces)
+	if err != nil {
+		return nil, err
+	}
+	for _, namespace := range namespaces {
+		if existing[namespace] {
+			plan.Existing = append(plan.Existing, namespace)
+		} else {
+			plan.Namespaces = append(plan.Namespaces, namespace)
+		}
+	}
+	sort.Strings(plan.Namespaces)
+	sort.Strings(plan.Existing)
+	sort.Strings(plan.Repositories)
+	return plan, nil
+}
+
+// pushTargets returns the distinct namespaces and repositories of SWR the resources are pushed to, i.e.
+// prefixed by WithDestinationPrefix
+func (a *adapter) pushTargets(resources []*model.Resource) ([]string, []string) {
+	var namespaces, repositories []string
+	checked, listed := map[string]struct{}{}, map[string]struct{}{}
+	for _, resource := range resources {
+		name := a.destinationRepository(resource.Metadata.Repository.Name)
+		if _, ok := listed[name]; !ok {
+			listed[name] = struct{}{}
+			repositories = append(repositories, name)
 		}
-		if ns != nil && ns.Name == namespace {
+
+		namespace := a.namespaceOf(name)
+		if _, ok := checked[namespace]; ok {
 			continue
 		}
-		namespaces[namespace] = struct{}{}
+		checked[namespace] = struct{}{}
+		namespaces = append(namespaces, namespace)
 	}
+	return namespaces, repositories
+}
 
-	url := fmt.Sprintf("%s/dockyard/v2/namespaces", a.registry.URL)
+// namespaceOf returns the namespace of the repository, which is the first segment of the name, e.g.
+// "ns" of "ns/app", or the first two segments of the name scoped by an organization set by
+// WithOrganizations, e.g. "org/ns" of "org/ns/app". The name is only taken as organization-scoped
+// if there is a repository after the namespace, so "org/app" is still the repository "app" of "org"
+func (a *adapter) namespaceOf(repository string) string {
+	paths := strings.SplitN(repository, "/", 3)
+	if len(paths) == 3 {
+		if _, ok := a.opts.organizations[paths[0]]; ok {
+			return paths[0] + "/" + paths[1]
+		}
+	}
+	return paths[0]
+}
 
-	for namespace := range namespaces {
-		namespacebyte, err := json.Marshal(struct {
-			Namespace string `json:"namespace"`
-		}{
-			Namespace: namespace,
-		})
+// bulkNamespaceThreshold is the number of the namespaces above which GetNamespaces lists
+// all the namespaces in one request rather than getting them one by one
+const bulkNamespaceThreshold = 10
+
+// GetNamespaces reports which of the namespaces exist on Huawei SWR. The namespaces are checked
+// one by one for a small set, while all the namespaces are listed once for a large set or the set
+// containing the organization-scoped namespaces, see WithOrganizations. The listing
+// only contains the namespaces visible to the user unless WithAllNamespaces is set, the invisible
+// ones are reported as absent and then reported as existing by CreateNamespace with ErrNamespaceExists.
+func (a *adapter) GetNamespaces(names []string) (map[string]bool, error) {
+	existing := make(map[string]bool, len(names))
+	// the organization-scoped namespaces can't be got one by one, as the namespace API takes a single path segment
+	bulk := len(names) > bulkNamespaceThreshold
+	for _, name := range names {
+		bulk = bulk || strings.Contains(name, "/")
+	}
+	if bulk {
+		namespaces, err := a.ListNamespaces(nil)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		listed := make(map[string]struct{}, len(namespaces))
+		for _, ns := range namespaces {
+			listed[ns.Name] = struct{}{}
+		}
+		for _, name := range names {
+			_, existing[name] = listed[name]
 		}
+		return existing, nil
+	}
 
-		r, err := http.NewRequest("POST", url, strings.NewReader(string(namespacebyte)))
+	for _, name := range names {
+		ns, err := a.GetNamespace(name)
+		if errors.Is(err, ErrNamespaceNotFound) {
+			existing[name] = false
+			continue
+		}
 		if err != nil {
-			return err
+			return nil, err
 		}
+		// GetNamespace never returns nil, the response naming no namespace, e.g. "{}", isn't taken as the existence
+		existing[name] = ns != nil && ns.Name == name
+	}
+	return existing, nil
+}
 
-		r.Header.Add("content-type", "application/json; charset=utf-8")
+// PrepareForPush prepare for push to Huawei SWR, all the namespaces are attempted even if some fail,
+// the PrepareError returned then carries the result of every namespace, see PrepareNamespaces
+func (a *adapter) PrepareForPush(resources []*model.Resource) error {
+	_, err := a.PrepareNamespaces(resources)
+	return err
+}
 
-		resp, err := a.client.Do(r)
-		if err != nil {
+// PrepareResult summarizes what PrepareNamespaces did to the namespaces of the resources, the namespaces
+// are sorted by name
+type PrepareResult struct {
+	// Created are the namespaces created
+	Created []string
+	// Existed are the namespaces existing already, including the ones created concurrently by others
+	Existed []string
+	// Failed are the namespaces failed to be created along with the reasons
+	Failed []*NamespaceError
+}
+
+// NamespaceError is the failure of creating a namespace
+type NamespaceError struct {
+	Namespace string
+	Err       error
+}
+
+// Error ...
+func (e *NamespaceError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Namespace, e.Err)
+}
+
+// Unwrap ...
+func (e *NamespaceError) Unwrap() error {
+	return e.Err
+}
+
+// PrepareError is returned when some namespaces fail to be prepared, the result tells the state SWR
+// is left in, e.g. the namespaces to clean up
+type PrepareError struct {
+	Result *PrepareResult
+}
+
+// Error ...
+func (e *PrepareError) Error() string {
+	var created string
+	if len(e.Result.Created) > 0 {
+		created = fmt.Sprintf(" (namespaces created: %s)", strings.Join(e.Result.Created, ", "))
+	}
+	if len(e.Result.Failed) == 1 {
+		failed := e.Result.Failed[0]
+		return fmt.Sprintf("failed to create namespace %s%s: %v", failed.Namespace, created, failed.Err)
+	}
+	names := make([]string, 0, len(e.Result.Failed))
+	reasons := make([]string, 0, len(e.Result.Failed))
+	for _, failed := range e.Result.Failed {
+		names = append(names, failed.Namespace)
+		reasons = append(reasons, failed.Error())
+	}
+	return fmt.Sprintf("failed to create namespaces %s%s: %s", strings.Join(names, ", "), created, strings.Join(reasons, "; "))
+}
+
+// Unwrap makes the PrepareError match the errors of the namespaces, e.g. ErrServer
+func (e *PrepareError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Result.Failed))
+	for _, failed := range e.Result.Failed {
+		errs = append(errs, failed)
+	}
+	return errs
+}
+
+// PrepareNamespaces creates the namespaces of the resources like PrepareForPush and returns the result of
+// every namespace, the PrepareError is returned along with the result if any namespace fails
+func (a *adapter) PrepareNamespaces(resources []*model.Resource) (*PrepareResult, error) {
+	plan, err := a.PlanPush(resources)
+	if err != nil {
+		return nil, err
+	}
+	warnDroppedLabels(resources)
+
+	// the budget is per call, so the jobs sharing the cached adapter don't consume or reset each other's
+	budget := newRetryBudget(a.opts.retryBudget)
+	var outcomes []namespaceOutcome
+	if a.limiter != nil {
+		outcomes = a.prepareNamespacesConcurrently(plan.Namespaces, budget)
+	} else {
+		outcomes = make([]namespaceOutcome, len(plan.Namespaces))
+		for i, namespace := range plan.Namespaces {
+			outcomes[i].created, outcomes[i].err = a.prepareNamespace(namespace, budget)
+		}
+	}
+
+	result := &PrepareResult{Existed: append([]string{}, plan.Existing...)}
+	for i, namespace := range plan.Namespaces {
+		switch outcome := outcomes[i]; {
+		case outcome.err != nil:
+			result.Failed = append(result.Failed, &NamespaceError{Namespace: namespace, Err: outcome.err})
+		case outcome.created:
+			result.Created = append(result.Created, namespace)
+		default:
+			result.Existed = append(result.Existed, namespace)
+		}
+	}
+	sort.Strings(result.Existed)
+	if len(result.Failed) > 0 {
+		return result, &PrepareError{Result: result}
+	}
+	return result, nil
+}
+
+// namespaceOutcome is the outcome of preparing a namespace, see prepareNamespace
+type namespaceOutcome struct {
+	created bool
+	err     error
+}
+
+// prepareNamespacesConcurrently creates the namespaces concurrently under the adaptive limit,
+// the outcomes are in the order of the namespaces
+func (a *adapter) prepareNamespacesConcurrently(namespaces []string, budget *retryBudget) []namespaceOutcome {
+	var (
+		wg       sync.WaitGroup
+		outcomes = make([]namespaceOutcome, len(namespaces))
+	)
+	for i, namespace := range namespaces {
+		wg.Add(1)
+		go func(i int, namespace string) {
+			defer wg.Done()
+			release := a.limiter.acquire()
+			created, err := a.prepareNamespace(namespace, budget)
+			release(err)
+			outcomes[i] = namespaceOutcome{created: created, err: err}
+		}(i, namespace)
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// prepareNamespace creates the namespace, false is returned if it already exists
+func (a *adapter) prepareNamespace(namespace string, budget *retryBudget) (bool, error) {
+	err := a.createNamespaceWithRetry(namespace, budget)
+	// another replication job may create the same namespace concurrently
+	if errors.Is(err, ErrNamespaceExists) {
+		log.Debugf("namespace %s already exists", namespace)
+		a.reportProgress(ProgressEvent{Type: ProgressNamespaceExists, Namespace: namespace})
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	log.Debugf("namespace %s created", namespace)
+	if a.opts.immutableTags {
+		log.Warningf("the tag immutability isn't supported by Huawei SWR, namespace %s is created without it", namespace)
+	}
+	a.reportProgress(ProgressEvent{Type: ProgressNamespaceCreated, Namespace: namespace})
+	return true, nil
+}
+
+// createNamespaceWithRetry creates the namespace and retries with the exponential backoff
+// on the transient errors, see WithNamespaceCreateRetry, WithRetryLimits and WithRetryBudget, the
+// retries are taken from the budget of the job. The 429 responses are retried after the "Retry-After"
+// SWR sets instead, capped at the max backoff
+func (a *adapter) createNamespaceWithRetry(namespace string, budget *retryBudget) error {
+	backoff := min(a.opts.namespaceCreateBackoff, a.opts.retryMaxBackoff)
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := a.CreateNamespace(namespace, a.opts.namespaceAuth)
+		if err == nil || !isTransient(err) || attempt >= a.opts.namespaceCreateAttempts {
 			return err
 		}
-		defer resp.Body.Close()
-		code := resp.StatusCode
-		if code >= 300 || code < 200 {
-			body, _ := io.ReadAll(resp.Body)
-			return fmt.Errorf("[%d][%s]", code, string(body))
+		wait := backoff
+		if d, ok := retryAfter(err); ok {
+			wait = min(d, a.opts.retryMaxBackoff)
+		}
+		if elapsed := time.Since(start); elapsed+wait > a.opts.retryMaxElapsed {
+			return fmt.Errorf("gave up retrying after %v (attempt %d/%d): %w",
+				elapsed.Round(time.Millisecond), attempt, a.opts.namespaceCreateAttempts, err)
 		}
+		if !budget.take() {
+			return fmt.Errorf("%w: %d retries used by the job: %w", ErrRetryBudgetExhausted, budget.limit, err)
+		}
+		log.Warningf("failed to create namespace %s (attempt %d/%d), retry after %v: %v",
+			namespace, attempt, a.opts.namespaceCreateAttempts, wait, err)
+		time.Sleep(wait)
+		backoff = min(backoff*2, a.opts.retryMaxBackoff)
+	}
+}
+
+// CreateNamespace creates a namespace on Huawei SWR with the provided access level bounded by the push
+// timeout, see WithOperationTimeouts. ErrNamespaceExists is returned if the namespace already exists
+func (a *adapter) CreateNamespace(namespace string, auth NamespaceAuth) error {
+	namespacebyte, err := a.namespaceCreateBody(namespace, auth)
+	if err != nil {
+		return err
+	}
 
-		log.Debugf("namespace %s created", namespace)
+	r, err := http.NewRequest(http.MethodPost, a.apiURL("namespaces"), strings.NewReader(string(namespacebyte)))
+	if err != nil {
+		return err
+	}
+
+	r.Header.Add("content-type", "application/json; charset=utf-8")
+
+	start := time.Now()
+	resp, err := a.doWithTimeout(r, a.opts.pushTimeout)
+	logResponse(a.logger("CreateNamespace", log.Fields{"namespace": namespace}), r, resp, err, start)
+	if err != nil {
+		return classifyTransportError(err)
+	}
+	defer resp.Body.Close()
+	code := resp.StatusCode
+	if code == http.StatusConflict {
+		return ErrNamespaceExists
+	}
+	if code >= 300 || code < 200 {
+		return classifyStatusError(a.newError(resp))
+	}
+	if code == http.StatusAccepted {
+		return a.waitNamespaceReady(namespace, resp.Header.Get("Location"))
 	}
 	return nil
 }
 
-// GetNamespace gets a namespace from Huawei SWR
+// namespaceCreateBody encodes the body of the namespace creation, see WithNamespaceCreateBody and
+// WithNamespaceCreateFields
+func (a *adapter) namespaceCreateBody(namespace string, auth NamespaceAuth) ([]byte, error) {
+	if a.opts.namespaceCreateBody == nil && len(a.opts.namespaceCreateFields) == 0 {
+		return json.Marshal(struct {
+			Namespace   string        `json:"namespace"`
+			Auth        NamespaceAuth `json:"auth"`
+			Description string        `json:"description,omitempty"`
+		}{
+			Namespace:   namespace,
+			Auth:        auth,
+			Description: a.opts.namespaceDescription,
+		})
+	}
+	body := map[string]interface{}{"namespace": namespace, "auth": auth}
+	if a.opts.namespaceCreateBody != nil {
+		body = a.opts.namespaceCreateBody(namespace, auth)
+		if body == nil {
+			body = map[string]interface{}{}
+		}
+	}
+	for k, v := range a.opts.namespaceCreateFields {
+		if _, ok := body[k]; !ok {
+			body[k] = v
+		}
+	}
+	if _, ok := body[MetadataNamespaceDescription]; !ok && len(a.opts.namespaceDescription) > 0 {
+		body[MetadataNamespaceDescription] = a.opts.namespaceDescription
+	}
+	return json.Marshal(body)
+}
+
+// GetNamespace gets a namespace from Huawei SWR, ErrNamespaceNotFound is returned if it doesn't exist
 func (a *adapter) GetNamespace(namespaceStr string) (*model.Namespace, error) {
 	var namespace = &model.Namespace{
 		Name:     "",
 		Metadata: make(map[string]interface{}),
 	}
 
-	urls := fmt.Sprintf("%s/dockyard/v2/namespaces/%s", a.registry.URL, namespaceStr)
+	urls := a.apiURL("namespaces", pathSegment(namespaceStr))
 	r, err := http.NewRequest("GET", urls, nil)
 	if err != nil {
 		return namespace, err
@@ -223,22 +995,33 @@ func (a *adapter) GetNamespace(namespaceStr string) (*model.Namespace, error) {
 
 	r.Header.Add("content-type", "application/json; charset=utf-8")
 
-	resp, err := a.client.Do(r)
+	start := time.Now()
+	resp, err := a.doWithTimeout(r, a.opts.getTimeout)
+	logResponse(a.logger("GetNamespace", log.Fields{"namespace": namespaceStr}), r, resp, err, start)
 	if err != nil {
 		return namespace, err
 	}
 
 	defer resp.Body.Close()
 	code := resp.StatusCode
+	if code == http.StatusNotFound {
+		return namespace, fmt.Errorf("%w: %s: %w", ErrNamespaceNotFound, namespaceStr, a.newError(resp))
+	}
 	if code >= 300 || code < 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return namespace, fmt.Errorf("[%d][%s]", code, string(body))
+		return namespace, a.newError(resp)
 	}
-	body, err := io.ReadAll(resp.Body)
+	body, err := a.readBody(resp)
 	if err != nil {
 		return namespace, err
 	}
 
+	// SWR responds 200 with an empty body for some namespaces, the namespace
+	// exists but its detail, e.g. the ID, is only known from the listing, see ResolveNamespaceIDs
+	if isEmptyBody(body) {
+		namespace.Name = namespaceStr
+		return namespace, nil
+	}
+
 	var namespaceData hwNamespace
 	err = json.Unmarshal(body, &namespaceData)
 	if err != nil {
@@ -247,41 +1030,359 @@ func (a *adapter) GetNamespace(namespaceStr string) (*model.Namespace, error) {
 
 	namespace.Name = namespaceData.Name
 	namespace.Metadata = namespaceData.metadata()
+	// the ID is omitted by some deployments when getting the namespace
+	if namespaceData.ID == 0 {
+		delete(namespace.Metadata, MetadataNamespaceID)
+	}
 
 	return namespace, nil
 }
 
-// HealthCheck check health for huawei SWR
+// GetNamespaceByID gets the namespace by the numeric ID of SWR, see NamespaceID. SWR only addresses the
+// namespaces by name, so the ID is matched in the listing, which only contains the namespaces visible to
+// the user unless WithAllNamespaces is set. ErrNamespaceNotFound is returned if no namespace has the ID
+func (a *adapter) GetNamespaceByID(id int64) (*model.Namespace, error) {
+	namespaces, err := a.ListNamespaces(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, namespace := range namespaces {
+		if nsID, ok := NamespaceID(namespace); ok && nsID == id {
+			return namespace, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %w: id %d", ErrNamespaceNotFound, ErrNotFound, id)
+}
+
+// ResolveNamespaceIDs fills the IDs the namespaces got by GetNamespace miss, e.g. on the deployments
+// omitting the ID or responding the empty body, along with the other detail of them from the listing.
+// All the namespaces are resolved by one listing, which is skipped if none misses the ID. The namespaces
+// not listed are left without the ID
+func (a *adapter) ResolveNamespaceIDs(namespaces ...*model.Namespace) error {
+	var unresolved []*model.Namespace
+	for _, namespace := range namespaces {
+		if _, ok := NamespaceID(namespace); !ok && namespace != nil {
+			unresolved = append(unresolved, namespace)
+		}
+	}
+	if len(unresolved) == 0 {
+		return nil
+	}
+	listed, err := a.ListNamespaces(nil)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*model.Namespace, len(listed))
+	for _, namespace := range listed {
+		byName[namespace.Name] = namespace
+	}
+	for _, namespace := range unresolved {
+		l, ok := byName[namespace.Name]
+		if !ok {
+			continue
+		}
+		if namespace.Metadata == nil {
+			namespace.Metadata = map[string]interface{}{}
+		}
+		for k, v := range l.Metadata {
+			if _, ok := namespace.Metadata[k]; !ok || k == MetadataNamespaceID {
+				namespace.Metadata[k] = v
+			}
+		}
+	}
+	return nil
+}
+
+// MetadataNamespaceID is the key of the numeric ID of SWR in the metadata of the namespaces returned
+// by ListNamespaces and GetNamespace, see NamespaceID
+const MetadataNamespaceID = "id"
+
+// MetadataNamespaceDescription is the key of the description in the metadata of the namespaces returned by
+// ListNamespaces and GetNamespace, absent if the namespace has none, see WithNamespaceDescription
+const MetadataNamespaceDescription = "description"
+
+// NamespaceID returns the numeric ID of the namespace returned by ListNamespaces or GetNamespace, false
+// is returned if the ID isn't known, e.g. for the namespaces set by WithFallbackNamespaces or got from
+// the deployments omitting it, which ResolveNamespaceIDs fills in
+func NamespaceID(namespace *model.Namespace) (int64, bool) {
+	if namespace == nil {
+		return 0, false
+	}
+	id, ok := namespace.Metadata[MetadataNamespaceID].(int64)
+	return id, ok && id > 0
+}
+
+// PingRegistry validates both the connectivity and the credential of Huawei SWR.
+// Unlike HealthCheck it's used interactively when setting up the registry, so the
+// returned error wraps ErrUnreachable or ErrUnauthorized to tell the URL and the
+// credential problems apart.
+func (a *adapter) PingRegistry() error {
+	urls := a.apiURL("visible", "namespaces")
+	r, err := http.NewRequest(http.MethodGet, urls, nil)
+	if err != nil {
+		return err
+	}
+
+	r.Header.Add("content-type", "application/json; charset=utf-8")
+
+	start := time.Now()
+	resp, err := a.client.Do(r)
+	logResponse(a.logger("PingRegistry", nil), r, resp, err, start)
+	if err != nil {
+		return classifyTransportError(err)
+	}
+
+	defer resp.Body.Close()
+	code := resp.StatusCode
+	if code >= 300 || code < 200 {
+		return classifyStatusError(a.newError(resp))
+	}
+	return nil
+}
+
+// HealthCheck check health for huawei SWR, the returned error classifies
+// the failure when the registry is unhealthy. The result is reused until
+// it expires, see WithHealthCheckTTL
 func (a *adapter) HealthCheck() (string, error) {
+	if status, ok, err := a.health.get(); ok {
+		return status, err
+	}
+	if err := a.PingRegistry(); err != nil {
+		log.Errorf("failed to ping huawei SWR %s: %v", a.registry.URL, err)
+		a.health.set(model.Unhealthy, err, a.opts.unhealthyTTL)
+		return model.Unhealthy, err
+	}
+	a.health.set(model.Healthy, nil, a.opts.healthyTTL)
 	return model.Healthy, nil
 }
 
-func newAdapter(registry *model.Registry) (adp.Adapter, error) {
-	var (
-		modifiers  = []modifier.Modifier{}
-		authorizer modifier.Modifier
-	)
-	if registry.Credential != nil {
-		authorizer = basic.NewAuthorizer(
-			registry.Credential.AccessKey,
-			registry.Credential.AccessSecret)
-		modifiers = append(modifiers, authorizer)
+func newAdapter(registry *model.Registry, opts ...Option) (adp.Adapter, error) {
+	o := newOptions(opts...)
+	switch len(o.regions) {
+	case 0:
+	case 1:
+		o.region = o.regions[0]
+	default:
+		return newMultiRegionAdapter(registry, o.regions, opts)
 	}
-
-	transport := common_http.GetHTTPTransport(common_http.WithInsecure(registry.Insecure))
-	return &adapter{
-		Adapter:  native.NewAdapter(registry),
+	var modifiers []modifier.Modifier
+	if o.credentialProvider != nil {
+		modifiers = append(modifiers, &providerAuthorizer{provider: o.credentialProvider})
+	} else {
+		// SWR doesn't support the anonymous access, fail early rather than
+		// returning the opaque 401 during the replications
+		if registry.Credential == nil || len(registry.Credential.AccessKey) == 0 ||
+			len(registry.Credential.AccessSecret) == 0 {
+			return nil, ErrNoCredential
+		}
+		modifiers = append(modifiers, basic.NewAuthorizer(registry.Credential.AccessKey, registry.Credential.AccessSecret))
+	}
+	var registryModifiers []modifier.Modifier
+	if len(o.enterpriseProjectID) > 0 {
+		registryModifiers = append(registryModifiers, &headerModifier{key: enterpriseProjectHeader, value: o.enterpriseProjectID})
+	}
+	if len(o.acceptLanguage) > 0 {
+		registryModifiers = append(registryModifiers, &headerModifier{key: "Accept-Language", value: o.acceptLanguage})
+	}
+	// sort the static headers to apply them in a stable order
+	headerKeys := make([]string, 0, len(o.headers))
+	for key := range o.headers {
+		headerKeys = append(headerKeys, key)
+	}
+	sort.Strings(headerKeys)
+	for _, key := range headerKeys {
+		registryModifiers = append(registryModifiers, &headerModifier{key: key, value: o.headers[key]})
+	}
+	if o.requestID != nil {
+		registryModifiers = append(registryModifiers, &requestIDModifier{generate: o.requestID})
+	}
+	modifiers = append(registryModifiers, modifiers...)
+	apiModifiers := modifiers
+	if len(o.ak) > 0 && len(o.sk) > 0 {
+		// the header is set before signing
+		apiModifiers = append(append([]modifier.Modifier{}, registryModifiers...), newSigner(o.ak, o.sk))
+	}
+	if len(o.region) > 0 {
+		u, err := regionURL(o.region)
+		if err != nil {
+			return nil, err
+		}
+		// don't change the registry passed in
+		r := *registry
+		r.URL = u
+		registry = &r
+	}
+	var tagConstraint *semver.Constraints
+	if len(o.tagConstraint) > 0 {
+		c, err := semver.NewConstraint(o.tagConstraint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid semver tag constraint %s: %w", o.tagConstraint, err)
+		}
+		tagConstraint = c
+	}
+	for _, pattern := range o.deletionScope {
+		if _, err := util.Match(pattern, pattern); err != nil {
+			return nil, fmt.Errorf("invalid deletion scope pattern %s: %w", pattern, err)
+		}
+	}
+	for _, pattern := range o.mediaTypes {
+		// the pattern is only parsed as far as the name matches, so it's matched against itself
+		if _, err := util.Match(pattern, pattern); err != nil {
+			return nil, fmt.Errorf("invalid media type pattern %s: %w", pattern, err)
+		}
+	}
+	apiInsecure, authInsecure := registry.Insecure, registry.Insecure
+	if o.apiInsecure != nil {
+		apiInsecure = *o.apiInsecure
+	}
+	if o.authInsecure != nil {
+		authInsecure = *o.authInsecure
+	}
+	transport, err := newTransport(apiInsecure, o)
+	if err != nil {
+		return nil, err
+	}
+	authTransport := transport
+	if authInsecure != apiInsecure {
+		authTransport, err = newTransport(authInsecure, o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var breakerID string
+	if o.breakerThreshold > 0 {
+		breakerID = breakerKey(registry.URL, o.breakerThreshold, o.breakerCooldown)
+		breaker := breakerFor(registry.URL, o.breakerThreshold, o.breakerCooldown)
+		transport = &breakerTransport{next: transport, breaker: breaker}
+		authTransport = &breakerTransport{next: authTransport, breaker: breaker}
+	}
+	var limiter *adaptiveLimiter
+	if o.maxConcurrency > 0 {
+		limiter = newAdaptiveLimiter(o.minConcurrency, o.maxConcurrency)
+	}
+	// the blobs and the manifests are transferred by the native registry client, which shares the
+	// transport of the adapter and applies the modifiers of the registry API, as does its auth
+	registryTransport := &nativeTransport{next: transport, modifiers: registryModifiers}
+	if o.pushTimeout > 0 {
+		registryTransport.next = &pushTimeoutTransport{next: transport, timeout: o.pushTimeout}
+	}
+	var authorizer lib.Authorizer
+	if o.credentialProvider != nil {
+		authorizer = &rotatingAuthorizer{
+			provider:  o.credentialProvider,
+			transport: registryTransport,
+		}
+	} else {
+		authorizer = auth.NewAuthorizerWithTransport(registry.Credential.AccessKey, registry.Credential.AccessSecret, registryTransport)
+	}
+	nativeAdapter := native.NewAdapterWithTransport(registry, authorizer, registryTransport)
+	a := &adapter{
+		Adapter:  nativeAdapter,
 		registry: registry,
 		client: common_http.NewClient(
 			&http.Client{
 				Transport: transport,
+				Timeout:   o.timeout,
 			},
-			modifiers...,
+			apiModifiers...,
 		),
 		oriClient: &http.Client{
 			Transport: transport,
+			Timeout:   o.timeout,
 		},
-	}, nil
+		authClient: common_http.NewClient(
+			&http.Client{
+				Transport: authTransport,
+				Timeout:   o.timeout,
+			},
+			modifiers...,
+		),
+		untimedClient:     newUntimedClient(transport, o, apiModifiers...),
+		opts:              o,
+		tokens:            newTokenCache(),
+		stats:             &pushStats{},
+		health:            &healthCache{},
+		version:           &versionProbe{},
+		registryModifiers: registryModifiers,
+		tagConstraint:     tagConstraint,
+		limiter:           limiter,
+		blobUploads:       newBlobUploadLimiter(o.maxBlobUploads),
+		uploads:           &uploadSessions{ttl: o.uploadSessionTTL},
+		apiBaseURL:        joinURLPath(registry.URL, o.basePath),
+		breakerKey:        breakerID,
+	}
+	registryTransport.logger = func() *log.Logger { return a.logger("RegistryAPI", nil) }
+	return a, nil
+}
+
+// NamespaceAuth is the access level, i.e. the visibility, of the namespace on Huawei SWR, the
+// permission of the user on the namespace is reported separately, see namespacePermission
+type NamespaceAuth int
+
+// const definition
+const (
+	// NamespaceAuthPrivate indicates the namespace is only accessible for the authorized users
+	NamespaceAuthPrivate NamespaceAuth = 0
+	// NamespaceAuthPublic indicates the namespace is accessible for everyone
+	NamespaceAuthPublic NamespaceAuth = 1
+)
+
+// String returns the readable description of the access level
+func (n NamespaceAuth) String() string {
+	switch n {
+	case NamespaceAuthPrivate:
+		return "private"
+	case NamespaceAuthPublic:
+		return "public"
+	default:
+		return "unknown"
+	}
+}
+
+// Close releases the idle connections of the adapter, clears the cached tokens and releases the
+// circuit breaker, it's called when the cached adapter is replaced or evicted, see adapterCache. The
+// adapter can still be used after closing, the connections and tokens are just established again.
+func (a *adapter) Close() error {
+	a.client.GetClient().CloseIdleConnections()
+	a.oriClient.CloseIdleConnections()
+	a.authClient.GetClient().CloseIdleConnections()
+	if a.untimedClient != nil {
+		a.untimedClient.GetClient().CloseIdleConnections()
+	}
+	a.tokens.clear()
+	if len(a.breakerKey) > 0 && a.breakerReleased.CompareAndSwap(false, true) {
+		releaseBreaker(a.breakerKey)
+	}
+	return nil
+}
+
+// regionPattern matches the names of the regions, e.g. "cn-north-4" and "eu-de"
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z0-9]+)+$`)
+
+// otcRegions are the regions served by Open Telekom Cloud, which are under a different domain
+var otcRegions = map[string]struct{}{
+	"eu-de": {},
+	"eu-nl": {},
+}
+
+// regionURL returns the URL of the SWR endpoint of the region
+func regionURL(region string) (string, error) {
+	if !regionPattern.MatchString(region) {
+		return "", fmt.Errorf("invalid region: %s", region)
+	}
+	if _, ok := otcRegions[region]; ok {
+		return fmt.Sprintf("https://swr.%s.otc.t-systems.com", region), nil
+	}
+	return fmt.Sprintf("https://swr.%s.myhuaweicloud.com", region), nil
+}
+
+// joinURLPath joins the base URL and the path without introducing the duplicated slashes
+func joinURLPath(base, p string) string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return strings.TrimRight(base, "/")
+	}
+	return strings.TrimRight(base, "/") + p
 }
 
 type hwNamespaceList struct {
@@ -289,25 +1390,181 @@ type hwNamespaceList struct {
 }
 
 type hwNamespace struct {
-	ID           int64  `json:"id" orm:"column(id)"`
-	Name         string `json:"name"`
-	CreatorName  string `json:"creator_name,omitempty"`
-	DomainPublic int    `json:"-"`
-	Auth         int    `json:"auth"`
-	DomainName   string `json:"-"`
-	UserCount    int64  `json:"user_count"`
-	ImageCount   int64  `json:"image_count"`
+	ID           namespaceID   `json:"id" orm:"column(id)"`
+	Name         string        `json:"name"`
+	CreatorName  string        `json:"creator_name,omitempty"`
+	DomainPublic domainPublic  `json:"domain_public"`
+	Auth         NamespaceAuth `json:"auth"`
+	DomainName   string        `json:"domain_name,omitempty"`
+	UserCount    int64         `json:"user_count"`
+	ImageCount   int64         `json:"image_count"`
+	Description  string        `json:"description,omitempty"`
+	// SelfAuth is the permission of the user, which is only reported by some listings,
+	// nil means it's unknown until the permissions of the namespace are got
+	SelfAuth *hwAccess `json:"self_auth,omitempty"`
+	// Quota and Used are only reported by some SWR deployments,
+	// nil means the field is absent in the response
+	Quota *int64 `json:"quota,omitempty"`
+	Used  *int64 `json:"used,omitempty"`
+}
+
+// namespacePermission is the permission of a user on the namespace, i.e. 1 for read, 3 for write and
+// 7 for manage, which SWR reports as the "auth" of the user in the permissions of the namespace
+type namespacePermission int
+
+// const definition
+const (
+	namespacePermissionRead   namespacePermission = 1
+	namespacePermissionWrite  namespacePermission = 3
+	namespacePermissionManage namespacePermission = 7
+)
+
+// String returns the readable description of the permission
+func (p namespacePermission) String() string {
+	switch p {
+	case namespacePermissionRead:
+		return "read"
+	case namespacePermissionWrite:
+		return "write"
+	case namespacePermissionManage:
+		return "manage"
+	default:
+		return "unknown"
+	}
+}
+
+// writable reports whether the permission allows pushing, i.e. it's write or manage
+func (p namespacePermission) writable() bool {
+	return p == namespacePermissionWrite || p == namespacePermissionManage
+}
+
+// hwAccess is the permission of a user on the namespace
+type hwAccess struct {
+	UserID   string              `json:"user_id,omitempty"`
+	UserName string              `json:"user_name,omitempty"`
+	Auth     namespacePermission `json:"auth"`
+}
+
+// hwNamespaceAccess is the permissions of the namespace, "self_auth" is the one of the current user
+type hwNamespaceAccess struct {
+	ID       namespaceID `json:"id"`
+	Name     string      `json:"name"`
+	SelfAuth *hwAccess   `json:"self_auth"`
+}
+
+// namespaceWritable reports whether the user can push to the namespace, the permissions of the
+// namespace are got if the listing doesn't report the permission of the user. The namespace is
+// considered writable if the permission can't be got, so the pushes report the real error
+func (a *adapter) namespaceWritable(ns *hwNamespace) bool {
+	if ns.SelfAuth == nil {
+		access, err := a.getNamespaceAccess(ns.Name)
+		if err != nil {
+			log.Warningf("failed to get the permission on the namespace %s of Huawei SWR %s, it's considered writable: %v",
+				ns.Name, a.registry.URL, err)
+			return true
+		}
+		ns.SelfAuth = access
+	}
+	return ns.SelfAuth.Auth.writable()
+}
+
+// getNamespaceAccess gets the permission of the user on the namespace
+func (a *adapter) getNamespaceAccess(namespace string) (*hwAccess, error) {
+	r, err := http.NewRequest(http.MethodGet, a.apiURL("namespaces", pathSegment(namespace), "access"), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Add("content-type", "application/json; charset=utf-8")
+
+	start := time.Now()
+	resp, err := a.doWithTimeout(r, a.opts.getTimeout)
+	logResponse(a.logger("GetNamespaceAccess", log.Fields{"namespace": namespace}), r, resp, err, start)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if code := resp.StatusCode; code >= 300 || code < 200 {
+		return nil, a.newError(resp)
+	}
+	var access hwNamespaceAccess
+	if err = a.decodeBody(resp, &access); err != nil {
+		return nil, err
+	}
+	if access.SelfAuth == nil {
+		return nil, fmt.Errorf("no permission of the user is reported for the namespace %s", namespace)
+	}
+	return access.SelfAuth, nil
+}
+
+// namespaceID is the numeric ID of the namespace, some SWR deployments report it as a string, which
+// is accepted as well
+type namespaceID int64
+
+// UnmarshalJSON decodes both the number and the string forms
+func (id *namespaceID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid namespace id %s: %w", data, err)
+		}
+		*id = namespaceID(v)
+		return nil
+	}
+	var v int64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid namespace id %s: %w", data, err)
+	}
+	*id = namespaceID(v)
+	return nil
+}
+
+// domainPublic is 1 if the namespace is public and 0 otherwise, some SWR deployments report it as
+// a boolean, which is accepted as well
+type domainPublic int
+
+// UnmarshalJSON decodes both the number and the boolean forms
+func (d *domainPublic) UnmarshalJSON(data []byte) error {
+	var public bool
+	if err := json.Unmarshal(data, &public); err == nil {
+		*d = 0
+		if public {
+			*d = 1
+		}
+		return nil
+	}
+	var v int
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid domain_public %s: %w", data, err)
+	}
+	*d = domainPublic(v)
+	return nil
 }
 
 func (ns hwNamespace) metadata() map[string]interface{} {
 	var metadata = make(map[string]interface{})
-	metadata["id"] = ns.ID
+	metadata[MetadataNamespaceID] = int64(ns.ID)
 	metadata["creator_name"] = ns.CreatorName
-	metadata["domain_public"] = ns.DomainPublic
-	metadata["auth"] = ns.Auth
+	metadata["domain_public"] = int(ns.DomainPublic)
+	metadata["public"] = ns.DomainPublic == 1
+	metadata["auth"] = int(ns.Auth)
+	metadata["auth_description"] = ns.Auth.String()
+	if ns.SelfAuth != nil {
+		metadata["permission"] = int(ns.SelfAuth.Auth)
+		metadata["permission_description"] = ns.SelfAuth.Auth.String()
+	}
 	metadata["domain_name"] = ns.DomainName
 	metadata["user_count"] = ns.UserCount
 	metadata["image_count"] = ns.ImageCount
+	if ns.Quota != nil {
+		metadata["quota"] = *ns.Quota
+	}
+	if ns.Used != nil {
+		metadata["used"] = *ns.Used
+	}
+	if len(ns.Description) > 0 {
+		metadata[MetadataNamespaceDescription] = ns.Description
+	}
 
 	return metadata
 }
@@ -15,15 +15,24 @@
 package huawei
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	gock "gopkg.in/h2non/gock.v1"
 
+	common_http "github.com/goharbor/harbor/src/common/http"
 	"github.com/goharbor/harbor/src/pkg/reg/model"
 )
 
-func getMockAdapter(t *testing.T) *adapter {
+func getMockAdapter(t *testing.T, opts ...Option) *adapter {
 	hwRegistry := &model.Registry{
 		ID:          1,
 		Name:        "Huawei",
@@ -35,7 +44,7 @@ func getMockAdapter(t *testing.T) *adapter {
 		Status:      "",
 	}
 
-	hwAdapter, err := newAdapter(hwRegistry)
+	hwAdapter, err := newAdapter(hwRegistry, opts...)
 	if err != nil {
 		t.Fatalf("Failed to call newAdapter(), reason=[%v]", err)
 	}
@@ -43,6 +52,10 @@ func getMockAdapter(t *testing.T) *adapter {
 	a := hwAdapter.(*adapter)
 	gock.InterceptClient(a.client.GetClient())
 	gock.InterceptClient(a.oriClient)
+	gock.InterceptClient(a.authClient.GetClient())
+	if a.untimedClient != nil {
+		gock.InterceptClient(a.untimedClient.GetClient())
+	}
 
 	return a
 }
@@ -55,6 +68,118 @@ func TestAdapter_Info(t *testing.T) {
 		t.Error(err)
 	}
 	t.Log(info)
+	assert.ElementsMatch(t, []string{model.ResourceTypeImage, model.ResourceTypeArtifact}, info.SupportedResourceTypes)
+	assert.Equal(t, safeConcurrency, info.SafeConcurrency)
+	assert.Equal(t, float64(advisoryRateLimit), info.AdvisoryRateLimit)
+}
+
+func TestAdapter_Capabilities(t *testing.T) {
+	a := getMockAdapter(t)
+	assert.Equal(t, Capabilities{
+		ImageReplication:    true,
+		ArtifactReplication: true,
+		ListNamespaces:      true,
+		CreateNamespace:     true,
+		ListTags:            true,
+		DeleteManifest:      true,
+		ScheduledTrigger:    true,
+		EventBasedTrigger:   true,
+	}, a.Capabilities())
+
+	// the tag deletion falls to the native adapter, which doesn't support it
+	assert.Error(t, a.DeleteTag("ns/app", "v1"))
+}
+
+func TestAdapter_PrepareForPushArtifact(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/wasm").
+		Reply(200).BodyString(`{"id":1,"name":"wasm"}`)
+
+	a := getMockAdapter(t)
+	resource := &model.Resource{
+		Type: model.ResourceTypeArtifact,
+		Metadata: &model.ResourceMetadata{
+			Repository: &model.Repository{
+				Name: "wasm/module",
+			},
+		},
+	}
+	assert.NoError(t, a.PrepareForPush([]*model.Resource{resource}))
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_ConvertResourceMetadata(t *testing.T) {
+	a := getMockAdapter(t)
+	metadata := &model.ResourceMetadata{
+		Repository: &model.Repository{Name: "ns/app"},
+		Artifacts: []*model.Artifact{
+			{Digest: "sha256:aaa", Tags: []string{"v1"}, Labels: []string{"release"}},
+		},
+		Vtags: []string{"v1"},
+	}
+	converted, err := a.ConvertResourceMetadata(metadata, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, metadata, converted)
+}
+
+func TestApplyDestinationPrefix(t *testing.T) {
+	cases := []struct {
+		prefix     string
+		repository string
+		expected   string
+	}{
+		{"prod", "myns/repo", "prod-myns/repo"},
+		{"prod", "myns/team/repo", "prod-myns/team/repo"},
+		{"prod", "repo", "prod/repo"},
+		{"Harbor Prod!", "myns/repo", "harbor-prod-myns/repo"},
+		{"!!", "myns/repo", "myns/repo"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, applyDestinationPrefix(c.prefix, c.repository))
+	}
+}
+
+func TestAdapter_ConvertResourceMetadataWithPrefix(t *testing.T) {
+	a := getMockAdapter(t, WithDestinationPrefix("prod"))
+	metadata := &model.ResourceMetadata{
+		Repository: &model.Repository{Name: "myns/repo"},
+		Vtags:      []string{"v1"},
+	}
+	converted, err := a.ConvertResourceMetadata(metadata, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "prod-myns/repo", converted.Repository.Name)
+	// the source metadata is kept untouched
+	assert.Equal(t, "myns/repo", metadata.Repository.Name)
+}
+
+func TestAdapter_PushWithPrefix(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/prod-myns").
+		Times(2).Reply(404)
+	mockRequest().Post("/dockyard/v2/namespaces").
+		BodyString(`{"namespace":"prod-myns","auth":0,"description":"Managed by Harbor replication"}`).
+		Reply(201)
+	mockGetJwtToken("prod-myns/repo")
+	mockRequest().Get("/v2/prod-myns/repo/manifests/v1").
+		Reply(404)
+
+	a := getMockAdapter(t, WithDestinationPrefix("prod"))
+	resources := []*model.Resource{
+		{Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: "myns/repo"}}},
+	}
+	plan, err := a.PlanPush(resources)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prod-myns"}, plan.Namespaces)
+	require.NoError(t, a.PrepareForPush(resources))
+
+	exist, _, err := a.ManifestExist("myns/repo", "v1")
+	assert.NoError(t, err)
+	assert.False(t, exist)
+	assert.True(t, gock.IsDone())
 }
 
 func TestAdapter_PrepareForPush(t *testing.T) {
@@ -64,7 +189,7 @@ func TestAdapter_PrepareForPush(t *testing.T) {
 	mockRequest().Get("/dockyard/v2/namespaces/domain_repo_new").
 		Reply(200).BodyString("{}")
 
-	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"domain_repo_new"}`).
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"domain_repo_new","auth":0,"description":"Managed by Harbor replication"}`).
 		Reply(200)
 
 	a := getMockAdapter(t)
@@ -82,15 +207,1107 @@ func TestAdapter_PrepareForPush(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func TestAdapter_HealthCheck(t *testing.T) {
+func TestAdapter_PrepareForPushConflict(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/domain_repo_new").
+		Reply(200).BodyString("{}")
+
+	// the namespace is created by another job in the meantime
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"domain_repo_new","auth":0,"description":"Managed by Harbor replication"}`).
+		Reply(409).BodyString(`{"errors":"namespace already exists"}`)
+
+	a := getMockAdapter(t)
+
+	resource := &model.Resource{
+		Metadata: &model.ResourceMetadata{
+			Repository: &model.Repository{
+				Name: "domain_repo_new/hello-world",
+			},
+		},
+	}
+	err := a.PrepareForPush([]*model.Resource{resource})
+	assert.NoError(t, err)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_CreateNamespace(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"public_ns","auth":1,"description":"Managed by Harbor replication"}`).
+		Reply(201)
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"existing_ns","auth":0,"description":"Managed by Harbor replication"}`).
+		Reply(409)
+
+	a := getMockAdapter(t)
+	assert.NoError(t, a.CreateNamespace("public_ns", NamespaceAuthPublic))
+	assert.ErrorIs(t, a.CreateNamespace("existing_ns", NamespaceAuthPrivate), ErrNamespaceExists)
+}
+
+func TestAdapter_PrepareForPushWithNamespaceAuth(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/public_ns").
+		Reply(200).BodyString("{}")
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"public_ns","auth":1,"description":"Managed by Harbor replication"}`).
+		Reply(201)
+
+	a := getMockAdapter(t, WithNamespaceAuth(NamespaceAuthPublic))
+	resource := &model.Resource{
+		Metadata: &model.ResourceMetadata{
+			Repository: &model.Repository{
+				Name: "public_ns/hello-world",
+			},
+		},
+	}
+	assert.NoError(t, a.PrepareForPush([]*model.Resource{resource}))
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_PrepareForPushRetry(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/flaky_ns").
+		Reply(200).BodyString("{}")
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"flaky_ns","auth":0,"description":"Managed by Harbor replication"}`).
+		Times(2).Reply(503).BodyString("service unavailable")
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"flaky_ns","auth":0,"description":"Managed by Harbor replication"}`).
+		Reply(201)
+
+	a := getMockAdapter(t, WithNamespaceCreateRetry(3, time.Millisecond))
+	resource := &model.Resource{
+		Metadata: &model.ResourceMetadata{
+			Repository: &model.Repository{
+				Name: "flaky_ns/hello-world",
+			},
+		},
+	}
+	assert.NoError(t, a.PrepareForPush([]*model.Resource{resource}))
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_CreateNamespaceRetryAfter(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	for _, retryAfter := range []string{"1", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)} {
+		mockRequest().Post("/dockyard/v2/namespaces").
+			Reply(429).SetHeader("Retry-After", retryAfter).BodyString(`{"error_msg":"too many requests"}`)
+		mockRequest().Post("/dockyard/v2/namespaces").Reply(201)
+
+		// the Retry-After is capped at the max backoff, which is far above the backoff
+		a := getMockAdapter(t, WithNamespaceCreateRetry(2, time.Millisecond), WithRetryLimits(100*time.Millisecond, 0))
+		start := time.Now()
+		assert.NoError(t, a.createNamespaceWithRetry("throttled_ns", newRetryBudget(0)), retryAfter)
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, retryAfter)
+		assert.Less(t, time.Since(start), time.Second, retryAfter)
+	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_CreateNamespaceRetrySequence(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockSequence("POST", "/dockyard/v2/namespaces",
+		mockResponse{status: 502, body: "bad gateway"},
+		mockResponse{status: 429, body: `{"error_msg":"too many requests"}`},
+		mockResponse{status: 201},
+	)
+
+	a := getMockAdapter(t, WithNamespaceCreateRetry(3, time.Millisecond))
+	assert.NoError(t, a.createNamespaceWithRetry("flaky_ns", newRetryBudget(0)))
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_CreateNamespaceBody(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	var bodies []map[string]interface{}
+	mockRequest().Post("/dockyard/v2/namespaces").
+		Times(3).
+		AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+			body := map[string]interface{}{}
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				return false, err
+			}
+			bodies = append(bodies, body)
+			return true, nil
+		}).
+		Reply(201)
+
+	// the minimal body with the default description by default
+	assert.NoError(t, getMockAdapter(t).CreateNamespace("ns", NamespaceAuthPrivate))
+
+	fields := WithNamespaceCreateFields(map[string]interface{}{"description": "mirror", "namespace": "other"})
+	assert.NoError(t, getMockAdapter(t, fields).CreateNamespace("ns", NamespaceAuthPublic))
+
+	builder := WithNamespaceCreateBody(func(namespace string, auth NamespaceAuth) map[string]interface{} {
+		return map[string]interface{}{"name": namespace, "access": auth.String()}
+	})
+	assert.NoError(t, getMockAdapter(t, builder, fields).CreateNamespace("ns", NamespaceAuthPublic))
+
+	assert.Equal(t, []map[string]interface{}{
+		{"namespace": "ns", "auth": float64(0), "description": "Managed by Harbor replication"},
+		{"namespace": "ns", "auth": float64(1), "description": "mirror"},
+		{"name": "ns", "access": "public", "description": "mirror", "namespace": "other"},
+	}, bodies)
+	assert.True(t, gock.IsDone())
+
+	o := newOptions(WithSettings(map[string]string{SettingNamespaceCreateFields: `{"description":"mirror"}`}))
+	assert.Equal(t, map[string]interface{}{"description": "mirror"}, o.namespaceCreateFields)
+}
+
+func TestAdapter_NamespaceDescription(t *testing.T) {
+	defer gock.Off()
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"ns1","auth":0,"description":"mirror of hub"}`).Reply(201)
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"ns2","auth":0}`).Reply(201)
+	mockRequest().Get("/dockyard/v2/namespaces/ns1").
+		Reply(200).BodyString(`{"id":1,"name":"ns1","description":"mirror of hub"}`)
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).BodyString(`{"namespaces":[{"id":1,"name":"ns1","description":"mirror of hub"},{"id":2,"name":"ns2"}]}`)
+
+	a := getMockAdapter(t, WithNamespaceDescription(" mirror of hub "))
+	assert.NoError(t, a.CreateNamespace("ns1", NamespaceAuthPrivate))
+	a = getMockAdapter(t, WithSettings(map[string]string{SettingNamespaceDescription: ""}))
+	assert.NoError(t, a.CreateNamespace("ns2", NamespaceAuthPrivate))
+
+	ns, err := a.GetNamespace("ns1")
+	require.NoError(t, err)
+	assert.Equal(t, "mirror of hub", ns.Metadata[MetadataNamespaceDescription])
+	namespaces, err := a.ListNamespaces(nil)
+	require.NoError(t, err)
+	require.Len(t, namespaces, 2)
+	assert.Equal(t, "mirror of hub", namespaces[0].Metadata[MetadataNamespaceDescription])
+	assert.NotContains(t, namespaces[1].Metadata, MetadataNamespaceDescription)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_PrepareForPushPartialFailure(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/a_ns").
+		Reply(200).BodyString("{}")
+	mockRequest().Get("/dockyard/v2/namespaces/b_ns").
+		Reply(200).BodyString("{}")
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"a_ns","auth":0,"description":"Managed by Harbor replication"}`).
+		Reply(201)
+	// a permanent error isn't retried
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"b_ns","auth":0,"description":"Managed by Harbor replication"}`).
+		Reply(400).BodyString("invalid namespace")
+
+	a := getMockAdapter(t, WithNamespaceCreateRetry(3, time.Millisecond))
+	var resources []*model.Resource
+	for _, name := range []string{"b_ns/hello-world", "a_ns/hello-world"} {
+		resources = append(resources, &model.Resource{
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{
+					Name: name,
+				},
+			},
+		})
+	}
+	err := a.PrepareForPush(resources)
+	assert.EqualError(t, err, "failed to create namespace b_ns (namespaces created: a_ns): [400][invalid namespace]")
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_PrepareNamespacesPartialFailure(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	for _, ns := range []string{"a_ns", "b_ns", "c_ns", "d_ns"} {
+		mockRequest().Get("/dockyard/v2/namespaces/" + ns).Reply(200).BodyString("{}")
+	}
+	mockRequest().Get("/dockyard/v2/namespaces/e_ns").Reply(200).BodyString(`{"id":5,"name":"e_ns"}`)
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"a_ns","auth":0,"description":"Managed by Harbor replication"}`).Reply(201)
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"b_ns","auth":0,"description":"Managed by Harbor replication"}`).
+		Reply(400).BodyString("invalid namespace")
+	// the namespace created concurrently by another job
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"c_ns","auth":0,"description":"Managed by Harbor replication"}`).Reply(409)
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"d_ns","auth":0,"description":"Managed by Harbor replication"}`).Reply(500)
+
+	a := getMockAdapter(t, WithNamespaceCreateRetry(1, time.Millisecond))
+	var resources []*model.Resource
+	for _, ns := range []string{"e_ns", "d_ns", "c_ns", "b_ns", "a_ns"} {
+		resources = append(resources, &model.Resource{
+			Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: ns + "/app"}},
+		})
+	}
+	result, err := a.PrepareNamespaces(resources)
+	assert.EqualError(t, err, "failed to create namespaces b_ns, d_ns (namespaces created: a_ns): "+
+		"b_ns: [400][invalid namespace]; d_ns: huawei SWR server error: [500][]")
+	assert.ErrorIs(t, err, ErrServer)
+	var prepareErr *PrepareError
+	require.True(t, errors.As(err, &prepareErr))
+	assert.Same(t, result, prepareErr.Result)
+	assert.Equal(t, []string{"a_ns"}, result.Created)
+	assert.Equal(t, []string{"c_ns", "e_ns"}, result.Existed)
+	require.Len(t, result.Failed, 2)
+	assert.Equal(t, "b_ns", result.Failed[0].Namespace)
+	assert.Equal(t, "d_ns", result.Failed[1].Namespace)
+	assert.ErrorIs(t, result.Failed[1], ErrServer)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_PrepareForPushRetryExhausted(t *testing.T) {
 	defer gock.Off()
 	gock.Observe(gock.DumpRequest)
 
+	mockRequest().Get("/dockyard/v2/namespaces/flaky_ns").
+		Reply(200).BodyString("{}")
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"flaky_ns","auth":0,"description":"Managed by Harbor replication"}`).
+		Times(2).Reply(503).BodyString("service unavailable")
+
+	a := getMockAdapter(t, WithNamespaceCreateRetry(2, time.Millisecond))
+	resource := &model.Resource{
+		Metadata: &model.ResourceMetadata{
+			Repository: &model.Repository{
+				Name: "flaky_ns/hello-world",
+			},
+		},
+	}
+	err := a.PrepareForPush([]*model.Resource{resource})
+	assert.ErrorIs(t, err, ErrServer)
+	assert.Contains(t, err.Error(), "flaky_ns")
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_PrepareForPushRetryLimits(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// the capped backoff waits 40ms twice, the third retry would exceed the total time bound
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"flaky_ns","auth":0,"description":"Managed by Harbor replication"}`).
+		Times(3).Reply(500)
+
+	a := getMockAdapter(t,
+		WithAlwaysCreateNamespaces(true),
+		WithNamespaceCreateRetry(10, 40*time.Millisecond),
+		WithRetryLimits(40*time.Millisecond, 100*time.Millisecond))
+	err := a.PrepareForPush([]*model.Resource{
+		{Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: "flaky_ns/app"}}},
+	})
+	assert.ErrorIs(t, err, ErrServer)
+	assert.Contains(t, err.Error(), "gave up retrying")
+	assert.Contains(t, err.Error(), "attempt 3/10")
+	assert.True(t, gock.IsDone())
+
+	o := newOptions(WithSettings(map[string]string{
+		SettingRetryMaxBackoffMS:      "2000",
+		SettingRetryMaxElapsedSeconds: "30",
+	}))
+	assert.Equal(t, 2*time.Second, o.retryMaxBackoff)
+	assert.Equal(t, 30*time.Second, o.retryMaxElapsed)
+	o = newOptions(WithRetryLimits(0, 0))
+	assert.Equal(t, defaultRetryMaxBackoff, o.retryMaxBackoff)
+	assert.Equal(t, defaultRetryMaxElapsed, o.retryMaxElapsed)
+}
+func TestAdapter_PlanPush(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// every namespace is checked once, no namespace is created
+	mockRequest().Get("/dockyard/v2/namespaces/existing_ns").
+		Reply(200).BodyString(`{"id":1,"name":"existing_ns"}`)
+	mockRequest().Get("/dockyard/v2/namespaces/new_ns").
+		Reply(200).BodyString("{}")
+
 	a := getMockAdapter(t)
+	var resources []*model.Resource
+	for _, name := range []string{"new_ns/app", "existing_ns/app", "new_ns/lib", "new_ns/app"} {
+		resources = append(resources, &model.Resource{
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{
+					Name: name,
+				},
+			},
+		})
+	}
+	plan, err := a.PlanPush(resources)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"new_ns"}, plan.Namespaces)
+	assert.Equal(t, []string{"existing_ns/app", "new_ns/app", "new_ns/lib"}, plan.Repositories)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_PrepareForPushAlwaysCreateNamespaces(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// no existence is checked, the existing namespace is tolerated by its 409
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"existing_ns","auth":0,"description":"Managed by Harbor replication"}`).
+		Reply(409).BodyString(`{"errors":"namespace already exists"}`)
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"stale_ns","auth":0,"description":"Managed by Harbor replication"}`).
+		Reply(201)
+
+	a := getMockAdapter(t, WithSettings(map[string]string{SettingAlwaysCreateNamespaces: "true"}))
+	var resources []*model.Resource
+	for _, name := range []string{"stale_ns/app", "existing_ns/app"} {
+		resources = append(resources, &model.Resource{
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{
+					Name: name,
+				},
+			},
+		})
+	}
+	plan, err := a.PlanPush(resources)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"existing_ns", "stale_ns"}, plan.Namespaces)
+	assert.NoError(t, a.PrepareForPush(resources))
+	assert.True(t, gock.IsDone())
+}
+
+func TestValidateNamespaceName(t *testing.T) {
+	for _, name := range []string{"ns", "a", "team_a", "team__a", "my.team-1", "acme/team", strings.Repeat("a", 64)} {
+		assert.NoError(t, ValidateNamespaceName(name), name)
+	}
+	for _, name := range []string{"", "Team", "1team", "team-", "team_", "team#1", "team._a", "team___a",
+		"acme/", "acme/Team", strings.Repeat("a", 65)} {
+		err := ValidateNamespaceName(name)
+		assert.True(t, errors.Is(err, ErrInvalidNamespaceName), name)
+	}
+	assert.Contains(t, ValidateNamespaceName("team._a").Error(), `"._"`)
+}
 
+func TestAdapter_PrepareForPushInvalidNamespace(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// no request is sent for the invalid namespace
+	gock.CleanUnmatchedRequest()
+	a := getMockAdapter(t)
+	err := a.PrepareForPush([]*model.Resource{
+		{Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: "ns1/app"}}},
+		{Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: "My_NS/app"}}},
+	})
+	assert.True(t, errors.Is(err, ErrInvalidNamespaceName))
+	assert.Contains(t, err.Error(), "My_NS")
+	assert.False(t, gock.HasUnmatchedRequest())
+}
+
+func TestAdapter_NamespaceOf(t *testing.T) {
+	a := getMockAdapter(t, WithOrganizations("acme"))
+	for repository, expected := range map[string]string{
+		"ns/app":           "ns",
+		"ns/lib/base":      "ns",
+		"acme/team/app":    "acme/team",
+		"acme/team/lib/db": "acme/team",
+		// no repository after the namespace of the organization
+		"acme/app": "acme",
+		"app":      "app",
+	} {
+		assert.Equal(t, expected, a.namespaceOf(repository), repository)
+	}
+	assert.Equal(t, "acme", getMockAdapter(t).namespaceOf("acme/team/app"))
+}
+
+func TestAdapter_PlanPushOrganization(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// the organization-scoped namespaces are checked with the listing
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).BodyString(`{"namespaces":[{"id":1,"name":"acme/team"},{"id":2,"name":"ns"}]}`)
+
+	a := getMockAdapter(t, WithOrganizations("acme"))
+	var resources []*model.Resource
+	for _, name := range []string{"acme/team/app", "acme/infra/app", "ns/app"} {
+		resources = append(resources, &model.Resource{
+			Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: name}},
+		})
+	}
+	plan, err := a.PlanPush(resources)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme/infra"}, plan.Namespaces)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_GetNamespaces(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// a small set is checked one by one
+	mockRequest().Get("/dockyard/v2/namespaces/ns0").
+		Reply(200).BodyString(`{"id":1,"name":"ns0"}`)
+	mockRequest().Get("/dockyard/v2/namespaces/ns1").
+		Reply(200).BodyString("{}")
+
+	a := getMockAdapter(t)
+	existing, err := a.GetNamespaces([]string{"ns0", "ns1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"ns0": true, "ns1": false}, existing)
+	assert.True(t, gock.IsDone())
+
+	// a large set is checked by listing the namespaces once
+	var names []string
+	for i := 0; i <= bulkNamespaceThreshold; i++ {
+		names = append(names, fmt.Sprintf("ns%d", i))
+	}
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).BodyString(`{"namespaces":[{"id":1,"name":"ns0"},{"id":2,"name":"ns3"},{"id":3,"name":"other"}]}`)
+	existing, err = a.GetNamespaces(names)
+	assert.NoError(t, err)
+	assert.Len(t, existing, len(names))
+	for name, exist := range existing {
+		assert.Equal(t, name == "ns0" || name == "ns3", exist, name)
+	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_HealthCheck(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// every check reaches SWR without the caching
+	a := getMockAdapter(t, WithHealthCheckTTL(0, 0))
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).BodyString(`{"namespaces":[]}`)
 	health, err := a.HealthCheck()
-	if err != nil {
-		t.Error(err)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Healthy, health)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(502).BodyString("bad gateway")
+	health, err = a.HealthCheck()
+	assert.ErrorIs(t, err, ErrServer)
+	assert.Equal(t, model.Unhealthy, health)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		ReplyError(&net.DNSError{Err: "no such host", Name: "swr.cn-north-1.myhuaweicloud.com"})
+	health, err = a.HealthCheck()
+	assert.ErrorIs(t, err, ErrDNSResolution)
+	assert.Equal(t, model.Unhealthy, health)
+}
+
+func TestAdapter_HealthCheckCached(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	a := getMockAdapter(t, WithHealthCheckTTL(time.Hour, 50*time.Millisecond))
+
+	// the unhealthy result expires soon
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(502).BodyString("bad gateway")
+	for i := 0; i < 2; i++ {
+		health, err := a.HealthCheck()
+		assert.ErrorIs(t, err, ErrServer)
+		assert.Equal(t, model.Unhealthy, health)
+	}
+	assert.True(t, gock.IsDone())
+
+	time.Sleep(60 * time.Millisecond)
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).BodyString(`{"namespaces":[]}`)
+	for i := 0; i < 3; i++ {
+		health, err := a.HealthCheck()
+		assert.NoError(t, err)
+		assert.Equal(t, model.Healthy, health)
+	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_GetNamespace(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/with_quota").
+		Reply(200).BodyString(`{"id":1,"name":"with_quota","quota":1024,"used":512}`)
+	mockRequest().Get("/dockyard/v2/namespaces/without_quota").
+		Reply(200).BodyString(`{"id":2,"name":"without_quota"}`)
+
+	a := getMockAdapter(t)
+
+	ns, err := a.GetNamespace("with_quota")
+	assert.NoError(t, err)
+	assert.Equal(t, "with_quota", ns.Name)
+	assert.Equal(t, int64(1024), ns.Metadata["quota"])
+	assert.Equal(t, int64(512), ns.Metadata["used"])
+
+	ns, err = a.GetNamespace("without_quota")
+	assert.NoError(t, err)
+	assert.Equal(t, "without_quota", ns.Name)
+	assert.NotContains(t, ns.Metadata, "quota")
+	assert.NotContains(t, ns.Metadata, "used")
+}
+
+func TestAdapter_GetNamespaceEmptyBody(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/empty").
+		Reply(200)
+	mockRequest().Get("/dockyard/v2/namespaces/blank").
+		Reply(200).BodyString(" \n")
+
+	a := getMockAdapter(t)
+	for _, name := range []string{"empty", "blank"} {
+		ns, err := a.GetNamespace(name)
+		assert.NoError(t, err)
+		assert.Equal(t, name, ns.Name)
+		assert.Empty(t, ns.Metadata)
+	}
+}
+
+func TestAdapter_GetNamespaceID(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/string_id").
+		Reply(200).BodyString(`{"id":"12","name":"string_id"}`)
+	mockRequest().Get("/dockyard/v2/namespaces/without_id").
+		Reply(200).BodyString(`{"name":"without_id"}`)
+	mockRequest().Get("/dockyard/v2/namespaces/empty").
+		Reply(200)
+	// the missing IDs are resolved by one listing rather than one per namespace
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Times(2).
+		Reply(200).BodyString(`{"namespaces":[{"id":34,"name":"without_id"},{"id":"56","name":"empty","creator_name":"me"}]}`)
+
+	a := getMockAdapter(t)
+	var got []*model.Namespace
+	for _, name := range []string{"string_id", "without_id", "empty"} {
+		ns, err := a.GetNamespace(name)
+		assert.NoError(t, err)
+		got = append(got, ns)
+	}
+	_, ok := NamespaceID(got[1])
+	assert.False(t, ok)
+	require.NoError(t, a.ResolveNamespaceIDs(got...))
+	for i, expected := range []int64{12, 34, 56} {
+		id, ok := NamespaceID(got[i])
+		assert.True(t, ok, got[i].Name)
+		assert.Equal(t, expected, id, got[i].Name)
+		assert.IsType(t, int64(0), got[i].Metadata[MetadataNamespaceID])
+	}
+	assert.Equal(t, "me", got[2].Metadata["creator_name"])
+	// nothing is listed if no ID is missing
+	require.NoError(t, a.ResolveNamespaceIDs(got...))
+
+	namespaces, err := a.ListNamespaces(nil)
+	assert.NoError(t, err)
+	for _, ns := range namespaces {
+		_, ok := NamespaceID(ns)
+		assert.True(t, ok, ns.Name)
+	}
+	assert.True(t, gock.IsDone())
+
+	_, ok = NamespaceID(&model.Namespace{Name: "fallback", Metadata: map[string]interface{}{}})
+	assert.False(t, ok)
+}
+
+func TestAdapter_GetNamespaceByID(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Times(2).
+		Reply(200).BodyString(`{"namespaces":[{"id":1,"name":"ns1","domain_public":1},{"id":"2","name":"ns2"}]}`)
+
+	a := getMockAdapter(t)
+	ns, err := a.GetNamespaceByID(2)
+	assert.NoError(t, err)
+	assert.Equal(t, "ns2", ns.Name)
+	assert.Equal(t, int64(2), ns.Metadata[MetadataNamespaceID])
+
+	ns, err = a.GetNamespaceByID(3)
+	assert.True(t, errors.Is(err, ErrNamespaceNotFound))
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Nil(t, ns)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_PrepareForPushEmptyBody(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// the namespace exists, no creation is expected
+	mockRequest().Get("/dockyard/v2/namespaces/existing_ns").
+		Reply(200).BodyString(" ")
+
+	a := getMockAdapter(t)
+	resource := &model.Resource{
+		Metadata: &model.ResourceMetadata{
+			Repository: &model.Repository{
+				Name: "existing_ns/hello-world",
+			},
+		},
+	}
+	assert.NoError(t, a.PrepareForPush([]*model.Resource{resource}))
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_PingRegistry(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	a := getMockAdapter(t)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).BodyString(`{"namespaces":[]}`)
+	assert.NoError(t, a.PingRegistry())
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(401).BodyString(`{"errors":"unauthorized"}`)
+	err := a.PingRegistry()
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		ReplyError(errors.New("dial tcp: connection refused"))
+	err = a.PingRegistry()
+	assert.ErrorIs(t, err, ErrUnreachable)
+	assert.NotErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestMatchNamespace(t *testing.T) {
+	cases := []struct {
+		name    string
+		query   *model.NamespaceQuery
+		matched bool
+	}{
+		{name: "team-a", query: nil, matched: true},
+		{name: "team-a", query: &model.NamespaceQuery{}, matched: true},
+		{name: "ateam", query: &model.NamespaceQuery{Name: "team"}, matched: true},
+		{name: "ateam", query: &model.NamespaceQuery{Name: "team", MatchStyle: model.NamespaceMatchStyleSubstring}, matched: true},
+		{name: "team-a", query: &model.NamespaceQuery{Name: "team-*", MatchStyle: model.NamespaceMatchStyleGlob}, matched: true},
+		{name: "team-b", query: &model.NamespaceQuery{Name: "team-*", MatchStyle: model.NamespaceMatchStyleGlob}, matched: true},
+		{name: "ateam", query: &model.NamespaceQuery{Name: "team-*", MatchStyle: model.NamespaceMatchStyleGlob}, matched: false},
+		{name: "team-a", query: &model.NamespaceQuery{Name: "team-?", MatchStyle: model.NamespaceMatchStyleGlob}, matched: true},
+		{name: "team-ab", query: &model.NamespaceQuery{Name: "team-?", MatchStyle: model.NamespaceMatchStyleGlob}, matched: false},
+		{name: "team", query: &model.NamespaceQuery{Name: "team", MatchStyle: model.NamespaceMatchStyleGlob}, matched: true},
+		{name: "team-a", query: &model.NamespaceQuery{Name: "team", MatchStyle: model.NamespaceMatchStyleGlob}, matched: false},
+	}
+	for _, c := range cases {
+		matched, err := matchNamespace(c.query, c.name)
+		assert.NoError(t, err)
+		assert.Equal(t, c.matched, matched, "name: %s, query: %+v", c.name, c.query)
+	}
+
+	_, err := matchNamespace(&model.NamespaceQuery{Name: "team", MatchStyle: "unknown"}, "team")
+	assert.Error(t, err)
+}
+
+func TestAdapter_ListNamespaces(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).BodyString(`{"namespaces":[{"id":1,"name":"visible"}]}`)
+
+	a := getMockAdapter(t)
+	namespaces, err := a.ListNamespaces(&model.NamespaceQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, namespaces, 1)
+	assert.Equal(t, "visible", namespaces[0].Name)
+	assert.True(t, gock.IsDone())
+
+	mockRequest().Get("/dockyard/v2/namespaces").
+		Reply(200).BodyString(`{"namespaces":[{"id":1,"name":"visible"},{"id":2,"name":"hidden"}]}`)
+
+	a = getMockAdapter(t, WithAllNamespaces(true))
+	namespaces, err = a.ListNamespaces(&model.NamespaceQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, namespaces, 2)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_ListNamespacesByOwner(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	body := `{"namespaces":[
+		{"id":1,"name":"team_a","creator_name":"alice","domain_name":"domain_a"},
+		{"id":2,"name":"team_b","creator_name":"bob","domain_name":"domain_a"},
+		{"id":3,"name":"team_c","creator_name":"alice","domain_name":"domain_b"}]}`
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Times(3).Reply(200).BodyString(body)
+
+	a := getMockAdapter(t)
+	names := func(query *model.NamespaceQuery) []string {
+		namespaces, err := a.ListNamespaces(query)
+		assert.NoError(t, err)
+		var names []string
+		for _, ns := range namespaces {
+			names = append(names, ns.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"team_a", "team_c"}, names(&model.NamespaceQuery{Creator: "alice"}))
+	assert.Equal(t, []string{"team_a", "team_b"}, names(&model.NamespaceQuery{Domain: "domain_a"}))
+	assert.Equal(t, []string{"team_c"}, names(&model.NamespaceQuery{Creator: "alice", Domain: "domain_b"}))
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_ListNamespacesServerSideFilter(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	body := `{"namespaces":[{"name":"team-a"},{"name":"team-b"},{"name":"my-team"}]}`
+	mockRequest().Get("/dockyard/v2/visible/namespaces").MatchParam("namespace", "^team$").
+		Reply(200).BodyString(body)
+	mockRequest().Get("/dockyard/v2/visible/namespaces").MatchParam("namespace", "^team-$").
+		Reply(200).BodyString(body)
+
+	a := getMockAdapter(t)
+	// the listed names are matched locally as well
+	namespaces, err := a.ListNamespaces(&model.NamespaceQuery{Name: "team"})
+	require.NoError(t, err)
+	assert.Len(t, namespaces, 3)
+	namespaces, err = a.ListNamespaces(&model.NamespaceQuery{Name: "team-*", MatchStyle: model.NamespaceMatchStyleGlob})
+	require.NoError(t, err)
+	require.Len(t, namespaces, 2)
+	assert.Equal(t, "team-a", namespaces[0].Name)
+	assert.True(t, gock.IsDone())
+
+	// the glob starting with a wildcard can't be filtered on SWR
+	for _, query := range []*model.NamespaceQuery{
+		{Name: "*-team", MatchStyle: model.NamespaceMatchStyleGlob},
+		{Name: ""},
+		nil,
+	} {
+		assert.Empty(t, a.serverNamespaceFilter(query))
+	}
+	assert.Empty(t, getMockAdapter(t, WithServerSideNamespaceFilter(false)).serverNamespaceFilter(&model.NamespaceQuery{Name: "team"}))
+	assert.Empty(t, getMockAdapter(t, WithSettings(map[string]string{SettingServerSideNamespaceFilter: "false"})).
+		serverNamespaceFilter(&model.NamespaceQuery{Name: "team"}))
+}
+
+func TestAdapter_ListNamespacesServerSideFilterUnsupported(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").MatchParam("namespace", "team").
+		Reply(400).BodyString(`{"errors":"unknown parameter namespace"}`)
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Times(2).
+		Reply(200).BodyString(`{"namespaces":[{"name":"team-a"},{"name":"other"}]}`)
+
+	a := getMockAdapter(t)
+	for i := 0; i < 2; i++ {
+		namespaces, err := a.ListNamespaces(&model.NamespaceQuery{Name: "team"})
+		require.NoError(t, err)
+		require.Len(t, namespaces, 1)
+		assert.Equal(t, "team-a", namespaces[0].Name)
+	}
+	assert.True(t, gock.IsDone())
+
+	// the filter is sent again once the interval passes
+	assert.Empty(t, a.serverNamespaceFilter(&model.NamespaceQuery{Name: "team"}))
+	a.namespaceFilterRejectedAt.Store(time.Now().Add(-namespaceFilterRetryInterval).UnixNano())
+	assert.Equal(t, "team", a.serverNamespaceFilter(&model.NamespaceQuery{Name: "team"}))
+}
+
+func TestAdapter_ListNamespacesWithCountsNoServerSideFilter(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// the total counts all the namespaces, so the filter isn't sent
+	mockRequest().Get("/dockyard/v2/visible/namespaces").ParamPresent("namespace").
+		Reply(500)
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).BodyString(`{"namespaces":[{"name":"team-a"},{"name":"team-b"},{"name":"other"}]}`)
+
+	list, err := getMockAdapter(t).ListNamespacesWithCounts(&model.NamespaceQuery{Name: "team"})
+	require.NoError(t, err)
+	assert.Len(t, list.Namespaces, 2)
+	assert.Equal(t, int64(2), list.Matched)
+	assert.Equal(t, int64(3), list.Total)
+	assert.True(t, gock.IsPending())
+}
+
+func TestAdapter_ListNamespacesByImageCount(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	body := `{"namespaces":[
+		{"id":1,"name":"empty","image_count":0},
+		{"id":2,"name":"few","image_count":3},
+		{"id":3,"name":"many","image_count":10}]}`
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Times(4).Reply(200).BodyString(body)
+
+	a := getMockAdapter(t)
+	names := func(query *model.NamespaceQuery) []string {
+		namespaces, err := a.ListNamespaces(query)
+		assert.NoError(t, err)
+		var names []string
+		for _, ns := range namespaces {
+			names = append(names, ns.Name)
+		}
+		return names
+	}
+	count := func(n int64) *int64 { return &n }
+
+	assert.Equal(t, []string{"empty"}, names(&model.NamespaceQuery{MaxImageCount: count(0)}))
+	// the bounds are inclusive
+	assert.Equal(t, []string{"empty", "few"}, names(&model.NamespaceQuery{MaxImageCount: count(3)}))
+	assert.Equal(t, []string{"few", "many"}, names(&model.NamespaceQuery{MinImageCount: count(3)}))
+	assert.Equal(t, []string{"few"}, names(&model.NamespaceQuery{MinImageCount: count(1), MaxImageCount: count(9)}))
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_ListWritableNamespaces(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// "auth" is the visibility of the namespace, the permission of the user is "self_auth", which
+	// is got from the permissions of the namespace if the listing doesn't report it
+	body := `{"namespaces":[
+		{"id":1,"name":"shared","creator_name":"other","auth":1,"domain_public":1,
+			"self_auth":{"user_id":"u1","user_name":"me","auth":1}},
+		{"id":2,"name":"team","creator_name":"other","auth":0,"domain_public":0},
+		{"id":3,"name":"owned","creator_name":"me","auth":0,"domain_public":0,
+			"self_auth":{"user_id":"u1","user_name":"me","auth":7}},
+		{"id":4,"name":"unknown","creator_name":"other","auth":0,"domain_public":0}]}`
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Times(2).Reply(200).BodyString(body)
+	mockRequest().Get("/dockyard/v2/namespaces/team/access").
+		Reply(200).BodyString(`{"id":2,"name":"team","creator_name":"other",` +
+		`"self_auth":{"user_id":"u1","user_name":"me","auth":3},` +
+		`"others_auths":[{"user_id":"u2","user_name":"other","auth":7}]}`)
+	// the namespace whose permission can't be got is kept
+	mockRequest().Get("/dockyard/v2/namespaces/unknown/access").
+		Reply(500).BodyString(`{"error_msg":"internal error"}`)
+
+	names := func(a *adapter) []string {
+		namespaces, err := a.ListNamespaces(nil)
+		assert.NoError(t, err)
+		var names []string
+		for _, ns := range namespaces {
+			names = append(names, ns.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"owned", "shared", "team", "unknown"}, names(getMockAdapter(t)))
+	assert.Equal(t, []string{"owned", "team", "unknown"}, names(getMockAdapter(t, WithWritableNamespacesOnly(true))))
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_ListNamespacesForbiddenFallback(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Times(3).Reply(403).BodyString(`{"error_msg":"forbidden"}`)
+
+	// the listing fails without the fallback namespaces
+	_, err := getMockAdapter(t).ListNamespaces(nil)
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+
+	a := getMockAdapter(t, WithFallbackNamespaces("team_b", "team_a", "team_b"))
+	namespaces, err := a.ListNamespaces(nil)
+	assert.NoError(t, err)
+	if assert.Len(t, namespaces, 2) {
+		assert.Equal(t, "team_a", namespaces[0].Name)
+		assert.Equal(t, "team_b", namespaces[1].Name)
+	}
+
+	namespaces, err = a.ListNamespaces(&model.NamespaceQuery{Name: "team_b"})
+	assert.NoError(t, err)
+	if assert.Len(t, namespaces, 1) {
+		assert.Equal(t, "team_b", namespaces[0].Name)
+	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_ListNamespacesServerErrorNoFallback(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// only the forbidden listing falls back
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(500).BodyString("internal error")
+
+	_, err := getMockAdapter(t, WithFallbackNamespaces("team_a")).ListNamespaces(nil)
+	assert.Error(t, err)
+}
+
+func TestAdapter_ListNamespacesPage(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	body := `{"namespaces":[{"id":1,"name":"ns1"},{"id":2,"name":"ns2"},{"id":3,"name":"ns3"},{"id":4,"name":"other"}]}`
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Times(4).Reply(200).BodyString(body)
+
+	a := getMockAdapter(t)
+	cases := []struct {
+		query *model.NamespaceQuery
+		names []string
+		total int64
+	}{
+		{&model.NamespaceQuery{Name: "ns", Page: 1, PageSize: 2}, []string{"ns1", "ns2"}, 3},
+		{&model.NamespaceQuery{Name: "ns", Page: 2, PageSize: 2}, []string{"ns3"}, 3},
+		{&model.NamespaceQuery{Name: "ns", Page: 3, PageSize: 2}, nil, 3},
+		// no pagination
+		{&model.NamespaceQuery{}, []string{"ns1", "ns2", "ns3", "other"}, 4},
+	}
+	for _, c := range cases {
+		namespaces, total, err := a.ListNamespacesPage(c.query)
+		assert.NoError(t, err)
+		assert.Equal(t, c.total, total)
+		var names []string
+		for _, ns := range namespaces {
+			names = append(names, ns.Name)
+		}
+		assert.Equal(t, c.names, names)
+	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_ListNamespacesWithCounts(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// the duplicated namespace is counted once
+	body := `{"namespaces":[{"id":1,"name":"ns1","self_auth":{"auth":7}},{"id":2,"name":"ns2","self_auth":{"auth":1}},` +
+		`{"id":3,"name":"ns3","self_auth":{"auth":7}},{"id":4,"name":"other","self_auth":{"auth":7}},` +
+		`{"id":4,"name":"other","self_auth":{"auth":7}}]}`
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).BodyString(body)
+
+	a := getMockAdapter(t, WithWritableNamespacesOnly(true))
+	list, err := a.ListNamespacesWithCounts(&model.NamespaceQuery{Name: "ns", Page: 1, PageSize: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, list.Namespaces, 1) {
+		assert.Equal(t, "ns1", list.Namespaces[0].Name)
+	}
+	assert.Equal(t, int64(2), list.Matched)
+	assert.Equal(t, int64(4), list.Total)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_ListNamespacesSorted(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).BodyString(`{"namespaces":[{"id":3,"name":"ns_c"},{"id":1,"name":"ns_a"},{"id":2,"name":"ns_b"},{"id":1,"name":"ns_a"}]}`)
+
+	a := getMockAdapter(t)
+	namespaces, err := a.ListNamespaces(nil)
+	assert.NoError(t, err)
+	var names []string
+	for _, ns := range namespaces {
+		names = append(names, ns.Name)
+	}
+	assert.Equal(t, []string{"ns_a", "ns_b", "ns_c"}, names)
+	assert.True(t, gock.IsDone())
+}
+
+func TestJoinURLPath(t *testing.T) {
+	cases := []struct {
+		base     string
+		path     string
+		expected string
+	}{
+		{base: "https://swr.com", path: "/dockyard/v2", expected: "https://swr.com/dockyard/v2"},
+		{base: "https://swr.com/", path: "/dockyard/v2/", expected: "https://swr.com/dockyard/v2"},
+		{base: "https://swr.com", path: "gateway//swr/v2", expected: "https://swr.com/gateway/swr/v2"},
+		{base: "https://swr.com/", path: "", expected: "https://swr.com"},
+		{base: "https://swr.com", path: "/", expected: "https://swr.com"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, joinURLPath(c.base, c.path))
+	}
+}
+
+func TestAdapter_WithBasePath(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/gateway/swr/namespaces/ns").
+		Reply(200).BodyString(`{"id":1,"name":"ns"}`)
+
+	a := getMockAdapter(t, WithBasePath("/gateway/swr/"))
+	ns, err := a.GetNamespace("ns")
+	assert.NoError(t, err)
+	assert.Equal(t, "ns", ns.Name)
+	assert.True(t, gock.IsDone())
+}
+
+func TestNamespaceAuth(t *testing.T) {
+	assert.Equal(t, "private", NamespaceAuthPrivate.String())
+	assert.Equal(t, "public", NamespaceAuthPublic.String())
+	assert.Equal(t, "unknown", NamespaceAuth(7).String())
+
+	metadata := hwNamespace{Name: "ns", Auth: NamespaceAuthPublic}.metadata()
+	assert.Equal(t, 1, metadata["auth"])
+	assert.Equal(t, "public", metadata["auth_description"])
+	assert.NotContains(t, metadata, "permission")
+
+	// the permission of the user doesn't change the visibility
+	metadata = hwNamespace{Name: "ns", SelfAuth: &hwAccess{Auth: namespacePermissionManage}}.metadata()
+	assert.Equal(t, "private", metadata["auth_description"])
+	assert.Equal(t, 7, metadata["permission"])
+	assert.Equal(t, "manage", metadata["permission_description"])
+	assert.Equal(t, "write", namespacePermissionWrite.String())
+	assert.True(t, namespacePermissionWrite.writable())
+	assert.False(t, namespacePermissionRead.writable())
+}
+
+func TestAdapter_ListNamespacesPublic(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		BodyString(`{"namespaces":[
+			{"id":1,"name":"private_ns","domain_public":0},
+			{"id":2,"name":"public_ns","domain_public":1},
+			{"id":3,"name":"public_bool_ns","domain_public":true}]}`)
+
+	namespaces, err := getMockAdapter(t).ListNamespaces(nil)
+	assert.NoError(t, err)
+	public := map[string]interface{}{}
+	for _, ns := range namespaces {
+		public[ns.Name] = ns.Metadata["public"]
+	}
+	assert.Equal(t, map[string]interface{}{"private_ns": false, "public_ns": true, "public_bool_ns": true}, public)
+	assert.Equal(t, 1, namespaces[1].Metadata["domain_public"])
+}
+
+type idleClosingTransport struct {
+	http.RoundTripper
+	closed int
+}
+
+func (t *idleClosingTransport) CloseIdleConnections() {
+	t.closed++
+}
+
+func TestAdapter_Close(t *testing.T) {
+	a := getMockAdapter(t)
+	apiTransport := &idleClosingTransport{RoundTripper: http.DefaultTransport}
+	authTransport := &idleClosingTransport{RoundTripper: http.DefaultTransport}
+	a.client.GetClient().Transport = apiTransport
+	a.oriClient.Transport = apiTransport
+	a.authClient.GetClient().Transport = authTransport
+	a.untimedClient = common_http.NewClient(&http.Client{Transport: apiTransport})
+	a.tokens.set("ns/app", jwtToken{Token: "token", ExpiresIn: 3600})
+
+	assert.NoError(t, a.Close())
+	assert.Equal(t, 3, apiTransport.closed)
+	assert.Equal(t, 1, authTransport.closed)
+	_, ok := a.tokens.get("ns/app")
+	assert.False(t, ok)
+}
+
+func TestNewAdapterWithoutCredential(t *testing.T) {
+	for _, credential := range []*model.Credential{nil, {AccessKey: "ak"}, {AccessSecret: "sk"}} {
+		_, err := newAdapter(&model.Registry{
+			URL:        "https://swr.cn-north-1.myhuaweicloud.com",
+			Credential: credential,
+		})
+		assert.ErrorIs(t, err, ErrNoCredential)
 	}
-	t.Log(health)
 }
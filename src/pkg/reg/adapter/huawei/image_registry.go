@@ -15,67 +15,661 @@
 package huawei
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/Masterminds/semver"
 	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 
+	"github.com/goharbor/harbor/src/lib/log"
+	"github.com/goharbor/harbor/src/pkg/reg/filter"
 	"github.com/goharbor/harbor/src/pkg/reg/model"
+	"github.com/goharbor/harbor/src/pkg/reg/util"
 )
 
-// FetchArtifacts gets resources from Huawei SWR
-func (a *adapter) FetchArtifacts(_ []*model.Filter) ([]*model.Resource, error) {
-	resources := []*model.Resource{}
+// listPageSize is the page size used when walking the paginated listing APIs
+const listPageSize = 100
 
-	urls := fmt.Sprintf("%s/dockyard/v2/repositories?filter=center::self", a.registry.URL)
+// manifestMediaTypes are sent as the "Accept" header when querying manifests,
+// the index types must be listed, otherwise SWR falls back to the manifest of
+// the default platform for the multi-arch images
+var manifestMediaTypes = []string{
+	v1.MediaTypeImageIndex,
+	manifestlist.MediaTypeManifestList,
+	v1.MediaTypeImageManifest,
+	schema2.MediaTypeManifest,
+	schema1.MediaTypeSignedManifest,
+	schema1.MediaTypeManifest,
+}
 
-	r, err := http.NewRequest("GET", urls, nil)
-	if err != nil {
-		return resources, err
-	}
+// FetchArtifacts gets resources from Huawei SWR, the namespaces, the repositories
+// and the tags are walked in turn and paginated at each level. The name filter is
+// matched against "namespace/repo" and the tag filter against the tags
+func (a *adapter) FetchArtifacts(filters []*model.Filter) ([]*model.Resource, error) {
+	return a.FetchArtifactsContext(context.Background(), filters)
+}
 
-	r.Header.Add("content-type", "application/json; charset=utf-8")
+// FetchArtifactsContext fetches the resources like FetchArtifacts and stops when the context is
+// done. The namespaces are walked by the workers set by WithDiscoveryConcurrency, each of them
+// holds a slot of the adaptive concurrency if it's enabled, and the resources are returned in
+// the order of the namespaces regardless of the workers. The first failure stops the walk
+func (a *adapter) FetchArtifactsContext(ctx context.Context, filters []*model.Filter) ([]*model.Resource, error) {
+	resources := []*model.Resource{}
 
-	resp, err := a.client.Do(r)
+	namespaces, err := a.ListNamespaces(nil)
 	if err != nil {
 		return resources, err
 	}
 
-	defer resp.Body.Close()
-	code := resp.StatusCode
-	if code >= 300 || code < 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return resources, fmt.Errorf("[%d][%s]", code, string(body))
+	walkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		results  = make([][]*model.Resource, len(namespaces))
+		indexes  = make(chan int)
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for w := 0; w < min(a.opts.discoveryConcurrency, len(namespaces)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				release := a.limiter.acquire()
+				result, err := a.fetchNamespaceArtifacts(walkCtx, namespaces[i].Name, filters)
+				release(err)
+				if err != nil {
+					// the first failure is returned rather than the cancellations it causes
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					cancel()
+					continue
+				}
+				results[i] = result
+				a.reportProgress(ProgressEvent{
+					Type:      ProgressNamespaceFetched,
+					Namespace: namespaces[i].Name,
+					Count:     len(result),
+				})
+			}
+		}()
 	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
+	for i := range namespaces {
+		if walkCtx.Err() != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return resources, firstErr
+	}
+	if err := ctx.Err(); err != nil {
 		return resources, err
 	}
-	repos := []hwRepoQueryResult{}
-	err = json.Unmarshal(body, &repos)
+	for _, result := range results {
+		resources = append(resources, result...)
+	}
+	return resources, nil
+}
+
+// fetchNamespaceArtifacts fetches the resources of the repositories under the namespace
+func (a *adapter) fetchNamespaceArtifacts(ctx context.Context, namespace string, filters []*model.Filter) ([]*model.Resource, error) {
+	var resources []*model.Resource
+	repos, err := a.listRepositories(ctx, namespace)
 	if err != nil {
-		return resources, err
+		return nil, err
 	}
 	for _, repo := range repos {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		repository := &model.Repository{
+			Name: fmt.Sprintf("%s/%s", repo.NamespaceName, repo.Name),
+		}
+		if !a.repositoryListed(repository.Name) {
+			continue
+		}
+		matched, err := filter.DoFilterRepositories([]*model.Repository{repository}, filters)
+		if err != nil {
+			return nil, err
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		// no tag of the repository is updated since then
+		if a.updatedBefore(repo.UpdatedAt) {
+			continue
+		}
+
+		tags, err := a.listTags(ctx, repo.NamespaceName, repo.Name)
+		if err != nil {
+			return nil, err
+		}
+		var artifacts []*model.Artifact
+		for _, tag := range tags {
+			if a.updatedBefore(tag.Updated) {
+				continue
+			}
+			artifacts = append(artifacts, &model.Artifact{
+				Digest: tag.Digest,
+				Tags:   []string{tag.Tag},
+			})
+		}
+		artifacts, err = filter.DoFilterArtifacts(artifacts, filters)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = a.filterSemverArtifacts(artifacts)
+		artifacts, err = a.filterMediaTypeArtifacts(repository.Name, artifacts)
+		if err != nil {
+			return nil, err
+		}
+		artifacts, err = a.filterVulnerableArtifacts(repository.Name, artifacts)
+		if err != nil {
+			return nil, err
+		}
+		if len(artifacts) == 0 {
+			continue
+		}
+		referrers, err := a.listReferrerArtifacts(repository.Name, artifacts)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = appendSignatureArtifacts(artifacts, tags)
+		artifacts = appendReferrerArtifacts(artifacts, referrers)
+
 		resource := parseRepoQueryResultToResource(repo)
 		resource.Registry = a.registry
+		resource.Metadata.Artifacts = artifacts
+		resource.Metadata.Vtags = nil
+		for _, artifact := range artifacts {
+			resource.Metadata.Vtags = append(resource.Metadata.Vtags, artifact.Tags...)
+		}
+		resource.ExtendedInfo["tag_times"] = tagTimes(tags, resource.Metadata.Vtags)
 		resources = append(resources, resource)
 	}
 	return resources, nil
 }
 
-// ManifestExist check the manifest of Huawei SWR
+// updatedBefore reports whether the update time is before the time set by WithUpdatedSince,
+// the unknown update time is never before it so the artifact is kept
+func (a *adapter) updatedBefore(updated time.Time) bool {
+	return !a.opts.updatedSince.IsZero() && !updated.IsZero() && updated.Before(a.opts.updatedSince)
+}
+
+// tagTime is the creation and update time of a tag
+type tagTime struct {
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// tagTimes returns the creation and update time of the tags selected
+func tagTimes(tags []hwTag, selected []string) map[string]tagTime {
+	times := map[string]tagTime{}
+	for _, tag := range tags {
+		times[tag.Tag] = tagTime{Created: tag.Created, Updated: tag.Updated}
+	}
+	result := make(map[string]tagTime, len(selected))
+	for _, name := range selected {
+		if t, ok := times[name]; ok {
+			result[name] = t
+		}
+	}
+	return result
+}
+
+// filterSemverArtifacts keeps the artifacts whose tag satisfies the semver tag constraint,
+// see WithSemverTagConstraint
+func (a *adapter) filterSemverArtifacts(artifacts []*model.Artifact) []*model.Artifact {
+	if a.tagConstraint == nil {
+		return artifacts
+	}
+	var result []*model.Artifact
+	for _, artifact := range artifacts {
+		var tags []string
+		for _, tag := range artifact.Tags {
+			v, err := semver.NewVersion(tag)
+			if err != nil {
+				continue
+			}
+			if a.tagConstraint.Check(v) {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) > 0 {
+			artifact.Tags = tags
+			result = append(result, artifact)
+		}
+	}
+	return result
+}
+
+// filterMediaTypeArtifacts keeps the artifacts whose manifest media type matches any of the patterns
+// set by WithMediaTypeFilter, the manifest of each artifact is inspected as the tag listing of SWR
+// doesn't report the media type
+func (a *adapter) filterMediaTypeArtifacts(repository string, artifacts []*model.Artifact) ([]*model.Artifact, error) {
+	if len(a.opts.mediaTypes) == 0 {
+		return artifacts, nil
+	}
+	var result []*model.Artifact
+	for _, artifact := range artifacts {
+		exist, desc, err := a.manifestExist(repository, artifact.Digest)
+		if err != nil {
+			return nil, err
+		}
+		// the tag is deleted since the listing
+		if !exist {
+			continue
+		}
+		mediaType, _, _ := strings.Cut(desc.MediaType, ";")
+		mediaType = strings.TrimSpace(mediaType)
+		for _, pattern := range a.opts.mediaTypes {
+			matched, err := util.Match(pattern, mediaType)
+			if err != nil {
+				return nil, err
+			}
+			if matched {
+				result = append(result, artifact)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// cosignTagSuffixes are the suffixes of the tags cosign attaches the signatures,
+// attestations and SBOMs to an image with, e.g. "sha256-<hex>.sig"
+var cosignTagSuffixes = []string{".sig", ".att", ".sbom"}
+
+// appendSignatureArtifacts appends the cosign signatures, attestations and SBOMs of the artifacts
+// to the artifacts, cosign pushes them as the tags named after the digest of the signed image, so
+// they're picked up even if the tag filters don't select them to keep the signed images verifiable
+func appendSignatureArtifacts(artifacts []*model.Artifact, tags []hwTag) []*model.Artifact {
+	selected := map[string]struct{}{}
+	for _, artifact := range artifacts {
+		for _, tag := range artifact.Tags {
+			selected[tag] = struct{}{}
+		}
+	}
+	tagMap := map[string]hwTag{}
+	for _, tag := range tags {
+		tagMap[tag.Tag] = tag
+	}
+
+	result := artifacts
+	for _, artifact := range artifacts {
+		prefix := strings.Replace(artifact.Digest, ":", "-", 1)
+		if len(prefix) == 0 {
+			continue
+		}
+		for _, suffix := range cosignTagSuffixes {
+			name := prefix + suffix
+			if _, ok := selected[name]; ok {
+				continue
+			}
+			tag, ok := tagMap[name]
+			if !ok {
+				continue
+			}
+			selected[name] = struct{}{}
+			result = append(result, &model.Artifact{
+				Digest: tag.Digest,
+				Tags:   []string{tag.Tag},
+			})
+		}
+	}
+	return result
+}
+
+// maxReferrerDepth bounds the levels of the referrers discovered, e.g. the signature of the SBOM of the
+// image is on the second level
+const maxReferrerDepth = 3
+
+// listReferrerArtifacts lists the referrers of the artifacts via the OCI referrers API if it's enabled by
+// WithReferrers, e.g. the SBOMs and the attestations, and the referrers of the referrers as well. The
+// referrers aren't tagged, so they're returned as the accessories of the referred artifacts, grouped by
+// the digests of their subjects. Nothing is returned if SWR doesn't support the API, the referrers pushed
+// with the fallback tag scheme are picked up by appendSignatureArtifacts then
+func (a *adapter) listReferrerArtifacts(repository string, artifacts []*model.Artifact) (map[string][]*model.Artifact, error) {
+	if !a.opts.referrers {
+		return nil, nil
+	}
+	groups := map[string][]*model.Artifact{}
+	visited := map[string]struct{}{}
+	var walk func(subject string, parentTags []string, depth int) error
+	walk = func(subject string, parentTags []string, depth int) error {
+		if _, ok := visited[subject]; ok || depth > maxReferrerDepth || a.referrersUnsupported.Load() {
+			return nil
+		}
+		visited[subject] = struct{}{}
+		descriptors, err := a.listReferrers(repository, subject)
+		if err != nil {
+			return err
+		}
+		for _, desc := range descriptors {
+			referrer := &model.Artifact{
+				Digest:     desc.Digest.String(),
+				IsAcc:      true,
+				ParentTags: parentTags,
+			}
+			groups[subject] = append(groups[subject], referrer)
+			if err := walk(referrer.Digest, parentTags, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, artifact := range artifacts {
+		if len(artifact.Digest) == 0 {
+			continue
+		}
+		if err := walk(artifact.Digest, artifact.Tags, 1); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// listReferrers queries the OCI referrers API for the manifests referring to "repository@dgt", SWR is
+// marked as not supporting the API if it replies 404 or 405, so the API isn't queried any more
+func (a *adapter) listReferrers(repository, dgt string) ([]v1.Descriptor, error) {
+	token, err := getJwtToken(a, repository)
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequest(http.MethodGet, a.registryURL("v2", repository, "referrers", pathSegment(dgt)), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Add("Authorization", "Bearer "+token.Token)
+	r.Header.Add("Accept", v1.MediaTypeImageIndex)
+
+	start := time.Now()
+	resp, err := a.doRegistry(r)
+	logResponse(a.logger("ListReferrers", log.Fields{"repository": repository, "digest": dgt}), r, resp, err, start)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	code := resp.StatusCode
+	if code == http.StatusNotFound || code == http.StatusMethodNotAllowed {
+		log.Debugf("the OCI referrers API isn't supported by Huawei SWR %s, falling back to the tag scheme", a.registry.URL)
+		a.referrersUnsupported.Store(true)
+		return nil, nil
+	}
+	if code >= 300 || code < 200 {
+		return nil, a.newError(resp)
+	}
+	body, err := a.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	index := v1.Index{}
+	if err := json.Unmarshal(body, &index); err != nil {
+		return nil, err
+	}
+	return index.Manifests, nil
+}
+
+// appendReferrerArtifacts places the referrers right after their subjects, so the transfer pushes each
+// subject along with its referrers as a group. The referrers already picked up by the tag scheme are
+// moved into their groups and keep their tags
+func appendReferrerArtifacts(artifacts []*model.Artifact, groups map[string][]*model.Artifact) []*model.Artifact {
+	if len(groups) == 0 {
+		return artifacts
+	}
+	tagged := map[string][]*model.Artifact{}
+	for _, artifact := range artifacts {
+		tagged[artifact.Digest] = append(tagged[artifact.Digest], artifact)
+	}
+	var result []*model.Artifact
+	placed := map[string]struct{}{}
+	var place func(dgt string, own []*model.Artifact)
+	place = func(dgt string, own []*model.Artifact) {
+		if _, ok := placed[dgt]; ok {
+			return
+		}
+		placed[dgt] = struct{}{}
+		result = append(result, own...)
+		for _, referrer := range groups[dgt] {
+			if artifacts, ok := tagged[referrer.Digest]; ok {
+				place(referrer.Digest, artifacts)
+				continue
+			}
+			place(referrer.Digest, []*model.Artifact{referrer})
+		}
+	}
+	for _, artifact := range artifacts {
+		place(artifact.Digest, tagged[artifact.Digest])
+	}
+	return result
+}
+
+// listRepositories lists all the repositories under the namespace page by page
+func (a *adapter) listRepositories(ctx context.Context, namespace string) ([]hwRepoQueryResult, error) {
+	var repos []hwRepoQueryResult
+	ctx = a.withOperation(ctx, "ListRepositories", log.Fields{"namespace": namespace})
+	err := a.walkRepositoryPages(ctx, namespace, func(page []hwRepoQueryResult) error {
+		repos = append(repos, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repos, nil
+}
+
+// walkRepositoryPages passes the repositories under the namespace to fn page by page,
+// the walk stops when fn returns an error or the context is done
+func (a *adapter) walkRepositoryPages(ctx context.Context, namespace string, fn func([]hwRepoQueryResult) error) error {
+	for pages, offset := 0, 0; ; pages, offset = pages+1, offset+listPageSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := a.checkPagination(pages, offset); err != nil {
+			return fmt.Errorf("failed to list the repositories of namespace %s: %w", namespace, err)
+		}
+		condition := fmt.Sprintf("namespace::%s|center::self|offset::%d|limit::%d", namespace, offset, listPageSize)
+		urls := fmt.Sprintf("%s?filter=%s", a.apiURL("repositories"), url.QueryEscape(condition))
+		page := []hwRepoQueryResult{}
+		if err := a.getJSON(ctx, urls, &page); err != nil {
+			return err
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < listPageSize {
+			return nil
+		}
+	}
+}
+
+// WalkRepositories walks the repositories under all the visible namespaces and passes the ones
+// whose "namespace/repo" name matches the pattern to fn, an empty pattern matches all. The
+// repositories are fetched page by page rather than being held in memory all together, the walk
+// stops when fn returns an error or the context is canceled
+func (a *adapter) WalkRepositories(ctx context.Context, pattern string, fn func(repository string) error) error {
+	namespaces, err := a.ListNamespaces(nil)
+	if err != nil {
+		return err
+	}
+	for _, namespace := range namespaces {
+		nsCtx := a.withOperation(ctx, "WalkRepositories", log.Fields{"namespace": namespace.Name})
+		err := a.walkRepositoryPages(nsCtx, namespace.Name, func(page []hwRepoQueryResult) error {
+			for _, repo := range page {
+				name := fmt.Sprintf("%s/%s", repo.NamespaceName, repo.Name)
+				matched, err := util.Match(pattern, name)
+				if err != nil {
+					return err
+				}
+				if !matched {
+					continue
+				}
+				if err := fn(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListAllRepositories lists the "namespace/repo" names of the repositories under all the visible
+// namespaces matching the pattern, use WalkRepositories instead for the huge accounts
+func (a *adapter) ListAllRepositories(ctx context.Context, pattern string) ([]string, error) {
+	var repositories []string
+	err := a.WalkRepositories(ctx, pattern, func(repository string) error {
+		repositories = append(repositories, repository)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repositories, nil
+}
+
+// checkPagination returns ErrPaginationLimitExceeded if the pages or the items already fetched
+// by a listing reach the limits before the next page is fetched
+func (a *adapter) checkPagination(pages, items int) error {
+	if pages >= a.opts.maxPages {
+		return fmt.Errorf("%w: more than %d pages", ErrPaginationLimitExceeded, a.opts.maxPages)
+	}
+	if items >= a.opts.maxItems {
+		return fmt.Errorf("%w: more than %d items", ErrPaginationLimitExceeded, a.opts.maxItems)
+	}
+	return nil
+}
+
+// listTags lists all the tags of the repository page by page
+func (a *adapter) listTags(ctx context.Context, namespace, repository string) ([]hwTag, error) {
+	var tags []hwTag
+	ctx = a.withOperation(ctx, "ListTags", log.Fields{"namespace": namespace, "repository": repository})
+	for pages, offset := 0, 0; ; pages, offset = pages+1, offset+listPageSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := a.checkPagination(pages, len(tags)); err != nil {
+			return nil, fmt.Errorf("failed to list the tags of repository %s/%s: %w", namespace, repository, err)
+		}
+		urls := fmt.Sprintf("%s?offset=%d&limit=%d",
+			a.apiURL("namespaces", pathSegment(namespace), "repositories", pathSegment(encodeRepository(repository)), "tags"), offset, listPageSize)
+		page := []hwTag{}
+		if err := a.getJSON(ctx, urls, &page); err != nil {
+			return nil, err
+		}
+		tags = append(tags, page...)
+		if len(page) < listPageSize {
+			return tags, nil
+		}
+	}
+}
+
+// TagInfo describes a tag of a repository in Huawei SWR
+type TagInfo struct {
+	Name   string
+	Digest string
+	// Size is the total size in bytes of the image, zero means SWR doesn't report the size
+	Size int64
+	// Pushed is the time the tag is pushed last time, zero if SWR doesn't report it
+	Pushed time.Time
+}
+
+// ListTagInfos lists the tags of the repository, e.g. "namespace/repository", along with
+// their digests, sizes and the time they're pushed
+func (a *adapter) ListTagInfos(repository string) ([]TagInfo, error) {
+	namespace, name, found := strings.Cut(repository, "/")
+	if !found {
+		return nil, fmt.Errorf("invalid repository %s, the namespace is missing", repository)
+	}
+	tags, err := a.listTags(context.Background(), namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]TagInfo, 0, len(tags))
+	for _, tag := range tags {
+		pushed := tag.Updated
+		if pushed.IsZero() {
+			pushed = tag.Created
+		}
+		infos = append(infos, TagInfo{
+			Name:   tag.Tag,
+			Digest: tag.Digest,
+			Size:   tag.Size,
+			Pushed: pushed,
+		})
+	}
+	return infos, nil
+}
+
+// RepositoryExists reports whether the repository, e.g. "app" or "team/app", exists in the namespace
+// without listing the namespace. False is returned rather than an error if the namespace doesn't exist,
+// as SWR responds 404 to both
+func (a *adapter) RepositoryExists(namespace, repository string) (bool, error) {
+	urls := a.apiURL("namespaces", pathSegment(namespace), "repositories", pathSegment(encodeRepository(repository)))
+	r, err := http.NewRequest(http.MethodGet, urls, nil)
+	if err != nil {
+		return false, err
+	}
+	r.Header.Add("content-type", "application/json; charset=utf-8")
+
+	start := time.Now()
+	resp, err := a.doWithTimeout(r, a.opts.getTimeout)
+	logResponse(a.logger("RepositoryExists", log.Fields{"namespace": namespace, "repository": repository}), r, resp, err, start)
+	if err != nil {
+		return false, classifyTransportError(err)
+	}
+	defer resp.Body.Close()
+	code := resp.StatusCode
+	if code == http.StatusNotFound {
+		return false, nil
+	}
+	if code >= 300 || code < 200 {
+		return false, classifyStatusError(a.newError(resp))
+	}
+	return true, nil
+}
+
+// encodeRepository encodes the repository name as a path segment of the management API,
+// SWR requires the slashes in the repository name to be replaced with "$"
+func encodeRepository(repository string) string {
+	return strings.ReplaceAll(repository, "/", "$")
+}
+
+// ManifestExist check the manifest of Huawei SWR in the repository pushed to, see WithDestinationPrefix
 func (a *adapter) ManifestExist(repository, reference string) (exist bool, desc *distribution.Descriptor, err error) {
+	return a.manifestExist(a.destinationRepository(repository), reference)
+}
+
+// manifestExist checks the manifest in the repository of SWR as it is
+func (a *adapter) manifestExist(repository, reference string) (exist bool, desc *distribution.Descriptor, err error) {
 	token, err := getJwtToken(a, repository)
 	if err != nil {
 		return exist, nil, err
 	}
 
-	urls := fmt.Sprintf("%s/v2/%s/manifests/%s", a.registry.URL, repository, reference)
+	urls := a.registryURL("v2", repository, "manifests", pathSegment(reference))
 
 	r, err := http.NewRequest("GET", urls, nil)
 	if err != nil {
@@ -84,8 +678,13 @@ func (a *adapter) ManifestExist(repository, reference string) (exist bool, desc
 
 	r.Header.Add("content-type", "application/json; charset=utf-8")
 	r.Header.Add("Authorization", "Bearer "+token.Token)
+	for _, mediaType := range a.opts.manifestMediaTypes {
+		r.Header.Add("Accept", mediaType)
+	}
 
-	resp, err := a.oriClient.Do(r)
+	start := time.Now()
+	resp, err := a.doRegistry(r)
+	logResponse(a.logger("ManifestExist", log.Fields{"repository": repository, "reference": reference}), r, resp, err, start)
 	if err != nil {
 		return exist, nil, err
 	}
@@ -96,10 +695,9 @@ func (a *adapter) ManifestExist(repository, reference string) (exist bool, desc
 		if code == 404 {
 			return false, nil, nil
 		}
-		body, _ := io.ReadAll(resp.Body)
-		return exist, nil, fmt.Errorf("[%d][%s]", code, string(body))
+		return exist, nil, a.newError(resp)
 	}
-	body, err := io.ReadAll(resp.Body)
+	body, err := a.readBody(resp)
 	if err != nil {
 		return exist, nil, err
 	}
@@ -109,21 +707,125 @@ func (a *adapter) ManifestExist(repository, reference string) (exist bool, desc
 	if err != nil {
 		return exist, nil, err
 	}
+	dig := resp.Header.Get("Docker-Content-Digest")
+	// the transfer skips the artifact whose digest matches the source one, so the digest
+	// is calculated from the content when SWR or the gateway in front of it omits the header
+	if len(dig) == 0 {
+		dig = digest.FromBytes(body).String()
+	}
 	contentType := resp.Header.Get("Content-Type")
 	contentLen := resp.Header.Get("Content-Length")
 	lenth, _ := strconv.Atoi(contentLen)
 
-	return exist, &distribution.Descriptor{MediaType: contentType, Size: int64(lenth)}, nil
+	return exist, &distribution.Descriptor{Digest: digest.Digest(dig), MediaType: contentType, Size: int64(lenth)}, nil
+}
+
+// ManifestDetails describes a manifest stored in Huawei SWR
+type ManifestDetails struct {
+	Digest    digest.Digest
+	MediaType string
+	Size      int64
+	// Config is the digest of the image configuration, empty for the indexes
+	Config string
+	// Layers are the digests of the layers, or of the child manifests for the indexes
+	Layers []string
+	// Annotations are the OCI annotations of the manifest
+	Annotations map[string]string
+}
+
+// GetManifestByDigest retrieves the manifest "repository@dgt" from Huawei SWR and returns its media type,
+// size and the digests of the referenced blobs, both the Docker and OCI manifest types are accepted.
+// The content is verified against the digest, so the result can be trusted for the diffing
+func (a *adapter) GetManifestByDigest(repository string, dgt digest.Digest) (*ManifestDetails, error) {
+	if err := dgt.Validate(); err != nil {
+		return nil, err
+	}
+	token, err := getJwtToken(a, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := a.registryURL("v2", repository, "manifests", pathSegment(dgt.String()))
+	r, err := http.NewRequest(http.MethodGet, urls, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Add("Authorization", "Bearer "+token.Token)
+	for _, mediaType := range a.opts.manifestMediaTypes {
+		r.Header.Add("Accept", mediaType)
+	}
+
+	start := time.Now()
+	resp, err := a.doRegistry(r)
+	logResponse(a.logger("GetManifestByDigest", log.Fields{"repository": repository, "digest": dgt.String()}), r, resp, err, start)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	code := resp.StatusCode
+	if code >= 300 || code < 200 {
+		return nil, a.newError(resp)
+	}
+	body, err := a.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if actual := dgt.Algorithm().FromBytes(body); actual != dgt {
+		return nil, fmt.Errorf("the digest %s of the manifest %s doesn't match the requested one %s", actual, repository, dgt)
+	}
+
+	manifest := hwManifest{}
+	if err = json.Unmarshal(body, &manifest); err != nil {
+		return nil, err
+	}
+	details := &ManifestDetails{
+		Digest:      dgt,
+		MediaType:   manifest.MediaType,
+		Size:        int64(len(body)),
+		Config:      manifest.Config.Digest,
+		Annotations: manifest.Annotations,
+	}
+	// the schema2 and OCI manifests may omit the media type in the content
+	if len(details.MediaType) == 0 {
+		details.MediaType = resp.Header.Get("Content-Type")
+	}
+	for _, layer := range manifest.Layers {
+		details.Layers = append(details.Layers, layer.Digest)
+	}
+	for _, m := range manifest.Manifests {
+		details.Layers = append(details.Layers, m.Digest)
+	}
+	// the schema1 manifests list the layers as "fsLayers"
+	for _, layer := range manifest.FSLayers {
+		details.Layers = append(details.Layers, layer.BlobSum)
+	}
+	return details, nil
+}
+
+// PullManifest pulls the manifest from Huawei SWR, the media types configured by WithManifestMediaTypes
+// are accepted explicitly if the caller doesn't specify any, so SWR doesn't fall back to a manifest type
+// the transfer doesn't expect, e.g. for the OCI images
+func (a *adapter) PullManifest(repository, reference string, acceptedMediaTypes ...string) (distribution.Manifest, string, error) {
+	if len(acceptedMediaTypes) == 0 {
+		acceptedMediaTypes = a.opts.manifestMediaTypes
+	}
+	return a.Adapter.PullManifest(repository, reference, acceptedMediaTypes...)
 }
 
-// DeleteManifest delete the manifest of Huawei SWR
+// DeleteManifest delete the manifest of Huawei SWR, it's how the deletion of the artifacts is propagated by
+// the replications with the deletion enabled, so the repositories out of the scope set by WithDeletionScope
+// are refused with ErrDeletionNotAllowed, as are all the repositories until the scope is set
 func (a *adapter) DeleteManifest(repository, reference string) error {
+	repository = a.destinationRepository(repository)
+	if err := a.checkDeletionScope(repository); err != nil {
+		return err
+	}
 	token, err := getJwtToken(a, repository)
 	if err != nil {
 		return err
 	}
 
-	urls := fmt.Sprintf("%s/v2/%s/manifests/%s", a.registry.URL, repository, reference)
+	urls := a.registryURL("v2", repository, "manifests", pathSegment(reference))
 
 	r, err := http.NewRequest("DELETE", urls, nil)
 	if err != nil {
@@ -132,7 +834,9 @@ func (a *adapter) DeleteManifest(repository, reference string) error {
 	r.Header.Add("content-type", "application/json; charset=utf-8")
 	r.Header.Add("Authorization", "Bearer "+token.Token)
 
-	resp, err := a.oriClient.Do(r)
+	start := time.Now()
+	resp, err := a.doRegistry(r)
+	logResponse(a.logger("DeleteManifest", log.Fields{"repository": repository, "reference": reference}), r, resp, err, start)
 	if err != nil {
 		return err
 	}
@@ -140,13 +844,47 @@ func (a *adapter) DeleteManifest(repository, reference string) error {
 	defer resp.Body.Close()
 	code := resp.StatusCode
 	if code >= 300 || code < 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("[%d][%s]", code, string(body))
+		return a.newError(resp)
 	}
 
 	return nil
 }
 
+// repositoryListed returns whether the repository is discovered according to WithRepositoryAllowlist and
+// WithRepositoryDenylist, the denylist takes precedence
+func (a *adapter) repositoryListed(repository string) bool {
+	if _, ok := a.opts.repositoryDenylist[repository]; ok {
+		return false
+	}
+	if a.opts.repositoryAllowlist == nil {
+		return true
+	}
+	_, ok := a.opts.repositoryAllowlist[repository]
+	return ok
+}
+
+// checkDeletionScope returns ErrDeletionNotAllowed if the repository doesn't match any pattern of
+// WithDeletionScope, or no scope is set
+func (a *adapter) checkDeletionScope(repository string) error {
+	if len(a.opts.deletionScope) == 0 {
+		log.Warningf("refused to delete from the repository %s of Huawei SWR %s, no deletion scope is set",
+			repository, a.registry.URL)
+		return fmt.Errorf("%w: no deletion scope is set for the repository %s", ErrDeletionNotAllowed, repository)
+	}
+	for _, pattern := range a.opts.deletionScope {
+		matched, err := util.Match(pattern, repository)
+		if err != nil {
+			return err
+		}
+		if matched {
+			return nil
+		}
+	}
+	log.Warningf("refused to delete from the repository %s out of the deletion scope %v of Huawei SWR %s",
+		repository, a.opts.deletionScope, a.registry.URL)
+	return fmt.Errorf("%w: the repository %s is out of the deletion scope", ErrDeletionNotAllowed, repository)
+}
+
 func parseRepoQueryResultToResource(repo hwRepoQueryResult) *model.Resource {
 	var resource model.Resource
 	info := make(map[string]interface{})
@@ -202,7 +940,11 @@ type hwRepoQueryResult struct {
 }
 
 func getJwtToken(a *adapter, repository string) (token jwtToken, err error) {
-	urls := fmt.Sprintf("%s/swr/auth/v2/registry/auth?scope=repository:%s:push,pull", a.registry.URL, repository)
+	if cached, ok := a.tokens.get(repository); ok {
+		return cached, nil
+	}
+
+	urls := fmt.Sprintf("%s?scope=repository:%s:push,pull", a.registryURL("swr", "auth", "v2", "registry", "auth"), repository)
 
 	r, err := http.NewRequest("GET", urls, nil)
 	if err != nil {
@@ -211,7 +953,9 @@ func getJwtToken(a *adapter, repository string) (token jwtToken, err error) {
 
 	r.Header.Add("content-type", "application/json; charset=utf-8")
 
-	resp, err := a.client.Do(r)
+	start := time.Now()
+	resp, err := a.authClient.Do(r)
+	logResponse(a.logger("GetToken", log.Fields{"repository": repository}), r, resp, err, start)
 	if err != nil {
 		return token, err
 	}
@@ -219,10 +963,9 @@ func getJwtToken(a *adapter, repository string) (token jwtToken, err error) {
 	defer resp.Body.Close()
 	code := resp.StatusCode
 	if code >= 300 || code < 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return token, fmt.Errorf("[%d][%s]", code, string(body))
+		return token, a.newError(resp)
 	}
-	body, err := io.ReadAll(resp.Body)
+	body, err := a.readBody(resp)
 	if err != nil {
 		return token, err
 	}
@@ -230,9 +973,18 @@ func getJwtToken(a *adapter, repository string) (token jwtToken, err error) {
 	if err != nil {
 		return token, err
 	}
+	a.tokens.set(repository, token)
 	return token, nil
 }
 
+type hwTag struct {
+	Tag     string    `json:"Tag"`
+	Digest  string    `json:"digest"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
 type jwtToken struct {
 	Token     string    `json:"token" description:"token return to user"`
 	ExpiresIn int       `json:"expires_in" description:"describes token  will expires in how many seconds later"`
@@ -253,6 +1005,17 @@ type hwManifest struct {
 	// configuration.
 	Layers []hwDescriptor `json:"layers"`
 
+	// Annotations contains the OCI annotations of the manifest
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Manifests lists the child manifests of the indexes and manifest lists
+	Manifests []hwDescriptor `json:"manifests,omitempty"`
+
+	// FSLayers lists the layers of the schema1 manifests
+	FSLayers []struct {
+		BlobSum string `json:"blobSum"`
+	} `json:"fsLayers,omitempty"`
+
 	// summary keeps the summary infos
 	Summary hwManifestSummary `json:"-"`
 }
@@ -15,21 +15,36 @@
 package huawei
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	gock "gopkg.in/h2non/gock.v1"
 
 	"github.com/goharbor/harbor/src/pkg/reg/model"
+	"github.com/goharbor/harbor/src/testing/pkg/registry"
 )
 
 func mockRequest() *gock.Request {
 	return gock.New("https://swr.cn-north-1.myhuaweicloud.com")
 }
 
-func getHwMockAdapter(t *testing.T) *adapter {
+func getHwMockAdapter(t *testing.T, opts ...Option) *adapter {
 	hwRegistry := &model.Registry{
 		ID:          1,
 		Name:        "Huawei",
@@ -40,7 +55,7 @@ func getHwMockAdapter(t *testing.T) *adapter {
 		Insecure:    false,
 		Status:      "",
 	}
-	adp, err := newAdapter(hwRegistry)
+	adp, err := newAdapter(hwRegistry, opts...)
 	if err != nil {
 		t.Fatalf("Failed to call newAdapter(), reason=[%v]", err)
 	}
@@ -48,6 +63,7 @@ func getHwMockAdapter(t *testing.T) *adapter {
 
 	gock.InterceptClient(a.client.GetClient())
 	gock.InterceptClient(a.oriClient)
+	gock.InterceptClient(a.authClient.GetClient())
 
 	return a
 }
@@ -61,22 +77,599 @@ func mockGetJwtToken(repository string) {
 		})
 }
 
+func mockListRepositories(namespace string, offset int, repos []hwRepoQueryResult) {
+	condition := fmt.Sprintf("namespace::%s|center::self|offset::%d|limit::%d", namespace, offset, listPageSize)
+	mockRequest().Get("/dockyard/v2/repositories").
+		MatchParam("filter", regexp.QuoteMeta(condition)).
+		Reply(200).
+		JSON(repos)
+}
+
+func mockListTags(namespace, repository string, offset int, tags []hwTag) {
+	mockRequest().Get(fmt.Sprintf("/dockyard/v2/namespaces/%s/repositories/%s/tags", namespace, regexp.QuoteMeta(repository))).
+		MatchParam("offset", fmt.Sprintf("^%d$", offset)).
+		MatchParam("limit", fmt.Sprintf("^%d$", listPageSize)).
+		Reply(200).
+		JSON(tags)
+}
+
 func TestAdapter_FetchArtifacts(t *testing.T) {
 	defer gock.Off()
 	gock.Observe(gock.DumpRequest)
 
-	mockRequest().Get("/dockyard/v2/repositories").MatchParam("filter", "center::self").
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
 		BasicAuth("cn-north-1@IJYZLFBKBFN8LOUITAH", "f31e8e2b948265afdae32e83722a7705fd43e154585ff69e64108247750e5d").
 		Reply(200).
-		JSON([]hwRepoQueryResult{
-			{Name: "name1"},
-			{Name: "name2"},
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}, {Name: "ns2"}}})
+	mockListRepositories("ns1", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns1"},
+		{Name: "lib/base", NamespaceName: "ns1"},
+	})
+	mockListRepositories("ns2", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns2"},
+	})
+	mockListTags("ns1", "app", 0, []hwTag{{Tag: "v1"}, {Tag: "dev"}})
+	mockListTags("ns1", "lib$base", 0, []hwTag{{Tag: "v2"}})
+	mockListTags("ns2", "app", 0, []hwTag{{Tag: "v3"}})
+
+	a := getHwMockAdapter(t)
+	resources, err := a.FetchArtifacts(nil)
+	assert.NoError(t, err)
+	assert.Len(t, resources, 3)
+	assert.Equal(t, "ns1/app", resources[0].Metadata.Repository.Name)
+	assert.Len(t, resources[0].Metadata.Artifacts, 2)
+	assert.Equal(t, "ns1/lib/base", resources[1].Metadata.Repository.Name)
+	assert.Equal(t, "ns2/app", resources[2].Metadata.Repository.Name)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_FetchArtifactsConcurrently(t *testing.T) {
+	defer gock.Off()
+
+	var namespaces []hwNamespace
+	for i := 0; i < 50; i++ {
+		ns := fmt.Sprintf("ns%02d", i)
+		namespaces = append(namespaces, hwNamespace{Name: ns})
+		mockListRepositories(ns, 0, []hwRepoQueryResult{
+			{Name: "app", NamespaceName: ns},
+			{Name: "base", NamespaceName: ns},
 		})
+		mockListTags(ns, "app", 0, []hwTag{{Tag: "v1"}, {Tag: "v2"}})
+		mockListTags(ns, "base", 0, []hwTag{{Tag: ns}})
+	}
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: namespaces})
+
+	var fetched atomic.Int64
+	a := getMockAdapter(t, WithDiscoveryConcurrency(8), WithProgress(func(e ProgressEvent) {
+		fetched.Add(int64(e.Count))
+	}))
+	resources, err := a.FetchArtifacts(nil)
+	assert.NoError(t, err)
+	// the resources keep the order of the namespaces
+	if assert.Len(t, resources, 100) {
+		for i, ns := range namespaces {
+			assert.Equal(t, ns.Name+"/app", resources[2*i].Metadata.Repository.Name)
+			assert.Equal(t, []string{"v1", "v2"}, resources[2*i].Metadata.Vtags)
+			assert.Equal(t, ns.Name+"/base", resources[2*i+1].Metadata.Repository.Name)
+			assert.Equal(t, []string{ns.Name}, resources[2*i+1].Metadata.Vtags)
+		}
+	}
+	assert.Equal(t, int64(100), fetched.Load())
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_FetchArtifactsConcurrentlyFailure(t *testing.T) {
+	defer gock.Off()
+
+	var namespaces []hwNamespace
+	for i := 0; i < 20; i++ {
+		ns := fmt.Sprintf("ns%02d", i)
+		namespaces = append(namespaces, hwNamespace{Name: ns})
+		if i == 5 {
+			condition := fmt.Sprintf("namespace::%s|center::self|offset::0|limit::%d", ns, listPageSize)
+			mockRequest().Get("/dockyard/v2/repositories").
+				MatchParam("filter", regexp.QuoteMeta(condition)).
+				Reply(400).BodyString(`{"error_msg":"invalid namespace"}`)
+			continue
+		}
+		mockListRepositories(ns, 0, []hwRepoQueryResult{})
+	}
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: namespaces})
+
+	a := getMockAdapter(t, WithDiscoveryConcurrency(4))
+	_, err := a.FetchArtifacts(nil)
+	// the failure is returned rather than the cancellation of the other namespaces
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, context.Canceled))
+	assert.Contains(t, err.Error(), "invalid namespace")
+}
+
+func TestAdapter_FetchArtifactsContextCanceled(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}, {Name: "ns2"}}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := getMockAdapter(t, WithDiscoveryConcurrency(2)).FetchArtifactsContext(ctx, nil)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	assert.Equal(t, 1, newOptions(WithDiscoveryConcurrency(0)).discoveryConcurrency)
+	assert.Equal(t, 6, newOptions(WithSettings(map[string]string{SettingDiscoveryConcurrency: "6"})).discoveryConcurrency)
+}
+
+func TestAdapter_FetchArtifactsWithFilters(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}, {Name: "ns2"}}})
+	mockListRepositories("ns1", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns1"},
+		{Name: "lib/base", NamespaceName: "ns1"},
+	})
+	mockListRepositories("ns2", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns2"},
+	})
+	mockListTags("ns1", "app", 0, []hwTag{{Tag: "v1"}, {Tag: "dev"}})
 
 	a := getHwMockAdapter(t)
+	resources, err := a.FetchArtifacts([]*model.Filter{
+		{Type: model.FilterTypeName, Value: "ns1/app"},
+		{Type: model.FilterTypeTag, Value: "v*"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, resources, 1)
+	assert.Equal(t, "ns1/app", resources[0].Metadata.Repository.Name)
+	assert.Len(t, resources[0].Metadata.Artifacts, 1)
+	assert.Equal(t, []string{"v1"}, resources[0].Metadata.Artifacts[0].Tags)
+	assert.Equal(t, []string{"v1"}, resources[0].Metadata.Vtags)
+}
+
+func TestAdapter_FetchArtifactsWithRepositoryLists(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}, {Name: "ns2"}}})
+	mockListRepositories("ns1", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns1"},
+		{Name: "lib/base", NamespaceName: "ns1"},
+	})
+	mockListRepositories("ns2", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns2"},
+	})
+	mockListTags("ns1", "app", 0, []hwTag{{Tag: "v1"}})
+
+	// the denylist takes precedence over the allowlist
+	a := getMockAdapter(t,
+		WithRepositoryAllowlist("ns1/app", "ns1/lib/base"),
+		WithRepositoryDenylist("ns1/lib/base"))
+	resources, err := a.FetchArtifacts(nil)
+	assert.NoError(t, err)
+	assert.Len(t, resources, 1)
+	assert.Equal(t, "ns1/app", resources[0].Metadata.Repository.Name)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_FetchArtifactsWithRepositoryDenylist(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}}})
+	mockListRepositories("ns1", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns1"},
+		{Name: "lib/base", NamespaceName: "ns1"},
+	})
+	mockListTags("ns1", "lib$base", 0, []hwTag{{Tag: "v2"}})
+
+	a := getMockAdapter(t, WithRepositoryDenylist("ns1/app"))
 	resources, err := a.FetchArtifacts(nil)
 	assert.NoError(t, err)
-	assert.Len(t, resources, 2)
+	assert.Len(t, resources, 1)
+	assert.Equal(t, "ns1/lib/base", resources[0].Metadata.Repository.Name)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_FetchArtifactsWithSignatures(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}}})
+	mockListRepositories("ns1", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns1"},
+	})
+	mockListTags("ns1", "app", 0, []hwTag{
+		{Tag: "v1", Digest: "sha256:aaa"},
+		{Tag: "v2", Digest: "sha256:bbb"},
+		{Tag: "sha256-aaa.sig", Digest: "sha256:ccc"},
+		{Tag: "sha256-aaa.att", Digest: "sha256:ddd"},
+		// the signature of the image not selected
+		{Tag: "sha256-bbb.sig", Digest: "sha256:eee"},
+	})
+
+	a := getHwMockAdapter(t)
+	resources, err := a.FetchArtifacts([]*model.Filter{
+		{Type: model.FilterTypeTag, Value: "v1"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, resources, 1)
+	assert.Equal(t, []string{"v1", "sha256-aaa.sig", "sha256-aaa.att"}, resources[0].Metadata.Vtags)
+	assert.Len(t, resources[0].Metadata.Artifacts, 3)
+	assert.Equal(t, "sha256:ccc", resources[0].Metadata.Artifacts[1].Digest)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_FetchArtifactsWithReferrers(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	image := digest.FromString("image").String()
+	sbom, signature := digest.FromString("sbom").String(), digest.FromString("signature").String()
+	sbomSignature := digest.FromString("sbom signature").String()
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}}})
+	mockListRepositories("ns1", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns1"},
+	})
+	mockListTags("ns1", "app", 0, []hwTag{
+		{Tag: strings.Replace(image, ":", "-", 1) + ".sig", Digest: signature},
+		{Tag: "v1", Digest: image},
+	})
+	mockReferrers := func(subject string, referrers ...v1.Descriptor) {
+		mockGetJwtToken("ns1/app")
+		mockRequest().Get(fmt.Sprintf("/v2/ns1/app/referrers/%s", subject)).
+			Reply(200).
+			JSON(v1.Index{
+				Versioned: specs.Versioned{SchemaVersion: 2},
+				MediaType: v1.MediaTypeImageIndex,
+				Manifests: referrers,
+			})
+	}
+	mockReferrers(image,
+		v1.Descriptor{MediaType: v1.MediaTypeImageManifest, ArtifactType: "application/spdx+json", Digest: digest.Digest(sbom)},
+		// the signature is also tagged, it isn't duplicated
+		v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.Digest(signature)})
+	// the referrers of the referrers are discovered as well
+	mockReferrers(sbom, v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.Digest(sbomSignature)})
+	mockReferrers(sbomSignature)
+	mockReferrers(signature)
+
+	a := getMockAdapter(t, WithReferrers(true))
+	resources, err := a.FetchArtifacts([]*model.Filter{
+		{Type: model.FilterTypeTag, Value: "v1"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, resources, 1)
+	// the subject is followed by its referrers
+	var digests []string
+	for _, artifact := range resources[0].Metadata.Artifacts {
+		digests = append(digests, artifact.Digest)
+	}
+	assert.Equal(t, []string{image, sbom, sbomSignature, signature}, digests)
+	artifacts := resources[0].Metadata.Artifacts
+	assert.True(t, artifacts[1].IsAcc)
+	assert.Equal(t, []string{"v1"}, artifacts[1].ParentTags)
+	assert.Equal(t, []string{"v1"}, artifacts[2].ParentTags)
+	assert.NotEmpty(t, artifacts[3].Tags)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAppendReferrerArtifacts(t *testing.T) {
+	artifacts := []*model.Artifact{
+		{Digest: "sha256:a", Tags: []string{"v1"}},
+		{Digest: "sha256:b", Tags: []string{"v2"}},
+		{Digest: "sha256:a", Tags: []string{"latest"}},
+	}
+	assert.Equal(t, artifacts, appendReferrerArtifacts(artifacts, nil))
+
+	// the referrers cycling back to their subjects are placed once
+	result := appendReferrerArtifacts(artifacts, map[string][]*model.Artifact{
+		"sha256:a": {{Digest: "sha256:c", IsAcc: true}},
+		"sha256:c": {{Digest: "sha256:a", IsAcc: true}},
+	})
+	var digests []string
+	for _, artifact := range result {
+		digests = append(digests, artifact.Digest)
+	}
+	assert.Equal(t, []string{"sha256:a", "sha256:a", "sha256:c", "sha256:b"}, digests)
+}
+
+func TestAdapter_FetchArtifactsReferrersUnsupported(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}}})
+	mockListRepositories("ns1", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns1"},
+	})
+	mockListTags("ns1", "app", 0, []hwTag{
+		{Tag: "v1", Digest: "sha256:aaa"},
+		{Tag: "v2", Digest: "sha256:bbb"},
+		{Tag: "sha256-aaa.att", Digest: "sha256:ccc"},
+	})
+	mockGetJwtToken("ns1/app")
+	// the API isn't queried again for the other artifacts once it's unsupported
+	mockRequest().Get("/v2/ns1/app/referrers/sha256:aaa").
+		Reply(404)
+
+	a := getMockAdapter(t, WithReferrers(true))
+	resources, err := a.FetchArtifacts([]*model.Filter{
+		{Type: model.FilterTypeTag, Value: "v*"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, resources, 1)
+	assert.Equal(t, []string{"v1", "v2", "sha256-aaa.att"}, resources[0].Metadata.Vtags)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_FetchArtifactsWithSemverConstraint(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}}})
+	mockListRepositories("ns1", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns1"},
+	})
+	mockListTags("ns1", "app", 0, []hwTag{
+		{Tag: "v1.1.0"}, {Tag: "v1.2.0"}, {Tag: "1.3.1"}, {Tag: "latest"}, {Tag: "feature-x"},
+	})
+
+	a := getMockAdapter(t, WithSemverTagConstraint(">=1.2.0"))
+	resources, err := a.FetchArtifacts(nil)
+	assert.NoError(t, err)
+	assert.Len(t, resources, 1)
+	assert.Equal(t, []string{"v1.2.0", "1.3.1"}, resources[0].Metadata.Vtags)
+
+	_, err = newAdapter(&model.Registry{
+		URL:        "https://swr.cn-north-1.myhuaweicloud.com",
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+	}, WithSemverTagConstraint("not a constraint"))
+	assert.Error(t, err)
+}
+
+func TestAdapter_FetchArtifactsWithMediaTypeFilter(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	image, chart := digest.FromString("image").String(), digest.FromString("chart").String()
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}}})
+	mockListRepositories("ns1", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns1"},
+	})
+	mockListTags("ns1", "app", 0, []hwTag{
+		{Tag: "v1", Digest: image}, {Tag: "chart-1.0.0", Digest: chart},
+	})
+	mockGetJwtToken("ns1/app")
+	mockGetJwtToken("ns1/app")
+	mockRequest().Get(fmt.Sprintf("/v2/ns1/app/manifests/%s", image)).
+		Reply(200).
+		JSON(hwManifest{MediaType: schema2.MediaTypeManifest}).
+		SetHeader("Content-Type", schema2.MediaTypeManifest)
+	mockRequest().Get(fmt.Sprintf("/v2/ns1/app/manifests/%s", chart)).
+		Reply(200).
+		JSON(hwManifest{MediaType: v1.MediaTypeImageManifest}).
+		SetHeader("Content-Type", v1.MediaTypeImageManifest+"; charset=utf-8")
+
+	a := getMockAdapter(t, WithMediaTypeFilter("application/vnd.docker.distribution.manifest.*"))
+	resources, err := a.FetchArtifacts(nil)
+	assert.NoError(t, err)
+	assert.Len(t, resources, 1)
+	assert.Equal(t, []string{"v1"}, resources[0].Metadata.Vtags)
+	assert.True(t, gock.IsDone())
+
+	_, err = newAdapter(&model.Registry{
+		URL:        "https://swr.cn-north-1.myhuaweicloud.com",
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+	}, WithMediaTypeFilter("application/[invalid"))
+	assert.Error(t, err)
+}
+
+func TestAdapter_FetchArtifactsWithoutMediaTypeFilter(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}}})
+	mockListRepositories("ns1", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns1"},
+	})
+	mockListTags("ns1", "app", 0, []hwTag{{Tag: "v1"}, {Tag: "chart-1.0.0"}})
+
+	// no manifest is inspected without the filter
+	a := getMockAdapter(t)
+	resources, err := a.FetchArtifacts(nil)
+	assert.NoError(t, err)
+	assert.Len(t, resources, 1)
+	assert.Equal(t, []string{"v1", "chart-1.0.0"}, resources[0].Metadata.Vtags)
+}
+
+func TestAdapter_FetchArtifactsUpdatedSince(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before, after := since.Add(-time.Hour), since.Add(time.Hour)
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}}})
+	mockListRepositories("ns1", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns1", UpdatedAt: after},
+		// the tags of the stale repository aren't listed
+		{Name: "stale", NamespaceName: "ns1", UpdatedAt: before},
+	})
+	mockListTags("ns1", "app", 0, []hwTag{
+		{Tag: "old", Created: before, Updated: before},
+		{Tag: "new", Created: before, Updated: after},
+		{Tag: "unknown"},
+	})
+
+	a := getMockAdapter(t, WithUpdatedSince(since))
+	resources, err := a.FetchArtifacts(nil)
+	assert.NoError(t, err)
+	assert.Len(t, resources, 1)
+	assert.Equal(t, []string{"new", "unknown"}, resources[0].Metadata.Vtags)
+	times := resources[0].ExtendedInfo["tag_times"].(map[string]tagTime)
+	assert.Equal(t, tagTime{Created: before, Updated: after}, times["new"])
+	assert.NotContains(t, times, "old")
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_ListRepositoriesPagination(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	var page []hwRepoQueryResult
+	for i := 0; i < listPageSize; i++ {
+		page = append(page, hwRepoQueryResult{Name: fmt.Sprintf("repo%d", i), NamespaceName: "ns"})
+	}
+	mockListRepositories("ns", 0, page)
+	mockListRepositories("ns", listPageSize, []hwRepoQueryResult{{Name: "last", NamespaceName: "ns"}})
+
+	a := getHwMockAdapter(t)
+	repos, err := a.listRepositories(context.Background(), "ns")
+	assert.NoError(t, err)
+	assert.Len(t, repos, listPageSize+1)
+	assert.Equal(t, "last", repos[listPageSize].Name)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_ListAllRepositories(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}, {Name: "ns2"}}})
+	mockListRepositories("ns1", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns1"},
+		{Name: "lib/base", NamespaceName: "ns1"},
+	})
+	mockListRepositories("ns2", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns2"},
+	})
+
+	a := getHwMockAdapter(t)
+	repositories, err := a.ListAllRepositories(context.Background(), "**/app")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ns1/app", "ns2/app"}, repositories)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_WalkRepositoriesCanceled(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).
+		JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}, {Name: "ns2"}}})
+	mockListRepositories("ns1", 0, []hwRepoQueryResult{
+		{Name: "app", NamespaceName: "ns1"},
+		{Name: "lib/base", NamespaceName: "ns1"},
+	})
+
+	a := getHwMockAdapter(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	var walked []string
+	err := a.WalkRepositories(ctx, "", func(repository string) error {
+		walked = append(walked, repository)
+		cancel()
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	// the rest of the page is still consumed, but no more requests are sent after the cancellation
+	assert.Equal(t, []string{"ns1/app", "ns1/lib/base"}, walked)
+}
+
+func TestAdapter_ListTagsPaginationLimit(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// the endpoint always returns a full page
+	page := make([]hwTag, listPageSize)
+	for i := range page {
+		page[i] = hwTag{Tag: fmt.Sprintf("v%d", i)}
+	}
+	mockListTags("ns1", "app", 0, page)
+	mockListTags("ns1", "app", listPageSize, page)
+
+	a := getHwMockAdapter(t)
+	a.opts.maxPages = 2
+	_, err := a.listTags(context.Background(), "ns1", "app")
+	assert.ErrorIs(t, err, ErrPaginationLimitExceeded)
+
+	mockListRepositories("ns1", 0, make([]hwRepoQueryResult, listPageSize))
+	a.opts.maxPages = defaultMaxPages
+	a.opts.maxItems = listPageSize
+	_, err = a.listRepositories(context.Background(), "ns1")
+	assert.ErrorIs(t, err, ErrPaginationLimitExceeded)
+}
+
+func TestAdapter_ListTagsPages(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	fullPage := func(prefix string) []hwTag {
+		page := make([]hwTag, listPageSize)
+		for i := range page {
+			page[i] = hwTag{Tag: fmt.Sprintf("%s%d", prefix, i)}
+		}
+		return page
+	}
+	mockSequence("GET", "/dockyard/v2/namespaces/ns1/repositories/app/tags",
+		mockPages(fullPage("a"), fullPage("b"), []hwTag{{Tag: "last"}})...)
+
+	a := getHwMockAdapter(t)
+	tags, err := a.listTags(context.Background(), "ns1", "app")
+	assert.NoError(t, err)
+	assert.Len(t, tags, 2*listPageSize+1)
+	assert.Equal(t, "b0", tags[listPageSize].Tag)
+	assert.Equal(t, "last", tags[2*listPageSize].Tag)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_ListTagInfos(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	updated := created.Add(time.Hour)
+	mockListTags("ns1", "lib$base", 0, []hwTag{
+		{Tag: "v1", Digest: "sha256:aaa", Size: 1024, Created: created, Updated: updated},
+		{Tag: "v2", Digest: "sha256:bbb", Created: created},
+	})
+
+	a := getHwMockAdapter(t)
+	infos, err := a.ListTagInfos("ns1/lib/base")
+	assert.NoError(t, err)
+	assert.Equal(t, []TagInfo{
+		{Name: "v1", Digest: "sha256:aaa", Size: 1024, Pushed: updated},
+		{Name: "v2", Digest: "sha256:bbb", Pushed: created},
+	}, infos)
+
+	_, err = a.ListTagInfos("base")
+	assert.Error(t, err)
 }
 
 func TestAdapter_ManifestExist(t *testing.T) {
@@ -96,6 +689,239 @@ func TestAdapter_ManifestExist(t *testing.T) {
 	assert.True(t, exist)
 }
 
+func TestAdapter_ManifestExistManifestList(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	amd64 := digest.FromString("amd64")
+	arm64 := digest.FromString("arm64")
+	index, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{
+		{
+			Descriptor: distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: amd64, Size: 100},
+			Platform:   manifestlist.PlatformSpec{Architecture: "amd64", OS: "linux"},
+		},
+		{
+			Descriptor: distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: arm64, Size: 100},
+			Platform:   manifestlist.PlatformSpec{Architecture: "arm64", OS: "linux"},
+		},
+	})
+	assert.NoError(t, err)
+	_, payload, err := index.Payload()
+	assert.NoError(t, err)
+	indexDigest := digest.FromBytes(payload)
+
+	mockGetJwtToken("sundaymango_mango/multi-arch")
+	mockRequest().Get("/v2/sundaymango_mango/multi-arch/manifests/latest").
+		MatchHeader("Accept", manifestlist.MediaTypeManifestList).
+		Reply(200).
+		SetHeader("Content-Type", manifestlist.MediaTypeManifestList).
+		SetHeader("Docker-Content-Digest", indexDigest.String()).
+		BodyString(string(payload))
+	for _, child := range []digest.Digest{amd64, arm64} {
+		mockGetJwtToken("sundaymango_mango/multi-arch")
+		mockRequest().Get(fmt.Sprintf("/v2/sundaymango_mango/multi-arch/manifests/%s", child)).
+			Reply(404)
+	}
+
+	a := getHwMockAdapter(t)
+	exist, desc, err := a.ManifestExist("sundaymango_mango/multi-arch", "latest")
+	assert.NoError(t, err)
+	assert.True(t, exist)
+	assert.Equal(t, manifestlist.MediaTypeManifestList, desc.MediaType)
+	assert.Equal(t, indexDigest, desc.Digest)
+
+	// every platform specific manifest is referenced by the index and missing
+	// on SWR, so all of them are pushed rather than only the default platform
+	var missing []digest.Digest
+	for _, ref := range index.References() {
+		exist, _, err := a.ManifestExist("sundaymango_mango/multi-arch", ref.Digest.String())
+		assert.NoError(t, err)
+		if !exist {
+			missing = append(missing, ref.Digest)
+		}
+	}
+	assert.Equal(t, []digest.Digest{amd64, arm64}, missing)
+}
+
+func TestAdapter_ManifestExistArtifact(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// a SBOM stored as the generic OCI artifact
+	sbom := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"artifactType":"application/spdx+json",` +
+		`"config":{"mediaType":"application/vnd.oci.empty.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},` +
+		`"layers":[{"mediaType":"application/spdx+json","digest":"sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03","size":1024}]}`
+	mockGetJwtToken("sundaymango_mango/sbom")
+	mockRequest().Get("/v2/sundaymango_mango/sbom/manifests/v1").
+		MatchHeader("Accept", regexp.QuoteMeta(v1.MediaTypeImageManifest)).
+		Reply(200).
+		SetHeader("Content-Type", v1.MediaTypeImageManifest).
+		BodyString(sbom)
+
+	a := getHwMockAdapter(t)
+	exist, desc, err := a.ManifestExist("sundaymango_mango/sbom", "v1")
+	assert.NoError(t, err)
+	assert.True(t, exist)
+	assert.Equal(t, v1.MediaTypeImageManifest, desc.MediaType)
+}
+
+func TestAdapter_GetManifestByDigest(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	config := digest.FromString("config")
+	layer1 := digest.FromString("layer1")
+	layer2 := digest.FromString("layer2")
+	manifest, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    distribution.Descriptor{MediaType: schema2.MediaTypeImageConfig, Digest: config, Size: 10},
+		Layers: []distribution.Descriptor{
+			{MediaType: schema2.MediaTypeLayer, Digest: layer1, Size: 100},
+			{MediaType: schema2.MediaTypeLayer, Digest: layer2, Size: 200},
+		},
+	})
+	assert.NoError(t, err)
+	_, payload, err := manifest.Payload()
+	assert.NoError(t, err)
+	manifestDigest := digest.FromBytes(payload)
+
+	mockGetJwtToken("sundaymango_mango/app")
+	mockRequest().Get(fmt.Sprintf("/v2/sundaymango_mango/app/manifests/%s", manifestDigest)).
+		MatchHeader("Accept", v1.MediaTypeImageManifest).
+		Reply(200).
+		SetHeader("Content-Type", schema2.MediaTypeManifest).
+		BodyString(string(payload))
+
+	a := getHwMockAdapter(t)
+	details, err := a.GetManifestByDigest("sundaymango_mango/app", manifestDigest)
+	assert.NoError(t, err)
+	assert.Equal(t, manifestDigest, details.Digest)
+	assert.Equal(t, schema2.MediaTypeManifest, details.MediaType)
+	assert.Equal(t, int64(len(payload)), details.Size)
+	assert.Equal(t, config.String(), details.Config)
+	assert.Equal(t, []string{layer1.String(), layer2.String()}, details.Layers)
+
+	// the content doesn't match the digest
+	other := digest.FromString("other")
+	mockGetJwtToken("sundaymango_mango/app")
+	mockRequest().Get(fmt.Sprintf("/v2/sundaymango_mango/app/manifests/%s", other)).
+		Reply(200).
+		BodyString(string(payload))
+	_, err = a.GetManifestByDigest("sundaymango_mango/app", other)
+	assert.Error(t, err)
+
+	_, err = a.GetManifestByDigest("sundaymango_mango/app", "latest")
+	assert.Error(t, err)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_GetManifestByDigestIndex(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	amd64 := digest.FromString("amd64")
+	payload := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","manifests":[{"mediaType":"%s","digest":"%s","size":100}]}`,
+		v1.MediaTypeImageIndex, v1.MediaTypeImageManifest, amd64)
+	indexDigest := digest.FromString(payload)
+
+	mockGetJwtToken("sundaymango_mango/multi-arch")
+	mockRequest().Get(fmt.Sprintf("/v2/sundaymango_mango/multi-arch/manifests/%s", indexDigest)).
+		MatchHeader("Accept", v1.MediaTypeImageIndex).
+		Reply(200).
+		SetHeader("Content-Type", v1.MediaTypeImageIndex).
+		BodyString(payload)
+
+	a := getHwMockAdapter(t)
+	details, err := a.GetManifestByDigest("sundaymango_mango/multi-arch", indexDigest)
+	assert.NoError(t, err)
+	assert.Equal(t, v1.MediaTypeImageIndex, details.MediaType)
+	assert.Empty(t, details.Config)
+	assert.Equal(t, []string{amd64.String()}, details.Layers)
+}
+
+func TestAdapter_ManifestExistWithoutDigestHeader(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	payload := `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`
+	mockGetJwtToken("sundaymango_mango/app")
+	mockRequest().Get("/v2/sundaymango_mango/app/manifests/v1").
+		Reply(200).
+		SetHeader("Content-Type", schema2.MediaTypeManifest).
+		BodyString(payload)
+
+	a := getHwMockAdapter(t)
+	exist, desc, err := a.ManifestExist("sundaymango_mango/app", "v1")
+	assert.NoError(t, err)
+	assert.True(t, exist)
+	assert.Equal(t, digest.FromString(payload), desc.Digest)
+}
+
+func TestAdapter_AnnotationsRoundTrip(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	annotations := map[string]string{
+		"org.opencontainers.image.source":   "https://github.com/goharbor/harbor",
+		"org.opencontainers.image.revision": "abc123",
+	}
+	payload, err := json.Marshal(v1.Manifest{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		MediaType:   v1.MediaTypeImageManifest,
+		Config:      v1.Descriptor{MediaType: v1.MediaTypeImageConfig, Digest: digest.FromString("config"), Size: 10},
+		Annotations: annotations,
+	})
+	assert.NoError(t, err)
+	manifestDigest := digest.FromBytes(payload)
+
+	a := getHwMockAdapter(t)
+	client := &registry.Client{}
+	a.Adapter.Client = client
+	var pushed []byte
+	client.On("PushManifest", "sundaymango_mango/app", "v1", v1.MediaTypeImageManifest, mock.Anything).
+		Run(func(args mock.Arguments) { pushed = args.Get(3).([]byte) }).
+		Return(manifestDigest.String(), nil)
+	_, err = a.PushManifest("sundaymango_mango/app", "v1", v1.MediaTypeImageManifest, payload)
+	assert.NoError(t, err)
+
+	// the manifest is pushed as is, so the annotations are read back
+	mockGetJwtToken("sundaymango_mango/app")
+	mockRequest().Get(fmt.Sprintf("/v2/sundaymango_mango/app/manifests/%s", manifestDigest)).
+		Reply(200).
+		SetHeader("Content-Type", v1.MediaTypeImageManifest).
+		BodyString(string(pushed))
+	details, err := a.GetManifestByDigest("sundaymango_mango/app", manifestDigest)
+	assert.NoError(t, err)
+	assert.Equal(t, annotations, details.Annotations)
+}
+
+func TestAdapter_PullManifest(t *testing.T) {
+	a := getHwMockAdapter(t)
+	client := &registry.Client{}
+	a.Adapter.Client = client
+	client.On("PullManifest", "ns/app", "v1",
+		v1.MediaTypeImageIndex, manifestlist.MediaTypeManifestList, v1.MediaTypeImageManifest,
+		schema2.MediaTypeManifest, schema1.MediaTypeSignedManifest, schema1.MediaTypeManifest).
+		Return(nil, "sha256:default", nil)
+	client.On("PullManifest", "ns/app", "v1", v1.MediaTypeImageManifest).
+		Return(nil, "sha256:oci", nil)
+
+	_, dgt, err := a.PullManifest("ns/app", "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:default", dgt)
+	// the media types of the caller are respected
+	_, dgt, err = a.PullManifest("ns/app", "v1", v1.MediaTypeImageManifest)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:oci", dgt)
+
+	a = getMockAdapter(t, WithManifestMediaTypes(v1.MediaTypeImageManifest))
+	a.Adapter.Client = client
+	_, dgt, err = a.PullManifest("ns/app", "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:oci", dgt)
+}
+
 func TestAdapter_DeleteManifest(t *testing.T) {
 	defer gock.Off()
 	gock.Observe(gock.DumpRequest)
@@ -103,7 +929,61 @@ func TestAdapter_DeleteManifest(t *testing.T) {
 	mockGetJwtToken("sundaymango_mango/hello-world")
 	mockRequest().Delete("/v2/sundaymango_mango/hello-world/manifests/latest").Reply(200)
 
-	a := getHwMockAdapter(t)
+	a := getHwMockAdapter(t, WithDeletionScope("**"))
 	err := a.DeleteManifest("sundaymango_mango/hello-world", "latest")
 	assert.NoError(t, err)
 }
+
+func TestAdapter_DeleteManifestScope(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockGetJwtToken("mirror/app")
+	mockRequest().Delete("/v2/mirror/app/manifests/v1").Reply(202)
+
+	a := getMockAdapter(t, WithDeletionScope("mirror/**"))
+	assert.NoError(t, a.DeleteManifest("mirror/app", "v1"))
+	// nothing is sent for the repositories out of the scope
+	err := a.DeleteManifest("team/app", "v1")
+	assert.True(t, errors.Is(err, ErrDeletionNotAllowed))
+	assert.True(t, gock.IsDone())
+
+	// nothing is deleted until the scope is set
+	err = getMockAdapter(t).DeleteManifest("mirror/app", "v1")
+	assert.True(t, errors.Is(err, ErrDeletionNotAllowed))
+
+	_, err = newAdapter(&model.Registry{
+		URL:        "https://swr.cn-north-1.myhuaweicloud.com",
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+	}, WithDeletionScope("mirror/[invalid"))
+	assert.Error(t, err)
+}
+
+func TestAdapter_RepositoryExists(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/ns1/repositories/team\\$app").
+		Reply(200).BodyString(`{"name":"team/app","namespace":"ns1"}`)
+	mockRequest().Get("/dockyard/v2/namespaces/ns1/repositories/missing").
+		Reply(404).BodyString(`{"errors":"repository not found"}`)
+	// the namespace doesn't exist
+	mockRequest().Get("/dockyard/v2/namespaces/ns2/repositories/app").
+		Reply(404).BodyString(`{"errors":"namespace not found"}`)
+	mockRequest().Get("/dockyard/v2/namespaces/ns3/repositories/app").
+		Reply(500)
+
+	a := getHwMockAdapter(t)
+	exist, err := a.RepositoryExists("ns1", "team/app")
+	assert.NoError(t, err)
+	assert.True(t, exist)
+	exist, err = a.RepositoryExists("ns1", "missing")
+	assert.NoError(t, err)
+	assert.False(t, exist)
+	exist, err = a.RepositoryExists("ns2", "app")
+	assert.NoError(t, err)
+	assert.False(t, exist)
+	_, err = a.RepositoryExists("ns3", "app")
+	assert.ErrorIs(t, err, ErrServer)
+	assert.True(t, gock.IsDone())
+}
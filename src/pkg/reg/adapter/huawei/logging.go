@@ -0,0 +1,78 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/goharbor/harbor/src/lib/log"
+)
+
+// logger returns the logger carrying the host of the registry, the operation, e.g. "CreateNamespace",
+// and the extra fields identifying the resources of the operation, e.g. the namespace. The fields end
+// up in the centralized logging, so they must never carry the credentials
+func (a *adapter) logger(operation string, fields log.Fields) *log.Logger {
+	base := a.baseLogger
+	if base == nil {
+		base = log.DefaultLogger()
+	}
+	f := log.Fields{"operation": operation}
+	if u, err := url.Parse(a.registry.URL); err == nil {
+		f["registry"] = u.Host
+	}
+	for k, v := range fields {
+		f[k] = v
+	}
+	return base.WithFields(f)
+}
+
+// withOperation returns the context carrying the logger of the operation, which is picked up by
+// the requests sent with the context, see logger
+func (a *adapter) withOperation(ctx context.Context, operation string, fields log.Fields) context.Context {
+	return log.WithLogger(ctx, a.logger(operation, fields))
+}
+
+// logResponse logs the method, the path, the status code and the duration of the request sent
+// since start, and the request ID if it's sent, see WithRequestIDs. The query and the other headers
+// are left out as they may carry the tokens. The transport errors and the 5xx responses are logged
+// as warnings, the others as debug messages, as the 4xx ones are expected by some operations, e.g.
+// checking whether a manifest exists
+func logResponse(logger *log.Logger, req *http.Request, resp *http.Response, err error, start time.Time) {
+	fields := log.Fields{
+		"method":   req.Method,
+		"path":     req.URL.Path,
+		"duration": time.Since(start).Round(time.Millisecond),
+	}
+	id := req.Header.Get(requestIDHeader)
+	if len(id) > 0 {
+		fields["requestID"] = id
+	}
+	if err != nil {
+		logger.WithFields(fields).Warningf("request to huawei SWR failed: %v", err)
+		return
+	}
+	fields["statusCode"] = resp.StatusCode
+	if echoed := resp.Header.Get(requestIDHeader); len(id) > 0 && len(echoed) > 0 && echoed != id {
+		logger.WithFields(fields).Warningf("huawei SWR echoed the request id %s instead of %s", echoed, id)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		logger.WithFields(fields).Warningf("request to huawei SWR failed with status %d", resp.StatusCode)
+		return
+	}
+	logger.WithFields(fields).Debugf("request to huawei SWR finished")
+}
@@ -0,0 +1,59 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gock "gopkg.in/h2non/gock.v1"
+
+	"github.com/goharbor/harbor/src/lib/log"
+)
+
+func TestAdapter_StructuredLogs(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Post("/dockyard/v2/namespaces").
+		Reply(201)
+	mockRequest().Get("/dockyard/v2/namespaces/ns1/repositories/app/tags").
+		Reply(500)
+
+	buf := &bytes.Buffer{}
+	a := getMockAdapter(t)
+	a.baseLogger = log.New(buf, log.NewTextFormatter(), log.DebugLevel)
+
+	assert.NoError(t, a.CreateNamespace("ns1", NamespaceAuthPrivate))
+	out := buf.String()
+	assert.Contains(t, out, `operation="CreateNamespace"`)
+	assert.Contains(t, out, `namespace="ns1"`)
+	assert.Contains(t, out, `registry="swr.cn-north-1.myhuaweicloud.com"`)
+	assert.Contains(t, out, `method="POST"`)
+	assert.Contains(t, out, `statusCode="201"`)
+	assert.Contains(t, out, "[DEBUG]")
+	assert.NotContains(t, out, "AQR6NF5G2MQ1V7U4FCD")
+
+	buf.Reset()
+	_, err := a.listTags(context.Background(), "ns1", "app")
+	assert.Error(t, err)
+	out = buf.String()
+	assert.Contains(t, out, `operation="ListTags"`)
+	assert.Contains(t, out, `repository="app"`)
+	assert.Contains(t, out, `statusCode="500"`)
+	assert.Contains(t, out, "[WARNING]")
+}
@@ -0,0 +1,157 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+// mockResponse is a response of the sequence registered by mockSequence
+type mockResponse struct {
+	status int
+	// body is replied as is if it's a string, or encoded as JSON otherwise
+	body interface{}
+	// params are the query params the request must match, the values are regular expressions
+	params map[string]string
+}
+
+// mockSequence registers the responses replied in order to the requests sent with the method to the path,
+// each response is replied once, e.g. the transient failures before the success of a retried request or
+// the pages of a listing, see mockPages. The requests beyond the sequence aren't matched, so the loops of
+// the adapter sending more requests than expected fail and gock.IsDone tells whether all are consumed
+func mockSequence(method, path string, responses ...mockResponse) {
+	for _, r := range responses {
+		req := mockRequest().Path(path)
+		req.Method = strings.ToUpper(method)
+		if len(r.params) > 0 {
+			req.MatchParams(r.params)
+		}
+		resp := req.Reply(r.status)
+		switch body := r.body.(type) {
+		case nil:
+		case string:
+			resp.BodyString(body)
+		default:
+			resp.JSON(body)
+		}
+	}
+}
+
+// mockPages returns the responses of the listing paginated by the "offset" and "limit" params, one per page
+// in order, e.g. the listing of the tags
+func mockPages(pages ...interface{}) []mockResponse {
+	responses := make([]mockResponse, 0, len(pages))
+	for i, page := range pages {
+		responses = append(responses, mockResponse{
+			status: 200,
+			body:   page,
+			params: map[string]string{
+				"offset": fmt.Sprintf("^%d$", i*listPageSize),
+				"limit":  fmt.Sprintf("^%d$", listPageSize),
+			},
+		})
+	}
+	return responses
+}
+
+// mockRegistry is a registry API served over TLS with the bearer auth for the requests sent by the native
+// registry client of the adapter, i.e. the blobs, the manifests and the tokens, which gock can't intercept
+// as the client isn't exposed. The requests received are recorded
+type mockRegistry struct {
+	*httptest.Server
+	sync.Mutex
+	requests []*http.Request
+}
+
+// newMockRegistry starts the mock registry once it's configured, e.g. the TLS config, the server is
+// closed once the test ends
+func newMockRegistry(t testing.TB, configure ...func(*httptest.Server)) *mockRegistry {
+	m := &mockRegistry{}
+	m.Server = httptest.NewUnstartedServer(http.HandlerFunc(m.serve))
+	m.EnableHTTP2 = true
+	for _, c := range configure {
+		c(m.Server)
+	}
+	m.StartTLS()
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockRegistry) serve(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.Copy(io.Discard, r.Body)
+	m.Lock()
+	m.requests = append(m.requests, r)
+	m.Unlock()
+	if r.URL.Path == "/token" {
+		_, _ = fmt.Fprintf(w, `{"token":"token","expires_in":3600,"issued_at":"%s"}`, time.Now().UTC().Format(time.RFC3339))
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="swr"`, m.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/blobs/uploads/"):
+		w.Header().Set("Location", r.URL.Path+"session")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/blobs/uploads/"):
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/"):
+		w.Header().Set("Docker-Content-Digest", "sha256:"+strings.Repeat("a", 64))
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/"):
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		_, _ = w.Write([]byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{},"layers":[]}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// received returns the requests received with the method whose path contains the part, e.g. "/manifests/"
+func (m *mockRegistry) received(method, part string) []*http.Request {
+	m.Lock()
+	defer m.Unlock()
+	var requests []*http.Request
+	for _, r := range m.requests {
+		if r.Method == method && strings.Contains(r.URL.Path, part) {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// adapter creates the adapter of the mock registry, whose certificate isn't verified
+func (m *mockRegistry) adapter(t testing.TB, opts ...Option) *adapter {
+	a, err := newAdapter(&model.Registry{
+		Type:       model.RegistryTypeHuawei,
+		URL:        m.URL,
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+		Insecure:   true,
+	}, opts...)
+	require.NoError(t, err)
+	return a.(*adapter)
+}
@@ -0,0 +1,317 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/docker/distribution"
+
+	"github.com/goharbor/harbor/src/lib/log"
+	adp "github.com/goharbor/harbor/src/pkg/reg/adapter"
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+// RegionError is the failure of an operation in one of the regions set by WithRegions
+type RegionError struct {
+	Region string
+	Err    error
+}
+
+// Error ...
+func (e *RegionError) Error() string {
+	return fmt.Sprintf("region %s: %v", e.Region, e.Err)
+}
+
+// Unwrap ...
+func (e *RegionError) Unwrap() error {
+	return e.Err
+}
+
+// MultiRegionError is returned when an operation fans out to the regions set by WithRegions and fails
+// in some of them, the operation is still done in the regions not listed
+type MultiRegionError struct {
+	Errors []*RegionError
+}
+
+// Error ...
+func (e *MultiRegionError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("failed in %d region(s): %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap makes the MultiRegionError match the errors of the regions, e.g. ErrServer
+func (e *MultiRegionError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// errAllRegionsFailed stops reading the blob once the push fails in all the regions
+var errAllRegionsFailed = errors.New("the push failed in all the regions")
+
+var (
+	_ adp.Adapter          = (*multiRegionAdapter)(nil)
+	_ adp.ArtifactRegistry = (*multiRegionAdapter)(nil)
+)
+
+type regionAdapter struct {
+	*adapter
+	region string
+}
+
+// multiRegionAdapter pushes to all the regions set by WithRegions, e.g. for the disaster recovery, while
+// the reads, e.g. FetchArtifacts and ListNamespaces, are served by the first region. The failure of a
+// region doesn't abort the others, it's reported by MultiRegionError
+type multiRegionAdapter struct {
+	*adapter
+	regions []*regionAdapter
+	// missing are the regions BlobExist reports missing the blob per "repository@digest", which
+	// PushBlob pushes the blob to
+	mu      sync.Mutex
+	missing map[string][]int
+}
+
+func newMultiRegionAdapter(registry *model.Registry, regions []string, opts []Option) (*multiRegionAdapter, error) {
+	m := &multiRegionAdapter{missing: map[string][]int{}}
+	for _, region := range regions {
+		a, err := newAdapter(registry, append(append([]Option{}, opts...), WithRegions(), WithRegion(region))...)
+		if err != nil {
+			return nil, fmt.Errorf("region %s: %w", region, err)
+		}
+		m.regions = append(m.regions, &regionAdapter{adapter: a.(*adapter), region: region})
+	}
+	m.adapter = m.regions[0].adapter
+	return m, nil
+}
+
+// fanOut runs the operation in all the regions concurrently and aggregates the failures
+func (m *multiRegionAdapter) fanOut(op func(i int, a *adapter) error) error {
+	errs := make([]error, len(m.regions))
+	var wg sync.WaitGroup
+	for i := range m.regions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = op(i, m.regions[i].adapter)
+		}(i)
+	}
+	wg.Wait()
+	return m.aggregate(errs)
+}
+
+// aggregate builds the MultiRegionError from the errors indexed by the regions, nil if none failed
+func (m *multiRegionAdapter) aggregate(errs []error) error {
+	var failed []*RegionError
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		log.Warningf("the operation failed in the region %s of Huawei SWR: %v", m.regions[i].region, err)
+		failed = append(failed, &RegionError{Region: m.regions[i].region, Err: err})
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &MultiRegionError{Errors: failed}
+}
+
+// HealthCheck reports healthy only if all the regions are healthy
+func (m *multiRegionAdapter) HealthCheck() (string, error) {
+	var mu sync.Mutex
+	status := model.Healthy
+	err := m.fanOut(func(_ int, a *adapter) error {
+		s, err := a.HealthCheck()
+		if s != model.Healthy {
+			mu.Lock()
+			status = model.Unhealthy
+			mu.Unlock()
+		}
+		return err
+	})
+	return status, err
+}
+
+// PrepareForPush creates the namespaces in all the regions
+func (m *multiRegionAdapter) PrepareForPush(resources []*model.Resource) error {
+	return m.fanOut(func(_ int, a *adapter) error {
+		return a.PrepareForPush(resources)
+	})
+}
+
+// BlobExist reports whether the blob exists in all the regions, the regions missing it are remembered
+// for PushBlob. The region failing the check is taken as missing the blob, so it fails in PushBlob
+// rather than skipping the blob in the other regions
+func (m *multiRegionAdapter) BlobExist(repository, digest string) (bool, error) {
+	exist := make([]bool, len(m.regions))
+	_ = m.fanOut(func(i int, a *adapter) error {
+		ok, err := a.BlobExist(repository, digest)
+		exist[i] = ok && err == nil
+		return err
+	})
+	var missing []int
+	for i, ok := range exist {
+		if !ok {
+			missing = append(missing, i)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(missing) == 0 {
+		delete(m.missing, repository+"@"+digest)
+		return true, nil
+	}
+	m.missing[repository+"@"+digest] = missing
+	return false, nil
+}
+
+// ManifestExist reports whether the manifest exists in all the regions with the same digest, so the
+// manifest missing or differing in any region is pushed again. The region failing the check is taken
+// as missing the manifest like BlobExist, the descriptor of the first region is returned
+func (m *multiRegionAdapter) ManifestExist(repository, reference string) (bool, *distribution.Descriptor, error) {
+	exist := make([]bool, len(m.regions))
+	descs := make([]*distribution.Descriptor, len(m.regions))
+	_ = m.fanOut(func(i int, a *adapter) error {
+		ok, desc, err := a.ManifestExist(repository, reference)
+		exist[i], descs[i] = ok && err == nil && desc != nil, desc
+		return err
+	})
+	for i, ok := range exist {
+		if !ok || descs[i].Digest != descs[0].Digest {
+			return false, nil, nil
+		}
+	}
+	return true, descs[0], nil
+}
+
+// PushBlob streams the blob to the regions missing it, or all the regions if BlobExist isn't called
+// before. The blob is read once and written to every region, the regions failing in the middle stop
+// receiving it without interrupting the others
+func (m *multiRegionAdapter) PushBlob(repository, digest string, size int64, blob io.Reader) error {
+	m.mu.Lock()
+	targets := m.missing[repository+"@"+digest]
+	delete(m.missing, repository+"@"+digest)
+	m.mu.Unlock()
+	if len(targets) == 0 {
+		for i := range m.regions {
+			targets = append(targets, i)
+		}
+	}
+
+	errs := make([]error, len(m.regions))
+	writers := make([]*io.PipeWriter, 0, len(targets))
+	var wg sync.WaitGroup
+	for _, i := range targets {
+		pr, pw := io.Pipe()
+		writers = append(writers, pw)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = m.regions[i].adapter.PushBlob(repository, digest, size, pr)
+			// the writes to the region returned already fail rather than block
+			pr.CloseWithError(io.ErrClosedPipe)
+		}(i)
+	}
+	_, err := io.Copy(&fanOutWriter{writers: writers}, blob)
+	for _, w := range writers {
+		w.CloseWithError(err)
+	}
+	wg.Wait()
+	if err != nil && !errors.Is(err, errAllRegionsFailed) {
+		return fmt.Errorf("failed to read the blob %s: %w", digest, err)
+	}
+	return m.aggregate(errs)
+}
+
+// PushBlobChunk isn't supported, the upload locations of the chunks differ per region
+func (m *multiRegionAdapter) PushBlobChunk(_, _ string, _ int64, _ io.Reader, _, _ int64, _ string) (string, int64, error) {
+	return "", -1, errors.New("the chunked upload isn't supported with multiple regions")
+}
+
+// PushManifest pushes the manifest to all the regions, the digest returned by the first region
+// succeeding is returned
+func (m *multiRegionAdapter) PushManifest(repository, reference, mediaType string, payload []byte) (string, error) {
+	digests := make([]string, len(m.regions))
+	err := m.fanOut(func(i int, a *adapter) error {
+		dgt, err := a.PushManifest(repository, reference, mediaType, payload)
+		digests[i] = dgt
+		return err
+	})
+	for _, dgt := range digests {
+		if len(dgt) > 0 {
+			return dgt, err
+		}
+	}
+	return "", err
+}
+
+// DeleteManifest deletes the manifest in all the regions
+func (m *multiRegionAdapter) DeleteManifest(repository, reference string) error {
+	return m.fanOut(func(_ int, a *adapter) error {
+		return a.DeleteManifest(repository, reference)
+	})
+}
+
+// DeleteTag deletes the tag in all the regions
+func (m *multiRegionAdapter) DeleteTag(repository, tag string) error {
+	return m.fanOut(func(_ int, a *adapter) error {
+		return a.DeleteTag(repository, tag)
+	})
+}
+
+// MountBlob mounts the blob in all the regions
+func (m *multiRegionAdapter) MountBlob(srcRepository, digest, dstRepository string) error {
+	return m.fanOut(func(_ int, a *adapter) error {
+		return a.MountBlob(srcRepository, digest, dstRepository)
+	})
+}
+
+// Close releases the connections of all the regions
+func (m *multiRegionAdapter) Close() error {
+	for _, r := range m.regions {
+		_ = r.adapter.Close()
+	}
+	return nil
+}
+
+// fanOutWriter writes to all the writers, the ones failing are dropped and the write only fails
+// once all of them fail
+type fanOutWriter struct {
+	writers []*io.PipeWriter
+}
+
+// Write ...
+func (w *fanOutWriter) Write(p []byte) (int, error) {
+	active := w.writers[:0]
+	for _, writer := range w.writers {
+		if _, err := writer.Write(p); err == nil {
+			active = append(active, writer)
+		}
+	}
+	w.writers = active
+	if len(active) == 0 {
+		return 0, errAllRegionsFailed
+	}
+	return len(p), nil
+}
@@ -0,0 +1,194 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gock "gopkg.in/h2non/gock.v1"
+
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+	"github.com/goharbor/harbor/src/testing/pkg/registry"
+)
+
+// regionClient is the registry client of a region, which fails the pushes if err is set
+type regionClient struct {
+	*registry.Client
+	mu     sync.Mutex
+	exist  bool
+	err    error
+	pushed string
+}
+
+func (c *regionClient) BlobExist(_, _ string) (bool, error) {
+	return c.exist, nil
+}
+
+func (c *regionClient) PushBlob(_, _ string, _ int64, blob io.Reader) error {
+	if c.err != nil {
+		return c.err
+	}
+	data, err := io.ReadAll(blob)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pushed = string(data)
+	return err
+}
+
+func (c *regionClient) PushManifest(_, _, _ string, _ []byte) (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	return "sha256:manifest", nil
+}
+
+func getMultiRegionAdapter(t *testing.T, opts ...Option) (*multiRegionAdapter, *regionClient, *regionClient) {
+	adp, err := newAdapter(&model.Registry{
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+	}, append(opts, WithRegions("cn-north-1", "cn-east-3"))...)
+	require.NoError(t, err)
+	m := adp.(*multiRegionAdapter)
+	var clients []*regionClient
+	for _, r := range m.regions {
+		gock.InterceptClient(r.client.GetClient())
+		gock.InterceptClient(r.oriClient)
+		gock.InterceptClient(r.authClient.GetClient())
+		client := &regionClient{}
+		r.Adapter.Client = client
+		clients = append(clients, client)
+	}
+	return m, clients[0], clients[1]
+}
+
+func TestAdapter_MultiRegion(t *testing.T) {
+	m, north, east := getMultiRegionAdapter(t)
+	assert.Equal(t, "https://swr.cn-north-1.myhuaweicloud.com", m.registry.URL)
+	assert.Equal(t, "https://swr.cn-east-3.myhuaweicloud.com", m.regions[1].registry.URL)
+
+	// the blob is only pushed to the region missing it
+	north.exist = true
+	exist, err := m.BlobExist("ns/app", "sha256:layer")
+	assert.NoError(t, err)
+	assert.False(t, exist)
+	assert.NoError(t, m.PushBlob("ns/app", "sha256:layer", 5, strings.NewReader("layer")))
+	assert.Empty(t, north.pushed)
+	assert.Equal(t, "layer", east.pushed)
+
+	// the failed region doesn't interrupt the others
+	north.exist, east.pushed = false, ""
+	north.err = errors.New("connection reset")
+	content := strings.Repeat("layer content ", 10000)
+	err = m.PushBlob("ns/app", "sha256:other", int64(len(content)), strings.NewReader(content))
+	var multiErr *MultiRegionError
+	require.True(t, errors.As(err, &multiErr))
+	require.Len(t, multiErr.Errors, 1)
+	assert.Equal(t, "cn-north-1", multiErr.Errors[0].Region)
+	assert.Contains(t, err.Error(), "connection reset")
+	assert.Equal(t, content, east.pushed)
+
+	dgt, err := m.PushManifest("ns/app", "v1", "application/vnd.oci.image.manifest.v1+json", []byte("{}"))
+	assert.Equal(t, "sha256:manifest", dgt)
+	assert.True(t, errors.As(err, &multiErr))
+
+	// the blob fails in all the regions
+	east.err = errors.New("denied")
+	err = m.PushBlob("ns/app", "sha256:other", int64(len(content)), strings.NewReader(content))
+	require.True(t, errors.As(err, &multiErr))
+	assert.Len(t, multiErr.Errors, 2)
+
+	_, _, err = m.PushBlobChunk("ns/app", "sha256:other", 10, strings.NewReader(""), 0, 9, "")
+	assert.Error(t, err)
+}
+
+func TestAdapter_MultiRegionPrepareForPush(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	gock.New("https://swr.cn-north-1.myhuaweicloud.com").Post("/dockyard/v2/namespaces").
+		Reply(201)
+	gock.New("https://swr.cn-east-3.myhuaweicloud.com").Post("/dockyard/v2/namespaces").
+		Reply(500)
+
+	m, _, _ := getMultiRegionAdapter(t, WithAlwaysCreateNamespaces(true), WithNamespaceCreateRetry(1, time.Millisecond))
+	err := m.PrepareForPush([]*model.Resource{
+		{Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: "ns/app"}}},
+	})
+	var multiErr *MultiRegionError
+	require.True(t, errors.As(err, &multiErr))
+	require.Len(t, multiErr.Errors, 1)
+	assert.Equal(t, "cn-east-3", multiErr.Errors[0].Region)
+	assert.ErrorIs(t, err, ErrServer)
+	assert.True(t, gock.IsDone())
+
+	// a single region is the same as WithRegion
+	adp, err := newAdapter(&model.Registry{
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+	}, WithSettings(map[string]string{SettingRegions: "eu-de"}))
+	require.NoError(t, err)
+	assert.Equal(t, "https://swr.eu-de.otc.t-systems.com", adp.(*adapter).registry.URL)
+}
+
+func TestAdapter_MultiRegionManifestExist(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockManifest := func(host string, code int, dgt string) {
+		gock.New(host).Get("/swr/auth/v2/registry/auth").
+			Reply(200).JSON(jwtToken{Token: "token"})
+		gock.New(host).Get("/v2/ns/app/manifests/v1").
+			Reply(code).SetHeader("Docker-Content-Digest", dgt).
+			JSON(hwManifest{MediaType: distribution.ManifestMediaTypes()[0]})
+	}
+	north, east := "https://swr.cn-north-1.myhuaweicloud.com", "https://swr.cn-east-3.myhuaweicloud.com"
+	m, _, _ := getMultiRegionAdapter(t)
+
+	mockManifest(north, 200, "sha256:manifest")
+	mockManifest(east, 200, "sha256:manifest")
+	exist, desc, err := m.ManifestExist("ns/app", "v1")
+	assert.NoError(t, err)
+	assert.True(t, exist)
+	require.NotNil(t, desc)
+	assert.Equal(t, "sha256:manifest", desc.Digest.String())
+
+	// the manifest is missing in a region
+	mockManifest(north, 200, "sha256:manifest")
+	mockManifest(east, 404, "")
+	exist, _, err = m.ManifestExist("ns/app", "v1")
+	assert.NoError(t, err)
+	assert.False(t, exist)
+
+	// the manifest differs in a region
+	mockManifest(north, 200, "sha256:manifest")
+	mockManifest(east, 200, "sha256:stale")
+	exist, _, err = m.ManifestExist("ns/app", "v1")
+	assert.NoError(t, err)
+	assert.False(t, exist)
+
+	// the region failing the check is taken as missing the manifest
+	mockManifest(north, 500, "")
+	mockManifest(east, 200, "sha256:manifest")
+	exist, _, err = m.ManifestExist("ns/app", "v1")
+	assert.NoError(t, err)
+	assert.False(t, exist)
+	assert.True(t, gock.IsDone())
+}
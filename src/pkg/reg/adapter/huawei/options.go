@@ -0,0 +1,1109 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goharbor/harbor/src/lib/log"
+)
+
+// const definition
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 100
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultConnectTimeout      = 30 * time.Second
+	defaultTLSMinVersion       = tls.VersionTLS12
+	defaultBreakerCooldown     = 30 * time.Second
+	defaultBasePath            = "/dockyard/v2"
+	// the namespace listing of the large accounts is still far below it
+	defaultMaxResponseBodySize = 8 << 20
+	// the error bodies, e.g. the HTML error pages, are cut at 512 bytes in the errors and the logs
+	defaultErrorBodyLength = 512
+	// the layers of an image are uploaded 4 at a time at most
+	defaultMaxBlobUploads = 4
+	// the namespaces created by PrepareForPush tell the console users where they come from
+	defaultNamespaceDescription = "Managed by Harbor replication"
+	// the namespace creation is tried 3 times in total, waiting 500ms and 1s in between
+	defaultNamespaceCreateAttempts = 3
+	defaultNamespaceCreateBackoff  = 500 * time.Millisecond
+	// a retry waits 10s at most and the retries give up 1 minute after the first attempt
+	defaultRetryMaxBackoff = 10 * time.Second
+	defaultRetryMaxElapsed = time.Minute
+	// a listing of 100 items per page is stopped after 1,000 pages or 100,000 items
+	defaultMaxPages = 1000
+	defaultMaxItems = 100000
+
+	defaultAsyncPollInterval = time.Second
+	defaultAsyncPollTimeout  = time.Minute
+
+	// the failed health check is cached shorter to detect the recovery quickly
+	defaultHealthyTTL   = 30 * time.Second
+	defaultUnhealthyTTL = 5 * time.Second
+)
+
+// the keys of the settings supported by WithSettings
+const (
+	// SettingTimeoutSeconds is the timeout in seconds of each request sent to Huawei SWR
+	SettingTimeoutSeconds = "timeout_seconds"
+	// SettingListTimeoutSeconds, SettingGetTimeoutSeconds and SettingPushTimeoutSeconds are the timeouts in
+	// seconds of the operations overriding SettingTimeoutSeconds, see WithOperationTimeouts
+	SettingListTimeoutSeconds = "list_timeout_seconds"
+	SettingGetTimeoutSeconds  = "get_timeout_seconds"
+	SettingPushTimeoutSeconds = "push_timeout_seconds"
+	// SettingConnectTimeoutSeconds is the timeout in seconds of establishing a connection to Huawei SWR
+	SettingConnectTimeoutSeconds = "connect_timeout_seconds"
+	// SettingTLSMinVersion is the minimum TLS version, "1.2" or "1.3", accepted from Huawei SWR
+	SettingTLSMinVersion = "tls_min_version"
+	// SettingTLSServerName is the name the certificate of Huawei SWR is verified against, see WithTLSServerName
+	SettingTLSServerName = "tls_server_name"
+	// SettingMaxRetries is the max number of retries of the namespace creation
+	SettingMaxRetries = "max_retries"
+	// SettingRetryBackoffMS is the initial interval in milliseconds between the retries
+	SettingRetryBackoffMS = "retry_backoff_ms"
+	// SettingResumableUploadTTLMinutes is how long in minutes the interrupted uploads are resumable, see WithResumableUploads
+	SettingResumableUploadTTLMinutes = "resumable_upload_ttl_minutes"
+	// SettingRetryMaxBackoffMS and SettingRetryMaxElapsedSeconds bound the retries, see WithRetryLimits
+	SettingRetryMaxBackoffMS      = "retry_max_backoff_ms"
+	SettingRetryMaxElapsedSeconds = "retry_max_elapsed_seconds"
+	// SettingRegions is the comma separated regions pushed to, see WithRegions
+	SettingRegions = "regions"
+	// SettingRetryBudget is the max number of retries across a job, see WithRetryBudget
+	SettingRetryBudget = "retry_budget"
+	// SettingEnterpriseProjectID is the enterprise project the requests belong to
+	SettingEnterpriseProjectID = "enterprise_project_id"
+	// SettingForceHTTP1 disables HTTP/2 if it's "true", see WithForceHTTP1
+	SettingForceHTTP1 = "force_http1"
+	// SettingErrorBodyLength is the max length in bytes of the response bodies kept in the errors, see WithErrorBodyLength
+	SettingErrorBodyLength = "error_body_length"
+	// SettingRequestIDs sends a unique request ID with every request if it's "true", see WithRequestIDs
+	SettingRequestIDs = "request_ids"
+	// SettingAcceptLanguage is the language of the error messages of Huawei SWR, see WithAcceptLanguage
+	SettingAcceptLanguage = "accept_language"
+	// SettingHeaders is the JSON object of the static headers sent with every request, see WithHeaders
+	SettingHeaders = "headers"
+	// SettingNamespaceDescription is the description of the namespaces created, see WithNamespaceDescription
+	SettingNamespaceDescription = "namespace_description"
+	// SettingServerSideNamespaceFilter disables filtering the namespace listing by name on SWR if it's "false",
+	// see WithServerSideNamespaceFilter
+	SettingServerSideNamespaceFilter = "server_side_namespace_filter"
+	// SettingNamespaceAuth is the access level, "private" or "public", of the namespaces created by PrepareForPush
+	SettingNamespaceAuth = "namespace_auth"
+	// SettingImmutableTags requests the tag immutability of the namespaces created by PrepareForPush if it's "true"
+	SettingImmutableTags = "immutable_tags"
+	// SettingMaxBlobUploads is the max number of the concurrent blob uploads per repository, see WithMaxBlobUploads
+	SettingMaxBlobUploads = "max_blob_uploads"
+	// SettingMinConcurrency and SettingMaxConcurrency are the bounds of the adaptive concurrency, see WithAdaptiveConcurrency
+	SettingMinConcurrency = "min_concurrency"
+	SettingMaxConcurrency = "max_concurrency"
+	// SettingAsyncPollIntervalMS and SettingAsyncPollTimeoutSeconds control the polling of the asynchronous operations, see WithAsyncPoll
+	SettingAsyncPollIntervalMS     = "async_poll_interval_ms"
+	SettingAsyncPollTimeoutSeconds = "async_poll_timeout_seconds"
+	// SettingReferrers makes FetchArtifacts follow the OCI referrers API if it's "true", see WithReferrers
+	SettingReferrers = "referrers"
+	// SettingAlwaysCreateNamespaces makes PrepareForPush create the namespaces regardless of the existence check if it's "true",
+	// see WithAlwaysCreateNamespaces
+	SettingAlwaysCreateNamespaces = "always_create_namespaces"
+	// SettingFallbackNamespaces is the comma separated namespaces listed when the listing is forbidden, see WithFallbackNamespaces
+	SettingFallbackNamespaces = "fallback_namespaces"
+	// SettingDeletionScope is the comma separated patterns of the repositories the deletion is propagated to, see WithDeletionScope
+	SettingDeletionScope = "deletion_scope"
+	// SettingNamespaceCreateFields is the JSON object of the extra fields of the namespace creation body, see WithNamespaceCreateFields
+	SettingNamespaceCreateFields = "namespace_create_fields"
+	// SettingUploadBufferKB is the size in KiB of the chunks the blobs are read ahead in, see WithUploadBufferSize
+	SettingUploadBufferKB = "upload_buffer_kb"
+	// SettingDiscoveryConcurrency is the number of the namespaces walked concurrently, see WithDiscoveryConcurrency
+	SettingDiscoveryConcurrency = "discovery_concurrency"
+	// SettingCircuitBreakerThreshold and SettingCircuitBreakerCooldownSeconds configure the circuit breaker, see WithCircuitBreaker
+	SettingCircuitBreakerThreshold       = "circuit_breaker_threshold"
+	SettingCircuitBreakerCooldownSeconds = "circuit_breaker_cooldown_seconds"
+	// SettingVulnerabilityThreshold is the severity, e.g. "critical", at or above which the artifacts aren't
+	// fetched, and SettingExcludeUnscanned excludes the artifacts of the unknown severity if it's "true",
+	// see WithVulnerabilityThreshold
+	SettingVulnerabilityThreshold = "vulnerability_threshold"
+	SettingExcludeUnscanned       = "exclude_unscanned"
+	// SettingMediaTypes is the comma separated patterns of the manifest media types fetched, see WithMediaTypeFilter
+	SettingMediaTypes = "media_types"
+	// SettingRepositoryAllowlist and SettingRepositoryDenylist are the comma separated repositories, see WithRepositoryAllowlist
+	SettingRepositoryAllowlist = "repository_allowlist"
+	SettingRepositoryDenylist  = "repository_denylist"
+)
+
+// Option customizes the behavior of the Huawei SWR adapter
+type Option func(*options)
+
+type options struct {
+	// listAllNamespaces switches the namespace listing from the "visible"
+	// endpoint to the full one, see WithAllNamespaces
+	listAllNamespaces bool
+	// serverNamespaceFilter passes the name of the namespace query to SWR to filter the listing
+	serverNamespaceFilter bool
+	// namespaceAuth is the access level of the namespaces created by PrepareForPush
+	namespaceAuth NamespaceAuth
+	// connection pool tuning of the transport
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	// connectTimeout bounds establishing the TCP connections, separately from the request timeout
+	connectTimeout time.Duration
+	// uploadBufferSize is the size of the chunks the uploaded blobs are read ahead in if set
+	uploadBufferSize int
+	// tlsMinVersion is the minimum TLS version accepted from SWR
+	tlsMinVersion uint16
+	// tlsServerName overrides the name the certificate of SWR is verified against if set
+	tlsServerName string
+	// basePath is the path prefix of the management API
+	basePath string
+	// apiInsecure and authInsecure override the "Insecure" of the registry
+	// for the API endpoints and the token endpoint respectively if set
+	apiInsecure  *bool
+	authInsecure *bool
+	// maxResponseBodySize is the max number of bytes read from the response body
+	maxResponseBodySize int64
+	// namespaceCreateAttempts and namespaceCreateBackoff control the retrying of
+	// the namespace creation in PrepareForPush on the transient errors
+	namespaceCreateAttempts int
+	namespaceCreateBackoff  time.Duration
+	// retryMaxBackoff caps the interval between the retries, and retryMaxElapsed bounds the time
+	// the retries of a request take in total
+	retryMaxBackoff time.Duration
+	retryMaxElapsed time.Duration
+	// uploadSessionTTL is how long the interrupted uploads are resumable, not resumed if it's zero
+	uploadSessionTTL time.Duration
+	// retryBudget is the max number of retries across a job, no budget if it's zero
+	retryBudget int
+	// timeout is the timeout of each request, no timeout if it's zero
+	timeout time.Duration
+	// listTimeout overrides the timeout for listing the namespaces, the repositories and the tags,
+	// getTimeout for getting a namespace, its access or a repository, and pushTimeout for creating the
+	// namespaces before the pushes, including polling the asynchronous creations, along with each request
+	// pushing the blobs and the manifests, the timeout is kept if they're zero
+	listTimeout time.Duration
+	getTimeout  time.Duration
+	pushTimeout time.Duration
+	// region overrides the URL of the registry with the SWR endpoint of the region if set
+	region string
+	// regions are the regions pushed to by the multi-region adapter, see WithRegions
+	regions []string
+	// tagConstraint is the semver constraint the fetched tags must satisfy if set
+	tagConstraint string
+	// discoveryConcurrency is the number of the namespaces FetchArtifacts walks concurrently
+	discoveryConcurrency int
+	// breakerThreshold and breakerCooldown configure the circuit breaker, which is disabled if the threshold is 0
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	// severityThreshold is the scan severity at or above which the artifacts aren't fetched, and
+	// excludeUnscanned drops the artifacts of the unknown severity, not filtered if it's SeverityUnknown
+	severityThreshold Severity
+	excludeUnscanned  bool
+	// mediaTypes are the patterns the manifest media type of the fetched artifacts must match if set
+	mediaTypes []string
+	// ak and sk sign the requests to the management API instead of the basic auth if set
+	ak string
+	sk string
+	// healthyTTL and unhealthyTTL are how long the healthy and unhealthy results of HealthCheck are cached
+	healthyTTL   time.Duration
+	unhealthyTTL time.Duration
+	// destinationPrefix is merged into the namespace of the converted repositories if set
+	destinationPrefix string
+	// updatedSince makes FetchArtifacts skip the artifacts not updated since then if set
+	updatedSince time.Time
+	// referrers makes FetchArtifacts follow the OCI referrers API, see WithReferrers
+	referrers bool
+	// manifestMediaTypes are sent as the "Accept" header when querying the manifests
+	manifestMediaTypes []string
+	// enterpriseProjectID is sent as the "Enterprise-Project-Id" header of all the requests if set
+	enterpriseProjectID string
+	// forceHTTP1 disables the negotiation of HTTP/2
+	forceHTTP1 bool
+	// maxPages and maxItems cap the pages and the items fetched by a paginated listing
+	maxPages int
+	maxItems int
+	// headers are the static headers sent with every request
+	headers map[string]string
+	// maxBlobUploads is the max number of the concurrent blob uploads per repository, no limit if it's zero
+	maxBlobUploads int
+	// errorBodyLength is the max length of the response bodies kept in the errors
+	errorBodyLength int
+	// requestID generates the ID of each request, no request ID is sent if it's nil
+	requestID func() string
+	// acceptLanguage is the Accept-Language header sent with every request, not sent if it's empty
+	acceptLanguage string
+	// progress receives the progress events if set
+	progress ProgressFunc
+	// immutableTags requests the tag immutability of the namespaces created by PrepareForPush
+	immutableTags bool
+	// credentialProvider provides the credential per request instead of the static one of the registry
+	credentialProvider CredentialProvider
+	// minConcurrency and maxConcurrency bound the adaptive concurrency, which is disabled if maxConcurrency is 0
+	minConcurrency int
+	maxConcurrency int
+	// alwaysCreateNamespaces makes PrepareForPush create the namespaces even if they're reported as existing
+	alwaysCreateNamespaces bool
+	// writableNamespacesOnly makes ListNamespaces skip the namespaces the user can't push to
+	writableNamespacesOnly bool
+	// organizations scope the namespaces of the repositories named as "org/namespace/repo"
+	organizations map[string]struct{}
+	// fallbackNamespaces are listed when the credential isn't allowed to list the namespaces
+	fallbackNamespaces []string
+	// deletionScope are the patterns of the repositories DeleteManifest is allowed to delete from, none if empty
+	deletionScope []string
+	// repositoryAllowlist and repositoryDenylist are the only repositories discovered and the ones never discovered
+	repositoryAllowlist map[string]struct{}
+	repositoryDenylist  map[string]struct{}
+	// namespaceDescription is the description of the namespaces created, not sent if it's empty
+	namespaceDescription string
+	// namespaceCreateBody and namespaceCreateFields customize the body of the namespace creation
+	namespaceCreateBody   NamespaceBodyBuilder
+	namespaceCreateFields map[string]interface{}
+	// asyncPollInterval and asyncPollTimeout control the polling of the operations accepted asynchronously
+	asyncPollInterval time.Duration
+	asyncPollTimeout  time.Duration
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		namespaceAuth:           NamespaceAuthPrivate,
+		acceptLanguage:          defaultAcceptLanguage,
+		errorBodyLength:         defaultErrorBodyLength,
+		maxBlobUploads:          defaultMaxBlobUploads,
+		serverNamespaceFilter:   true,
+		namespaceDescription:    defaultNamespaceDescription,
+		maxIdleConns:            defaultMaxIdleConns,
+		maxIdleConnsPerHost:     defaultMaxIdleConnsPerHost,
+		idleConnTimeout:         defaultIdleConnTimeout,
+		connectTimeout:          defaultConnectTimeout,
+		tlsMinVersion:           defaultTLSMinVersion,
+		basePath:                defaultBasePath,
+		maxResponseBodySize:     defaultMaxResponseBodySize,
+		namespaceCreateAttempts: defaultNamespaceCreateAttempts,
+		namespaceCreateBackoff:  defaultNamespaceCreateBackoff,
+		retryMaxBackoff:         defaultRetryMaxBackoff,
+		retryMaxElapsed:         defaultRetryMaxElapsed,
+		healthyTTL:              defaultHealthyTTL,
+		unhealthyTTL:            defaultUnhealthyTTL,
+		manifestMediaTypes:      manifestMediaTypes,
+		maxPages:                defaultMaxPages,
+		maxItems:                defaultMaxItems,
+		asyncPollInterval:       defaultAsyncPollInterval,
+		discoveryConcurrency:    1,
+		asyncPollTimeout:        defaultAsyncPollTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithAllNamespaces makes ListNamespaces enumerate the namespaces via "<base path>/namespaces"
+// instead of "<base path>/visible/namespaces". The "visible" endpoint only returns the namespaces
+// that are visible to the user of the credential, while the full endpoint returns all the namespaces
+// of the account, which is only useful for the admin-scoped credentials.
+func WithAllNamespaces(all bool) Option {
+	return func(o *options) {
+		o.listAllNamespaces = all
+	}
+}
+
+// WithServerSideNamespaceFilter decides whether the name of the namespace query is passed to SWR, so the
+// large accounts only transfer the namespaces matching it. It's enabled by default and falls back to the
+// local matching for a while once SWR rejects the filter, the names are matched locally either way.
+// ListNamespacesWithCounts never sends the filter, as its total counts all the namespaces
+func WithServerSideNamespaceFilter(enabled bool) Option {
+	return func(o *options) {
+		o.serverNamespaceFilter = enabled
+	}
+}
+
+// WithNamespaceAuth sets the access level of the namespaces created by PrepareForPush,
+// the namespaces are created as private by default
+func WithNamespaceAuth(auth NamespaceAuth) Option {
+	return func(o *options) {
+		o.namespaceAuth = auth
+	}
+}
+
+// WithImmutableTags requests the tag immutability of the namespaces created by PrepareForPush. The
+// namespace API of Huawei SWR has no such policy, so a warning is logged for each created namespace
+// rather than failing the replication, the existing namespaces are never changed
+func WithImmutableTags(immutable bool) Option {
+	return func(o *options) {
+		o.immutableTags = immutable
+	}
+}
+
+// WithIdleConns sets the max number of the idle connections in total and per host of the transport
+func WithIdleConns(maxIdleConns, maxIdleConnsPerHost int) Option {
+	return func(o *options) {
+		o.maxIdleConns = maxIdleConns
+		o.maxIdleConnsPerHost = maxIdleConnsPerHost
+	}
+}
+
+// WithIdleConnTimeout sets how long an idle connection of the transport is kept before closing
+func WithIdleConnTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.idleConnTimeout = timeout
+	}
+}
+
+// WithBasePath overrides the path prefix of the management API, which is "/dockyard/v2" by default,
+// for the SWR compatible deployments or the gateways rewriting the paths
+func WithBasePath(basePath string) Option {
+	return func(o *options) {
+		o.basePath = basePath
+	}
+}
+
+// WithAPIInsecure overrides the TLS verification setting of the registry for the API endpoints
+func WithAPIInsecure(insecure bool) Option {
+	return func(o *options) {
+		o.apiInsecure = &insecure
+	}
+}
+
+// WithAuthInsecure overrides the TLS verification setting of the registry for the token endpoint,
+// for the deployments whose token endpoint and API endpoints are served with different certificates
+func WithAuthInsecure(insecure bool) Option {
+	return func(o *options) {
+		o.authInsecure = &insecure
+	}
+}
+
+// WithMaxResponseBodySize sets the max number of bytes read from the response body of
+// the management API, to guard the worker against the huge payloads
+func WithMaxResponseBodySize(size int64) Option {
+	return func(o *options) {
+		o.maxResponseBodySize = size
+	}
+}
+
+// WithNamespaceCreateRetry sets how many times PrepareForPush tries to create a namespace when
+// Huawei SWR fails with a transient error (5xx, 429 or the connection failures), and the initial
+// interval between the attempts which is doubled after each attempt. Values less than 1 attempt
+// disable the retrying.
+func WithNamespaceCreateRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.namespaceCreateAttempts = attempts
+		o.namespaceCreateBackoff = backoff
+	}
+}
+
+// WithResumableUploads makes the chunked blob uploads interrupted in the middle resume from the last
+// offset acknowledged by SWR when the blob is pushed again within the ttl, e.g. by the retried job,
+// rather than uploading the whole blob again. The session is verified with SWR before resuming, the
+// upload starts over if the session is expired there. It's disabled if the ttl isn't positive
+func WithResumableUploads(ttl time.Duration) Option {
+	return func(o *options) {
+		o.uploadSessionTTL = max(ttl, 0)
+	}
+}
+
+// WithRetryLimits caps the interval between the retries, which is doubled after each attempt, at
+// maxBackoff, and gives up the retries of a request once they'd take longer than maxElapsed since the
+// first attempt regardless of the attempts left. They're 10 seconds and 1 minute by default, the
+// non-positive values keep the current ones
+func WithRetryLimits(maxBackoff, maxElapsed time.Duration) Option {
+	return func(o *options) {
+		if maxBackoff > 0 {
+			o.retryMaxBackoff = maxBackoff
+		}
+		if maxElapsed > 0 {
+			o.retryMaxElapsed = maxElapsed
+		}
+	}
+}
+
+// WithRetryBudget sets the max number of retries across all the requests of a replication job on top
+// of the attempts of each request, e.g. WithNamespaceCreateRetry, so a degraded SWR fails the job with
+// ErrRetryBudgetExhausted rather than tying up the worker. Each PrepareForPush gets its own budget, so
+// the concurrent jobs sharing the adapter don't affect each other. The namespace creations are the only
+// requests the adapter retries, the failed blob and manifest pushes are retried by the replication
+// task. There is no budget by default
+func WithRetryBudget(retries int) Option {
+	return func(o *options) {
+		o.retryBudget = max(retries, 0)
+	}
+}
+
+// WithSettings applies the settings of the registry, see the Setting constants, e.g. SettingTimeoutSeconds,
+// for the supported keys. The absent keys keep the defaults, and the invalid values are ignored with
+// a warning rather than failing the creation of the adapter.
+func WithSettings(settings map[string]string) Option {
+	return func(o *options) {
+		if v, ok := parseSetting(settings, SettingTimeoutSeconds); ok {
+			o.timeout = time.Duration(v) * time.Second
+		}
+		if v, ok := parseSetting(settings, SettingListTimeoutSeconds); ok {
+			WithOperationTimeouts(time.Duration(v)*time.Second, 0, 0)(o)
+		}
+		if v, ok := parseSetting(settings, SettingGetTimeoutSeconds); ok {
+			WithOperationTimeouts(0, time.Duration(v)*time.Second, 0)(o)
+		}
+		if v, ok := parseSetting(settings, SettingPushTimeoutSeconds); ok {
+			WithOperationTimeouts(0, 0, time.Duration(v)*time.Second)(o)
+		}
+		if v, ok := parseSetting(settings, SettingConnectTimeoutSeconds); ok {
+			WithConnectTimeout(time.Duration(v) * time.Second)(o)
+		}
+		if threshold, ok := parseSetting(settings, SettingCircuitBreakerThreshold); ok {
+			cooldown, _ := parseSetting(settings, SettingCircuitBreakerCooldownSeconds)
+			WithCircuitBreaker(int(threshold), time.Duration(cooldown)*time.Second)(o)
+		}
+		if v, ok := parseSetting(settings, SettingDiscoveryConcurrency); ok {
+			WithDiscoveryConcurrency(int(v))(o)
+		}
+		if v, ok := parseSetting(settings, SettingUploadBufferKB); ok {
+			WithUploadBufferSize(int(v) << 10)(o)
+		}
+		if v, ok := settings[SettingTLSServerName]; ok {
+			o.tlsServerName = v
+		}
+		if v, ok := settings[SettingTLSMinVersion]; ok {
+			switch v {
+			case "1.2":
+				o.tlsMinVersion = tls.VersionTLS12
+			case "1.3":
+				o.tlsMinVersion = tls.VersionTLS13
+			default:
+				log.Warningf("invalid value %q of the setting %s of Huawei SWR adapter, the default is used", v, SettingTLSMinVersion)
+			}
+		}
+		if v, ok := parseSetting(settings, SettingMaxRetries); ok {
+			o.namespaceCreateAttempts = int(v) + 1
+		}
+		if v, ok := parseSetting(settings, SettingRetryBackoffMS); ok {
+			o.namespaceCreateBackoff = time.Duration(v) * time.Millisecond
+		}
+		if v, ok := parseSetting(settings, SettingResumableUploadTTLMinutes); ok {
+			o.uploadSessionTTL = time.Duration(v) * time.Minute
+		}
+		if v, ok := parseSetting(settings, SettingRetryMaxBackoffMS); ok {
+			WithRetryLimits(time.Duration(v)*time.Millisecond, 0)(o)
+		}
+		if v, ok := parseSetting(settings, SettingRetryMaxElapsedSeconds); ok {
+			WithRetryLimits(0, time.Duration(v)*time.Second)(o)
+		}
+		if v, ok := parseSetting(settings, SettingRetryBudget); ok {
+			o.retryBudget = int(v)
+		}
+		if v, ok := settings[SettingEnterpriseProjectID]; ok {
+			o.enterpriseProjectID = v
+		}
+		if v, ok := parseBoolSetting(settings, SettingForceHTTP1); ok {
+			o.forceHTTP1 = v
+		}
+		if v, ok := parseBoolSetting(settings, SettingReferrers); ok {
+			o.referrers = v
+		}
+		if v, ok := parseBoolSetting(settings, SettingAlwaysCreateNamespaces); ok {
+			o.alwaysCreateNamespaces = v
+		}
+		if v, ok := parseBoolSetting(settings, SettingImmutableTags); ok {
+			o.immutableTags = v
+		}
+		if v, ok := parseSetting(settings, SettingMaxBlobUploads); ok {
+			WithMaxBlobUploads(int(v))(o)
+		}
+		if maxConcurrency, ok := parseSetting(settings, SettingMaxConcurrency); ok {
+			minConcurrency, _ := parseSetting(settings, SettingMinConcurrency)
+			WithAdaptiveConcurrency(int(minConcurrency), int(maxConcurrency))(o)
+		}
+		if v, ok := parseSetting(settings, SettingAsyncPollIntervalMS); ok {
+			WithAsyncPoll(time.Duration(v)*time.Millisecond, 0)(o)
+		}
+		if v, ok := parseSetting(settings, SettingAsyncPollTimeoutSeconds); ok {
+			WithAsyncPoll(0, time.Duration(v)*time.Second)(o)
+		}
+		if v, ok := settings[SettingVulnerabilityThreshold]; ok {
+			if severity, valid := ParseSeverity(v); valid {
+				excludeUnscanned, _ := parseBoolSetting(settings, SettingExcludeUnscanned)
+				WithVulnerabilityThreshold(severity, excludeUnscanned)(o)
+			} else {
+				log.Warningf("invalid value %q of the setting %s of Huawei SWR adapter, the default is used", v, SettingVulnerabilityThreshold)
+			}
+		}
+		if v, ok := settings[SettingMediaTypes]; ok {
+			WithMediaTypeFilter(splitSetting(v)...)(o)
+		}
+		if v, ok := settings[SettingRegions]; ok {
+			WithRegions(splitSetting(v)...)(o)
+		}
+		if v, ok := settings[SettingFallbackNamespaces]; ok {
+			WithFallbackNamespaces(splitSetting(v)...)(o)
+		}
+		if v, ok := settings[SettingDeletionScope]; ok {
+			WithDeletionScope(splitSetting(v)...)(o)
+		}
+		if v, ok := settings[SettingRepositoryAllowlist]; ok {
+			WithRepositoryAllowlist(splitSetting(v)...)(o)
+		}
+		if v, ok := settings[SettingRepositoryDenylist]; ok {
+			WithRepositoryDenylist(splitSetting(v)...)(o)
+		}
+		if v, ok := settings[SettingNamespaceAuth]; ok {
+			switch v {
+			case NamespaceAuthPrivate.String():
+				o.namespaceAuth = NamespaceAuthPrivate
+			case NamespaceAuthPublic.String():
+				o.namespaceAuth = NamespaceAuthPublic
+			default:
+				log.Warningf("invalid value %q of the setting %s of Huawei SWR adapter, the default is used", v, SettingNamespaceAuth)
+			}
+		}
+		if v, ok := settings[SettingNamespaceCreateFields]; ok {
+			fields := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(v), &fields); err != nil {
+				log.Warningf("invalid value of the setting %s of Huawei SWR adapter, which should be a JSON object: %v", SettingNamespaceCreateFields, err)
+			} else {
+				WithNamespaceCreateFields(fields)(o)
+			}
+		}
+		if v, ok := parseSetting(settings, SettingErrorBodyLength); ok {
+			WithErrorBodyLength(int(v))(o)
+		}
+		if v, ok := parseBoolSetting(settings, SettingRequestIDs); ok {
+			if v {
+				WithRequestIDs(nil)(o)
+			} else {
+				o.requestID = nil
+			}
+		}
+		if v, ok := parseBoolSetting(settings, SettingServerSideNamespaceFilter); ok {
+			o.serverNamespaceFilter = v
+		}
+		if v, ok := settings[SettingNamespaceDescription]; ok {
+			WithNamespaceDescription(v)(o)
+		}
+		if v, ok := settings[SettingAcceptLanguage]; ok {
+			WithAcceptLanguage(v)(o)
+		}
+		if v, ok := settings[SettingHeaders]; ok {
+			headers := map[string]string{}
+			if err := json.Unmarshal([]byte(v), &headers); err != nil {
+				log.Warningf("invalid value of the setting %s of Huawei SWR adapter, which should be a JSON object of strings: %v", SettingHeaders, err)
+			} else {
+				WithHeaders(headers)(o)
+			}
+		}
+	}
+}
+
+// parseSetting parses the setting as a non-negative integer, false is returned
+// if the setting is absent or invalid
+func parseSetting(settings map[string]string, key string) (int64, bool) {
+	s, ok := settings[key]
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		log.Warningf("invalid value %q of the setting %s of Huawei SWR adapter, the default is used", s, key)
+		return 0, false
+	}
+	return v, true
+}
+
+// splitSetting splits the comma separated setting, the blank items are dropped
+func splitSetting(setting string) []string {
+	var items []string
+	for _, item := range strings.Split(setting, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseBoolSetting parses the setting as a boolean, false is returned as the second value
+// if the setting is absent or invalid
+func parseBoolSetting(settings map[string]string, key string) (bool, bool) {
+	s, ok := settings[key]
+	if !ok {
+		return false, false
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		log.Warningf("invalid value %q of the setting %s of Huawei SWR adapter, the default is used", s, key)
+		return false, false
+	}
+	return v, true
+}
+
+// WithTimeout sets the timeout of each request sent to Huawei SWR, no timeout by default
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithOperationTimeouts overrides the timeout set by WithTimeout for the listings of the namespaces, the
+// repositories and the tags, getting a namespace or a repository, and the pushes, i.e. creating the
+// namespaces and each request pushing the blobs and the manifests, either shorter or longer than it, e.g.
+// to fail fast on the listings while tolerating the slow pushes. The non-positive values keep the current
+// ones, the operations with no timeout of their own use the timeout set by WithTimeout
+func WithOperationTimeouts(list, get, push time.Duration) Option {
+	return func(o *options) {
+		if list > 0 {
+			o.listTimeout = list
+		}
+		if get > 0 {
+			o.getTimeout = get
+		}
+		if push > 0 {
+			o.pushTimeout = push
+		}
+	}
+}
+
+// WithErrorBodyLength sets the max length in bytes of the response bodies kept in the errors, which
+// end up in the logs as well, the longer ones are cut with "..." appended. It's 512 bytes by default,
+// the non-positive values keep the current one
+func WithErrorBodyLength(length int) Option {
+	return func(o *options) {
+		if length > 0 {
+			o.errorBodyLength = length
+		}
+	}
+}
+
+// WithTLSMinVersion sets the minimum TLS version accepted from Huawei SWR, e.g. tls.VersionTLS13,
+// which is TLS 1.2 by default. The handshake with the endpoint not supporting it fails with ErrTLS.
+// The versions below TLS 1.2 aren't allowed and keep the default
+func WithTLSMinVersion(version uint16) Option {
+	return func(o *options) {
+		if version >= tls.VersionTLS12 {
+			o.tlsMinVersion = version
+		}
+	}
+}
+
+// WithUploadBufferSize makes PushBlob and PushBlobChunk read the blobs ahead in the chunks of the size in
+// bytes, e.g. 1 MiB, so reading a blob from the source registry overlaps writing it to SWR rather than
+// both waiting for each other over the high latency links. Up to readAheadChunks chunks are buffered per
+// upload. The blobs are streamed as is by default, and the non-positive sizes keep it
+func WithUploadBufferSize(size int) Option {
+	return func(o *options) {
+		o.uploadBufferSize = max(size, 0)
+	}
+}
+
+// WithTLSServerName sets the server name sent with SNI and verified against the certificate of SWR,
+// instead of the host of the URL, for the endpoints accessed by IP with a certificate issued for a name.
+// The certificate is still verified unlike the insecure mode
+func WithTLSServerName(name string) Option {
+	return func(o *options) {
+		o.tlsServerName = name
+	}
+}
+
+// WithConnectTimeout sets the timeout of establishing a connection to Huawei SWR, 30s by default.
+// Unlike WithTimeout it doesn't limit the transfer over the established connection, so a short
+// value detects the unreachable endpoints quickly without aborting the slow large transfers.
+// The non-positive values keep the default
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		if timeout > 0 {
+			o.connectTimeout = timeout
+		}
+	}
+}
+
+// WithRegions pushes to all the regions, e.g. "eu-de" and "eu-nl" for the disaster recovery, with one
+// replication rule, while the reads are served by the first region. The operations fan out to the
+// regions concurrently, the failure of a region doesn't abort the others and is reported by
+// MultiRegionError naming the region. A single region is the same as WithRegion, the URL of the
+// registry is ignored then
+func WithRegions(regions ...string) Option {
+	return func(o *options) {
+		o.regions = regions
+	}
+}
+
+// WithRegion builds the URL of the registry from the region, e.g. "cn-north-4", instead of
+// assembling it manually, the URL of the registry is ignored then
+func WithRegion(region string) Option {
+	return func(o *options) {
+		o.region = region
+	}
+}
+
+// WithCircuitBreaker makes the requests to SWR fail fast with ErrCircuitOpen for the cooldown, 30s by
+// default, after the threshold of the consecutive failures, i.e. the connection failures and the 5xx.
+// One request probes the recovery after the cooldown. The breaker is shared by the adapters of the same
+// registry in the process, and it's disabled by default or if the threshold isn't positive
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(o *options) {
+		o.breakerThreshold = max(threshold, 0)
+		o.breakerCooldown = cooldown
+		if o.breakerCooldown <= 0 {
+			o.breakerCooldown = defaultBreakerCooldown
+		}
+	}
+}
+
+// WithDiscoveryConcurrency sets how many namespaces FetchArtifacts walks concurrently, the repositories
+// and tags of each namespace are still listed in turn. The namespaces are walked one by one by default,
+// and the values less than 1 keep it
+func WithDiscoveryConcurrency(workers int) Option {
+	return func(o *options) {
+		o.discoveryConcurrency = max(workers, 1)
+	}
+}
+
+// WithSemverTagConstraint makes FetchArtifacts only fetch the tags satisfying the semver constraint,
+// e.g. ">=1.2.0" or "~1.4", on top of the tag filters of the policy. The tags which aren't valid
+// semantic versions, e.g. "latest" or "dev", are excluded when the constraint is set.
+func WithSemverTagConstraint(constraint string) Option {
+	return func(o *options) {
+		o.tagConstraint = constraint
+	}
+}
+
+// WithMediaTypeFilter makes FetchArtifacts only fetch the artifacts whose manifest media type matches
+// any of the patterns, e.g. "application/vnd.docker.distribution.manifest.*" to exclude the Helm charts
+// and the other OCI artifacts. The manifest of each artifact is inspected when the filter is set, all
+// the artifacts are fetched by default
+func WithMediaTypeFilter(patterns ...string) Option {
+	return func(o *options) {
+		o.mediaTypes = patterns
+	}
+}
+
+// WithVulnerabilityThreshold makes FetchArtifacts skip the artifacts whose vulnerability scan in SWR found
+// the vulnerabilities at or above the severity, e.g. SeverityCritical, see GetScanStatus. The artifacts not
+// scanned yet or without the scan data are fetched unless excludeUnscanned is set. The threshold below
+// SeverityLow disables the filter, which is the default
+func WithVulnerabilityThreshold(threshold Severity, excludeUnscanned bool) Option {
+	return func(o *options) {
+		if threshold < SeverityLow {
+			o.severityThreshold = SeverityUnknown
+			o.excludeUnscanned = false
+			return
+		}
+		o.severityThreshold = threshold
+		o.excludeUnscanned = excludeUnscanned
+	}
+}
+
+// WithAKSK signs the requests to the management API with the AK/SK of the account, which is
+// the native authentication of SWR, instead of the basic auth with the credential of the registry.
+// The token endpoint keeps using the basic auth as the docker login does.
+func WithAKSK(ak, sk string) Option {
+	return func(o *options) {
+		o.ak = ak
+		o.sk = sk
+	}
+}
+
+// WithHealthCheckTTL sets how long the healthy and unhealthy results of HealthCheck are reused,
+// 30s and 5s by default, so the frequent health polls don't hammer SWR. Zero disables the caching.
+func WithHealthCheckTTL(healthy, unhealthy time.Duration) Option {
+	return func(o *options) {
+		o.healthyTTL = healthy
+		o.unhealthyTTL = unhealthy
+	}
+}
+
+// WithDestinationPrefix makes the pushes prefix the repositories with the prefix, e.g. the name of the
+// source registry, to avoid the collisions when several sources are replicated into one SWR account.
+// The namespaces created by PrepareForPush, the manifests and the blobs pushed, checked and deleted are
+// all prefixed, as is ConvertResourceMetadata. As the namespaces of SWR have only one segment, the
+// prefix is merged into the first segment, see applyDestinationPrefix.
+func WithDestinationPrefix(prefix string) Option {
+	return func(o *options) {
+		o.destinationPrefix = prefix
+	}
+}
+
+// WithReferrers makes FetchArtifacts query the OCI referrers API of SWR for each fetched artifact, so
+// the SBOMs, attestations and signatures stored as the referrers are replicated alongside the images.
+// The cosign tags, e.g. "sha256-<hex>.att", are always picked up, which is also the fallback if SWR
+// doesn't support the referrers API. It costs a request per artifact so it's disabled by default
+func WithReferrers(enabled bool) Option {
+	return func(o *options) {
+		o.referrers = enabled
+	}
+}
+
+// WithUpdatedSince makes FetchArtifacts only fetch the tags updated since the time, e.g. the time of
+// the last sync, for the incremental replications. The repositories not updated since the time are
+// skipped without listing their tags, and the tags whose update time is unknown are always fetched.
+func WithUpdatedSince(since time.Time) Option {
+	return func(o *options) {
+		o.updatedSince = since
+	}
+}
+
+// WithManifestMediaTypes overrides the media types accepted when querying and pulling the manifests,
+// which are the Docker v2 and OCI manifests and indexes and the Docker schema1 manifests by default,
+// the defaults are kept if no media type is provided
+func WithManifestMediaTypes(mediaTypes ...string) Option {
+	return func(o *options) {
+		if len(mediaTypes) > 0 {
+			o.manifestMediaTypes = mediaTypes
+		}
+	}
+}
+
+// WithEnterpriseProjectID sends the enterprise project ID as the "Enterprise-Project-Id" header of all the
+// requests, which is required by the accounts isolating the resources by the enterprise projects for the
+// billing, nothing is sent if it's empty
+func WithEnterpriseProjectID(id string) Option {
+	return func(o *options) {
+		o.enterpriseProjectID = id
+	}
+}
+
+// WithForceHTTP1 makes the adapter talk HTTP/1.1 only, for the endpoints or the proxies mishandling HTTP/2.
+// Otherwise HTTP/2 is negotiated via ALPN and used when SWR supports it, with HTTP/1.1 as the fallback
+func WithForceHTTP1(force bool) Option {
+	return func(o *options) {
+		o.forceHTTP1 = force
+	}
+}
+
+// WithPaginationLimit caps the number of the pages and the total number of the items fetched by
+// a paginated listing, e.g. the repositories of a namespace or the tags of a repository, so an
+// endpoint never signaling the last page can't hang the worker. ErrPaginationLimitExceeded is
+// returned once the cap is exceeded, the non-positive values keep the defaults
+func WithPaginationLimit(maxPages, maxItems int) Option {
+	return func(o *options) {
+		if maxPages > 0 {
+			o.maxPages = maxPages
+		}
+		if maxItems > 0 {
+			o.maxItems = maxItems
+		}
+	}
+}
+
+// defaultAcceptLanguage makes Huawei SWR respond the error messages in English regardless of the
+// language of the account
+const defaultAcceptLanguage = "en-US"
+
+// WithAcceptLanguage sets the Accept-Language header sent with every request, which is the language
+// of the error messages localized by Huawei SWR, "en-US" by default. The empty language sends none,
+// so the language of the account applies. The header set by WithHeaders takes precedence
+func WithAcceptLanguage(language string) Option {
+	return func(o *options) {
+		o.acceptLanguage = strings.TrimSpace(language)
+	}
+}
+
+// WithRequestIDs sends the ID generated by generate for each request in the "X-Request-Id" header, which is
+// logged along with the operation to correlate the traces of Harbor with SWR, and SWR echoing back a different
+// ID is logged as a warning. The random UUIDs are generated if generate is nil. It takes precedence over the
+// header set by WithHeaders, no request ID is sent by default
+func WithRequestIDs(generate func() string) Option {
+	return func(o *options) {
+		if generate == nil {
+			generate = newRequestID
+		}
+		o.requestID = generate
+	}
+}
+
+// WithHeaders sends the static headers with every request, e.g. the key required by the API gateway in
+// front of SWR. The headers are merged into the ones set by the previous calls. The reserved headers, e.g.
+// "Authorization" and "Host", can't be overridden and are ignored with a warning, see reservedHeaders
+func WithHeaders(headers map[string]string) Option {
+	return func(o *options) {
+		for key, value := range headers {
+			if _, reserved := reservedHeaders[http.CanonicalHeaderKey(key)]; reserved {
+				log.Warningf("the reserved header %s can't be overridden by the static headers of Huawei SWR adapter, ignored", key)
+				continue
+			}
+			if o.headers == nil {
+				o.headers = map[string]string{}
+			}
+			o.headers[http.CanonicalHeaderKey(key)] = value
+		}
+	}
+}
+
+// WithProgress sets the callback receiving the progress events of the adapter, e.g. the namespaces
+// created and the manifests pushed, so the long replications can report their progress. Nothing is
+// reported if it's nil
+func WithProgress(fn ProgressFunc) Option {
+	return func(o *options) {
+		o.progress = fn
+	}
+}
+
+// WithCredentialProvider gets the credential from the provider for every request instead of using the
+// static credential of the registry, so the short-lived credentials rotated by a secrets manager can be
+// used without recreating the adapter. The static credential is used if the provider is nil
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return func(o *options) {
+		o.credentialProvider = provider
+	}
+}
+
+// WithMaxBlobUploads bounds the concurrent blob uploads to a repository, so pushing an image of many layers
+// doesn't flood SWR with the uploads and get throttled. It's 4 by default and zero removes the limit. The
+// uploads are bounded by WithAdaptiveConcurrency as well once they get a slot of the repository
+func WithMaxBlobUploads(n int) Option {
+	return func(o *options) {
+		o.maxBlobUploads = max(n, 0)
+	}
+}
+
+// WithAdaptiveConcurrency creates the namespaces in PrepareForPush concurrently and bounds the concurrent
+// pushes of the blobs and manifests with a limit adapting to SWR, which starts from the lower bound, backs
+// off when SWR throttles the requests and ramps up to the upper bound when SWR responds fast. The lower
+// bound is at least 1, and the concurrency isn't adapted if the upper bound is 0, which is the default
+func WithAdaptiveConcurrency(minConcurrency, maxConcurrency int) Option {
+	return func(o *options) {
+		if maxConcurrency <= 0 {
+			o.minConcurrency, o.maxConcurrency = 0, 0
+			return
+		}
+		o.minConcurrency = max(minConcurrency, 1)
+		o.maxConcurrency = max(maxConcurrency, o.minConcurrency)
+	}
+}
+
+// WithWritableNamespacesOnly makes ListNamespaces only return the namespaces the user can push to, e.g.
+// for the replication targets, according to the permission of the user SWR reports in the listing, or
+// in the permissions of the namespace if the listing doesn't report it. The read-only namespaces
+// shared with the user are skipped, so the push jobs don't fail with 403 on them
+func WithWritableNamespacesOnly(writable bool) Option {
+	return func(o *options) {
+		o.writableNamespacesOnly = writable
+	}
+}
+
+// WithAlwaysCreateNamespaces makes PrepareForPush attempt to create all the namespaces of the resources
+// without checking their existence first, the namespaces already existing are tolerated as SWR responds
+// 409 for them. It covers the stale reads of the existence, e.g. the namespace deleted right before
+// the replication, at the cost of a creation request per namespace
+func WithAlwaysCreateNamespaces(always bool) Option {
+	return func(o *options) {
+		o.alwaysCreateNamespaces = always
+	}
+}
+
+// WithOrganizations sets the organizations owning the shared namespaces, the repositories named as
+// "org/namespace/repo" under them are pushed to the namespace "org/namespace" rather than "org". The
+// other repositories keep taking the first segment of their names as the namespace
+func WithOrganizations(orgs ...string) Option {
+	return func(o *options) {
+		for _, org := range orgs {
+			if o.organizations == nil {
+				o.organizations = map[string]struct{}{}
+			}
+			o.organizations[org] = struct{}{}
+		}
+	}
+}
+
+// WithAsyncPoll sets the interval and the timeout of polling the operations Huawei SWR accepts with 202
+// and completes asynchronously, e.g. the namespace creation, which are 1 second and 1 minute by default.
+// The non-positive values keep the defaults
+func WithAsyncPoll(interval, timeout time.Duration) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.asyncPollInterval = interval
+		}
+		if timeout > 0 {
+			o.asyncPollTimeout = timeout
+		}
+	}
+}
+
+// WithFallbackNamespaces sets the namespaces ListNamespaces falls back to when SWR forbids the credential
+// to list the namespaces, e.g. the service accounts scoped to a single namespace, which can still push
+// to it. A warning is logged when falling back, and the listing fails with ErrUnauthorized as before
+// if no namespace is set
+func WithFallbackNamespaces(namespaces ...string) Option {
+	return func(o *options) {
+		o.fallbackNamespaces = namespaces
+	}
+}
+
+// WithDeletionScope restricts the deletions propagated by the replications with the deletion enabled to
+// the repositories matching any of the patterns, e.g. "mirror/**", so the artifacts pushed to SWR by
+// other means aren't removed by accident. DeleteManifest fails with ErrDeletionNotAllowed for the other
+// repositories. No repository is in the scope by default, so the deletions are refused until the scope
+// is set, "**" allows deleting from all the repositories
+func WithDeletionScope(patterns ...string) Option {
+	return func(o *options) {
+		o.deletionScope = patterns
+	}
+}
+
+// WithRepositoryAllowlist pins the repositories discovered by FetchArtifacts to the ones listed by their
+// full names, e.g. "library/nginx", on top of the filters of the replication policy. All the repositories
+// are discovered if no repository is listed
+func WithRepositoryAllowlist(repositories ...string) Option {
+	return func(o *options) {
+		o.repositoryAllowlist = repositorySet(repositories)
+	}
+}
+
+// WithRepositoryDenylist excludes the repositories listed by their full names from the discovery, even
+// the ones listed by WithRepositoryAllowlist as well
+func WithRepositoryDenylist(repositories ...string) Option {
+	return func(o *options) {
+		o.repositoryDenylist = repositorySet(repositories)
+	}
+}
+
+func repositorySet(repositories []string) map[string]struct{} {
+	if len(repositories) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(repositories))
+	for _, repository := range repositories {
+		set[repository] = struct{}{}
+	}
+	return set
+}
+
+// NamespaceBodyBuilder builds the fields of the namespace creation body sent to Huawei SWR, for the API
+// versions expecting a different schema
+type NamespaceBodyBuilder func(namespace string, auth NamespaceAuth) map[string]interface{}
+
+// WithNamespaceCreateBody replaces the builder of the namespace creation body, the minimal body with
+// the "namespace" and "auth" fields is sent by default
+func WithNamespaceCreateBody(builder NamespaceBodyBuilder) Option {
+	return func(o *options) {
+		o.namespaceCreateBody = builder
+	}
+}
+
+// WithNamespaceDescription sets the description of the namespaces created, so the users of the SWR console
+// know they're managed by the replication, "Managed by Harbor replication" by default. The empty description
+// sends none, and the description set by WithNamespaceCreateFields or the body builder takes precedence
+func WithNamespaceDescription(description string) Option {
+	return func(o *options) {
+		o.namespaceDescription = strings.TrimSpace(description)
+	}
+}
+
+// WithNamespaceCreateFields adds the extra fields, e.g. "description", to the namespace creation body,
+// the fields set by the body builder aren't overridden
+func WithNamespaceCreateFields(fields map[string]interface{}) Option {
+	return func(o *options) {
+		o.namespaceCreateFields = fields
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gock "gopkg.in/h2non/gock.v1"
+
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+func TestWithSettings(t *testing.T) {
+	o := newOptions(WithSettings(map[string]string{
+		SettingTimeoutSeconds: "30",
+		SettingMaxRetries:     "5",
+		SettingRetryBackoffMS: "200",
+		SettingForceHTTP1:     "true",
+	}))
+	assert.Equal(t, 30*time.Second, o.timeout)
+	assert.True(t, o.forceHTTP1)
+	assert.Equal(t, 6, o.namespaceCreateAttempts)
+	assert.Equal(t, 200*time.Millisecond, o.namespaceCreateBackoff)
+
+	// the absent and invalid settings keep the defaults
+	o = newOptions(WithSettings(map[string]string{
+		SettingTimeoutSeconds: "abc",
+		SettingMaxRetries:     "-1",
+		SettingForceHTTP1:     "yes",
+	}))
+	assert.False(t, o.forceHTTP1)
+	assert.Equal(t, time.Duration(0), o.timeout)
+	assert.Equal(t, defaultNamespaceCreateAttempts, o.namespaceCreateAttempts)
+	assert.Equal(t, defaultNamespaceCreateBackoff, o.namespaceCreateBackoff)
+
+	o = newOptions(WithSettings(nil))
+	assert.Equal(t, defaultNamespaceCreateAttempts, o.namespaceCreateAttempts)
+}
+
+func TestNewAdapterTimeout(t *testing.T) {
+	a := getMockAdapter(t, WithSettings(map[string]string{SettingTimeoutSeconds: "10"}))
+	assert.Equal(t, 10*time.Second, a.client.GetClient().Timeout)
+	assert.Equal(t, 10*time.Second, a.oriClient.Timeout)
+	assert.Equal(t, 10*time.Second, a.authClient.GetClient().Timeout)
+}
+
+func TestNewAdapterOperationTimeouts(t *testing.T) {
+	a := getMockAdapter(t, WithTimeout(10*time.Second), WithSettings(map[string]string{
+		SettingListTimeoutSeconds: "5",
+		SettingPushTimeoutSeconds: "300",
+	}))
+	assert.Equal(t, 5*time.Second, a.opts.listTimeout)
+	assert.Equal(t, time.Duration(0), a.opts.getTimeout)
+	assert.Equal(t, 300*time.Second, a.opts.pushTimeout)
+	assert.Equal(t, 10*time.Second, a.client.GetClient().Timeout)
+	require.NotNil(t, a.untimedClient)
+	assert.Equal(t, time.Duration(0), a.untimedClient.GetClient().Timeout)
+
+	// the non-positive timeouts keep the current ones
+	o := newOptions(WithOperationTimeouts(time.Second, time.Second, time.Second), WithOperationTimeouts(0, -1, 2*time.Second))
+	assert.Equal(t, time.Second, o.listTimeout)
+	assert.Equal(t, time.Second, o.getTimeout)
+	assert.Equal(t, 2*time.Second, o.pushTimeout)
+}
+
+func TestNewAdapterWithRegion(t *testing.T) {
+	for region, expected := range map[string]string{
+		"cn-north-4": "https://swr.cn-north-4.myhuaweicloud.com",
+		"eu-de":      "https://swr.eu-de.otc.t-systems.com",
+	} {
+		a := getMockAdapter(t, WithRegion(region), WithTimeout(5*time.Second), WithBasePath("/v2"))
+		assert.Equal(t, expected, a.registry.URL)
+		assert.Equal(t, expected+"/v2", a.apiBaseURL)
+		assert.Equal(t, 5*time.Second, a.client.GetClient().Timeout)
+	}
+
+	registry := &model.Registry{
+		URL:        "https://swr.cn-north-1.myhuaweicloud.com",
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+	}
+	_, err := newAdapter(registry, WithRegion("cn-north-4"))
+	assert.NoError(t, err)
+	// the registry passed in is kept untouched
+	assert.Equal(t, "https://swr.cn-north-1.myhuaweicloud.com", registry.URL)
+
+	_, err = newAdapter(registry, WithRegion("evil.com/x"))
+	assert.Error(t, err)
+}
+
+func TestAdapter_WithEnterpriseProjectID(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		MatchHeader("Enterprise-Project-Id", "^0c3c9a4f$").
+		Reply(200).BodyString(`{"namespaces":[]}`)
+	mockRequest().Get("/swr/auth/v2/registry/auth").
+		MatchHeader("Enterprise-Project-Id", "^0c3c9a4f$").
+		Reply(200).JSON(jwtToken{Token: "token"})
+	mockRequest().Get("/v2/ns/app/manifests/v1").
+		MatchHeader("Enterprise-Project-Id", "^0c3c9a4f$").
+		Reply(404)
+
+	a := getMockAdapter(t, WithSettings(map[string]string{SettingEnterpriseProjectID: "0c3c9a4f"}))
+	_, err := a.ListNamespaces(nil)
+	assert.NoError(t, err)
+	exist, _, err := a.ManifestExist("ns/app", "v1")
+	assert.NoError(t, err)
+	assert.False(t, exist)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_WithEnterpriseProjectIDNativeClient(t *testing.T) {
+	m := newMockRegistry(t)
+	a := m.adapter(t, WithSettings(map[string]string{SettingEnterpriseProjectID: "0c3c9a4f"}))
+
+	require.NoError(t, a.PushBlob("ns/app", "sha256:"+strings.Repeat("b", 64), 4, strings.NewReader("blob")))
+	pushes := m.received(http.MethodPut, "/blobs/uploads/")
+	require.Len(t, pushes, 1)
+	assert.Equal(t, "0c3c9a4f", pushes[0].Header.Get(enterpriseProjectHeader))
+	for _, r := range m.received(http.MethodGet, "/token") {
+		assert.Equal(t, "0c3c9a4f", r.Header.Get(enterpriseProjectHeader))
+	}
+}
+
+func TestWithPaginationLimit(t *testing.T) {
+	o := newOptions(WithPaginationLimit(10, 500))
+	assert.Equal(t, 10, o.maxPages)
+	assert.Equal(t, 500, o.maxItems)
+
+	o = newOptions(WithPaginationLimit(0, -1))
+	assert.Equal(t, defaultMaxPages, o.maxPages)
+	assert.Equal(t, defaultMaxItems, o.maxItems)
+}
+
+func TestWithHeaders(t *testing.T) {
+	o := newOptions(WithHeaders(map[string]string{"x-gateway-key": "key", "Authorization": "Basic evil"}),
+		WithHeaders(map[string]string{"X-Team": "infra", "host": "evil.com"}))
+	assert.Equal(t, map[string]string{"X-Gateway-Key": "key", "X-Team": "infra"}, o.headers)
+
+	o = newOptions(WithSettings(map[string]string{SettingHeaders: `{"X-Gateway-Key":"key"}`}))
+	assert.Equal(t, map[string]string{"X-Gateway-Key": "key"}, o.headers)
+
+	o = newOptions(WithSettings(map[string]string{SettingHeaders: `not json`}))
+	assert.Empty(t, o.headers)
+}
+
+func TestAdapter_WithHeaders(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		MatchHeader("X-Gateway-Key", "^secret$").
+		MatchHeader("Authorization", "^Basic ").
+		Reply(200).BodyString(`{"namespaces":[]}`)
+	mockRequest().Get("/swr/auth/v2/registry/auth").
+		MatchHeader("X-Gateway-Key", "^secret$").
+		Reply(200).JSON(jwtToken{Token: "token"})
+	mockRequest().Get("/v2/ns/app/manifests/v1").
+		MatchHeader("X-Gateway-Key", "^secret$").
+		MatchHeader("Authorization", "^Bearer token$").
+		Reply(404)
+
+	a := getMockAdapter(t, WithHeaders(map[string]string{"X-Gateway-Key": "secret", "Authorization": "Basic evil"}))
+	_, err := a.ListNamespaces(nil)
+	assert.NoError(t, err)
+	exist, _, err := a.ManifestExist("ns/app", "v1")
+	assert.NoError(t, err)
+	assert.False(t, exist)
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_WithHeadersNativeClient(t *testing.T) {
+	m := newMockRegistry(t)
+	a := m.adapter(t, WithHeaders(map[string]string{"X-Gateway-Key": "secret"}))
+
+	require.NoError(t, a.PushBlob("ns/app", "sha256:"+strings.Repeat("b", 64), 4, strings.NewReader("blob")))
+	_, err := a.PushManifest("ns/app", "v1", "application/vnd.oci.image.manifest.v1+json", []byte(`{}`))
+	require.NoError(t, err)
+
+	pushes := append(m.received(http.MethodPut, "/blobs/uploads/"), m.received(http.MethodPut, "/manifests/")...)
+	require.Len(t, pushes, 2)
+	tokens := m.received(http.MethodGet, "/token")
+	require.NotEmpty(t, tokens)
+	for _, r := range append(pushes, tokens...) {
+		assert.Equal(t, "secret", r.Header.Get("X-Gateway-Key"), r.URL.Path)
+	}
+}
+
+func TestAdapter_WithAcceptLanguage(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		MatchHeader("Accept-Language", "^en-US$").
+		Reply(200).BodyString(`{"namespaces":[]}`)
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		MatchHeader("Accept-Language", "^zh-CN$").
+		Reply(200).BodyString(`{"namespaces":[]}`)
+	mockRequest().Get("/swr/auth/v2/registry/auth").
+		MatchHeader("Accept-Language", "^zh-CN$").
+		Reply(200).JSON(jwtToken{Token: "token"})
+	mockRequest().Get("/v2/ns/app/manifests/v1").
+		MatchHeader("Accept-Language", "^zh-CN$").
+		Reply(404)
+
+	_, err := getMockAdapter(t).ListNamespaces(nil)
+	assert.NoError(t, err)
+	a := getMockAdapter(t, WithSettings(map[string]string{SettingAcceptLanguage: "zh-CN"}))
+	_, err = a.ListNamespaces(nil)
+	assert.NoError(t, err)
+	exist, _, err := a.ManifestExist("ns/app", "v1")
+	assert.NoError(t, err)
+	assert.False(t, exist)
+	assert.True(t, gock.IsDone())
+
+	assert.Empty(t, newOptions(WithAcceptLanguage(" ")).acceptLanguage)
+}
+
+func TestAdapter_WithAcceptLanguageNativeClient(t *testing.T) {
+	m := newMockRegistry(t)
+	a := m.adapter(t, WithSettings(map[string]string{SettingAcceptLanguage: "zh-CN"}))
+
+	_, err := a.PushManifest("ns/app", "v1", "application/vnd.oci.image.manifest.v1+json", []byte(`{}`))
+	require.NoError(t, err)
+	_, _, err = a.PullManifest("ns/app", "v1")
+	require.NoError(t, err)
+	manifests := append(m.received(http.MethodPut, "/manifests/"), m.received(http.MethodGet, "/manifests/")...)
+	require.Len(t, manifests, 2)
+	for _, r := range append(manifests, m.received(http.MethodGet, "/token")...) {
+		assert.Equal(t, "zh-CN", r.Header.Get("Accept-Language"), r.URL.Path)
+	}
+}
+
+func TestWithSettingsNamespacePolicy(t *testing.T) {
+	o := newOptions(WithSettings(map[string]string{
+		SettingNamespaceAuth: "public",
+		SettingImmutableTags: "true",
+	}))
+	assert.Equal(t, NamespaceAuthPublic, o.namespaceAuth)
+	assert.True(t, o.immutableTags)
+
+	o = newOptions(WithSettings(map[string]string{
+		SettingNamespaceAuth: "readonly",
+		SettingImmutableTags: "maybe",
+	}))
+	assert.Equal(t, NamespaceAuthPrivate, o.namespaceAuth)
+	assert.False(t, o.immutableTags)
+}
+
+func TestAdapter_PrepareForPushImmutableTags(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/ns1").Reply(200).BodyString("{}")
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"ns1","auth":1,"description":"Managed by Harbor replication"}`).Reply(201)
+
+	// the unsupported immutability doesn't fail the creation
+	a := getMockAdapter(t, WithSettings(map[string]string{
+		SettingNamespaceAuth: "public",
+		SettingImmutableTags: "true",
+	}))
+	resources := []*model.Resource{
+		{Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: "ns1/app"}}},
+	}
+	assert.NoError(t, a.PrepareForPush(resources))
+	assert.True(t, gock.IsDone())
+}
+
+func TestWithAdaptiveConcurrency(t *testing.T) {
+	o := newOptions()
+	assert.Equal(t, 0, o.maxConcurrency)
+
+	o = newOptions(WithAdaptiveConcurrency(0, 8))
+	assert.Equal(t, 1, o.minConcurrency)
+	assert.Equal(t, 8, o.maxConcurrency)
+
+	o = newOptions(WithAdaptiveConcurrency(4, 2))
+	assert.Equal(t, 4, o.minConcurrency)
+	assert.Equal(t, 4, o.maxConcurrency)
+
+	o = newOptions(WithSettings(map[string]string{SettingMinConcurrency: "2", SettingMaxConcurrency: "10"}))
+	assert.Equal(t, 2, o.minConcurrency)
+	assert.Equal(t, 10, o.maxConcurrency)
+
+	// the lower bound alone doesn't enable it
+	o = newOptions(WithSettings(map[string]string{SettingMinConcurrency: "2"}))
+	assert.Equal(t, 0, o.maxConcurrency)
+}
+
+func TestWithSettingsMediaTypes(t *testing.T) {
+	o := newOptions(WithSettings(map[string]string{
+		SettingMediaTypes: "application/vnd.docker.distribution.manifest.*, application/vnd.oci.image.manifest.v1+json,",
+	}))
+	assert.Equal(t, []string{"application/vnd.docker.distribution.manifest.*", "application/vnd.oci.image.manifest.v1+json"}, o.mediaTypes)
+}
+
+func TestWithSettingsFallbackNamespaces(t *testing.T) {
+	o := newOptions(WithSettings(map[string]string{
+		SettingFallbackNamespaces: " team_a,,team_b ",
+	}))
+	assert.Equal(t, []string{"team_a", "team_b"}, o.fallbackNamespaces)
+}
+
+func TestWithSettingsRepositoryLists(t *testing.T) {
+	o := newOptions(WithSettings(map[string]string{
+		SettingRepositoryAllowlist: "library/nginx, library/redis",
+		SettingRepositoryDenylist:  "",
+	}))
+	assert.Equal(t, map[string]struct{}{"library/nginx": {}, "library/redis": {}}, o.repositoryAllowlist)
+	// the empty list means no restriction
+	assert.Nil(t, o.repositoryDenylist)
+}
@@ -0,0 +1,114 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// PreflightResult is the result of Preflight, it tells the endpoint problems and the
+// credential problems apart so the operator knows what to fix
+type PreflightResult struct {
+	// Reachable is true if the TCP connection, and the TLS handshake for HTTPS, to SWR succeed
+	Reachable bool
+	// Authenticated is true if SWR accepts the credential, it's only checked when SWR is reachable
+	Authenticated bool
+	// Reason describes the failing check, empty if all the checks pass
+	Reason string
+	// Err is the error of the failing check, nil if all the checks pass
+	Err error
+}
+
+// Preflight validates the endpoint and the credential of Huawei SWR separately when setting
+// up the registry interactively: the connection to the management API is established first,
+// then an authenticated call is sent. It's more granular than PingRegistry, which reports the
+// first failure only, and shouldn't be used for the periodical health checks
+func (a *adapter) Preflight(ctx context.Context) *PreflightResult {
+	result := &PreflightResult{}
+	if err := a.checkReachable(ctx); err != nil {
+		result.Reason = fmt.Sprintf("failed to connect to %s: %v", a.apiBaseURL, err)
+		result.Err = err
+		return result
+	}
+	result.Reachable = true
+
+	if err := a.PingRegistry(); err != nil {
+		switch {
+		case errors.Is(err, ErrUnauthorized):
+			result.Reason = fmt.Sprintf("the credential is rejected: %v", err)
+		case errors.Is(err, ErrUnreachable):
+			result.Reachable = false
+			result.Reason = fmt.Sprintf("failed to connect to %s: %v", a.apiBaseURL, err)
+		default:
+			result.Reason = fmt.Sprintf("failed to validate the credential: %v", err)
+		}
+		result.Err = err
+		return result
+	}
+	result.Authenticated = true
+	return result
+}
+
+// checkReachable establishes a connection to the host of the management API, and completes the
+// TLS handshake for HTTPS, without sending any request
+func (a *adapter) checkReachable(ctx context.Context) error {
+	u, err := url.Parse(a.apiBaseURL)
+	if err != nil {
+		return err
+	}
+	port := u.Port()
+	if len(port) == 0 {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	address := net.JoinHostPort(u.Hostname(), port)
+
+	dialer := &net.Dialer{Timeout: a.opts.connectTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return classifyTransportError(err)
+	}
+	defer conn.Close()
+	if u.Scheme == "http" {
+		return nil
+	}
+
+	insecure := a.registry.Insecure
+	if a.opts.apiInsecure != nil {
+		insecure = *a.opts.apiInsecure
+	}
+	serverName := u.Hostname()
+	if len(a.opts.tlsServerName) > 0 {
+		serverName = a.opts.tlsServerName
+	}
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecure,
+		MinVersion:         a.opts.tlsMinVersion,
+	})
+	ctx, cancel := context.WithTimeout(ctx, a.opts.connectTimeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return classifyTransportError(err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+func newPreflightAdapter(t *testing.T, url string, insecure bool) *adapter {
+	adp, err := newAdapter(&model.Registry{
+		URL:        url,
+		Insecure:   insecure,
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+	})
+	require.NoError(t, err)
+	return adp.(*adapter)
+}
+
+func TestAdapter_Preflight(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/dockyard/v2/visible/namespaces", r.URL.Path)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"namespaces":[]}`))
+	}))
+	defer server.Close()
+
+	result := newPreflightAdapter(t, server.URL, true).Preflight(context.Background())
+	assert.True(t, result.Reachable)
+	assert.True(t, result.Authenticated)
+	assert.Empty(t, result.Reason)
+	assert.NoError(t, result.Err)
+
+	status = http.StatusUnauthorized
+	result = newPreflightAdapter(t, server.URL, true).Preflight(context.Background())
+	assert.True(t, result.Reachable)
+	assert.False(t, result.Authenticated)
+	assert.Contains(t, result.Reason, "credential")
+	assert.True(t, errors.Is(result.Err, ErrUnauthorized))
+}
+
+func TestAdapter_PreflightUnreachable(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	// the certificate of the test server isn't trusted
+	result := newPreflightAdapter(t, server.URL, false).Preflight(context.Background())
+	assert.False(t, result.Reachable)
+	assert.False(t, result.Authenticated)
+	assert.True(t, errors.Is(result.Err, ErrTLS))
+
+	server.Close()
+	result = newPreflightAdapter(t, server.URL, true).Preflight(context.Background())
+	assert.False(t, result.Reachable)
+	assert.False(t, result.Authenticated)
+	assert.NotEmpty(t, result.Reason)
+	assert.True(t, errors.Is(result.Err, ErrUnreachable))
+}
@@ -0,0 +1,51 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+// ProgressEventType is the type of the progress events reported by the adapter
+type ProgressEventType string
+
+const (
+	// ProgressNamespaceFetched is reported when the repositories of a namespace are fetched by FetchArtifacts
+	ProgressNamespaceFetched ProgressEventType = "namespace_fetched"
+	// ProgressNamespaceCreated is reported when a namespace is created by PrepareForPush
+	ProgressNamespaceCreated ProgressEventType = "namespace_created"
+	// ProgressNamespaceExists is reported when a namespace to be created by PrepareForPush already exists
+	ProgressNamespaceExists ProgressEventType = "namespace_exists"
+	// ProgressManifestPushed is reported when a manifest is pushed to a repository
+	ProgressManifestPushed ProgressEventType = "manifest_pushed"
+)
+
+// ProgressEvent describes a step of the replication processed by the adapter, the fields
+// not related to the type of the event are left empty
+type ProgressEvent struct {
+	Type       ProgressEventType
+	Namespace  string
+	Repository string
+	Reference  string
+	// Count is the number of the repositories matched in the namespace for ProgressNamespaceFetched
+	Count int
+}
+
+// ProgressFunc receives the progress events, see WithProgress. It may be called concurrently,
+// e.g. when the manifests are pushed by multiple workers, and shouldn't block
+type ProgressFunc func(ProgressEvent)
+
+// reportProgress passes the event to the progress callback if it's set
+func (a *adapter) reportProgress(event ProgressEvent) {
+	if a.opts.progress != nil {
+		a.opts.progress(event)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	gock "gopkg.in/h2non/gock.v1"
+
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+	"github.com/goharbor/harbor/src/testing/pkg/registry"
+)
+
+func TestAdapter_Progress(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/namespaces/ns1").Reply(200).BodyString("{}")
+	mockRequest().Get("/dockyard/v2/namespaces/ns2").Reply(200).BodyString("{}")
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"ns1","auth":0,"description":"Managed by Harbor replication"}`).Reply(201)
+	mockRequest().Post("/dockyard/v2/namespaces").BodyString(`{"namespace":"ns2","auth":0,"description":"Managed by Harbor replication"}`).Reply(409)
+
+	var events []ProgressEvent
+	a := getMockAdapter(t, WithProgress(func(e ProgressEvent) {
+		events = append(events, e)
+	}))
+	client := &registry.Client{}
+	a.Adapter.Client = client
+	client.On("PushManifest", "ns1/app", "v1", mock.Anything, mock.Anything).Return("sha256:manifest", nil)
+
+	resources := []*model.Resource{
+		{Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: "ns1/app"}}},
+		{Metadata: &model.ResourceMetadata{Repository: &model.Repository{Name: "ns2/app"}}},
+	}
+	assert.NoError(t, a.PrepareForPush(resources))
+	_, err := a.PushManifest("ns1/app", "v1", "application/vnd.oci.image.manifest.v1+json", []byte("{}"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []ProgressEvent{
+		{Type: ProgressNamespaceCreated, Namespace: "ns1"},
+		{Type: ProgressNamespaceExists, Namespace: "ns2"},
+		{Type: ProgressManifestPushed, Repository: "ns1/app", Reference: "v1"},
+	}, events)
+}
+
+func TestAdapter_ProgressNil(t *testing.T) {
+	a := getMockAdapter(t)
+	client := &registry.Client{}
+	a.Adapter.Client = client
+	client.On("PushManifest", "ns1/app", "v1", mock.Anything, mock.Anything).Return("sha256:manifest", nil)
+
+	_, err := a.PushManifest("ns1/app", "v1", "application/vnd.oci.image.manifest.v1+json", []byte("{}"))
+	assert.NoError(t, err)
+}
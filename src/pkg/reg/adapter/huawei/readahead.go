@@ -0,0 +1,119 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"io"
+)
+
+// readAheadChunks is the max number of the chunks read ahead of the upload, which bounds the memory
+// buffered per upload while letting the source run ahead over the bursts of the latency
+const readAheadChunks = 4
+
+// readAheadReader reads the chunks read ahead from the source by the goroutine started by readAhead
+type readAheadReader struct {
+	// chunks are the chunks read ahead, it's closed once the source is drained or fails
+	chunks chan []byte
+	// err is the error the source fails with, set before chunks is closed
+	err error
+	// current is the rest of the chunk being consumed
+	current []byte
+	// stopped is closed once the upload returns, finished once the goroutine returns
+	stopped  chan struct{}
+	finished chan struct{}
+}
+
+// Read ...
+func (r *readAheadReader) Read(p []byte) (int, error) {
+	if len(r.current) == 0 {
+		select {
+		case <-r.stopped:
+			return 0, io.ErrClosedPipe
+		default:
+		}
+		select {
+		case chunk, ok := <-r.chunks:
+			if !ok {
+				if r.err != nil {
+					return 0, r.err
+				}
+				return 0, io.EOF
+			}
+			r.current = chunk
+		case <-r.stopped:
+			return 0, io.ErrClosedPipe
+		}
+	}
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+	return n, nil
+}
+
+// readAhead returns the reader of the blob read ahead in the chunks set by WithUploadBufferSize, or
+// the blob itself if it isn't set. The returned function must be called once the upload returns, it
+// stops the reading ahead if the upload fails before consuming the whole blob, and closes the blob if
+// the goroutine is still reading it, so a read blocking on the source doesn't leak the goroutine
+func (a *adapter) readAhead(blob io.Reader) (io.Reader, func()) {
+	if a.opts.uploadBufferSize <= 0 || blob == nil {
+		return blob, func() {}
+	}
+	r := &readAheadReader{
+		chunks:   make(chan []byte, readAheadChunks),
+		stopped:  make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	size := a.opts.uploadBufferSize
+	go func() {
+		defer close(r.finished)
+		defer close(r.chunks)
+		for {
+			// the chunk is filled unless the source ends or fails
+			chunk := make([]byte, size)
+			var (
+				n   int
+				err error
+			)
+			for n < size && err == nil {
+				var m int
+				m, err = blob.Read(chunk[n:])
+				n += m
+			}
+			if n > 0 {
+				select {
+				case r.chunks <- chunk[:n]:
+				case <-r.stopped:
+					return
+				}
+			}
+			if err != nil {
+				if err != io.EOF {
+					r.err = err
+				}
+				return
+			}
+		}
+	}()
+	return r, func() {
+		close(r.stopped)
+		select {
+		case <-r.finished:
+		default:
+			// the source is closed by its owner as well, closing it here only interrupts the pending read
+			if closer, ok := blob.(io.Closer); ok {
+				_ = closer.Close()
+			}
+		}
+	}
+}
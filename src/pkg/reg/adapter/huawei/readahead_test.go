@@ -0,0 +1,198 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+	"github.com/goharbor/harbor/src/testing/pkg/registry"
+)
+
+func TestAdapter_ReadAhead(t *testing.T) {
+	a := &adapter{opts: newOptions()}
+	blob := strings.NewReader("layer")
+	r, closeBlob := a.readAhead(blob)
+	closeBlob()
+	// the blob is streamed as is by default
+	assert.Same(t, blob, r)
+
+	a = &adapter{opts: newOptions(WithUploadBufferSize(4))}
+	content := strings.Repeat("layer content ", 100)
+	r, closeBlob = a.readAhead(strings.NewReader(content))
+	data, err := io.ReadAll(r)
+	closeBlob()
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+
+	// the failed upload stops the reading ahead
+	r, closeBlob = a.readAhead(strings.NewReader(content))
+	buf := make([]byte, 4)
+	_, err = r.Read(buf)
+	require.NoError(t, err)
+	closeBlob()
+	_, err = r.Read(buf)
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+
+	assert.Equal(t, 256<<10, newOptions(WithSettings(map[string]string{SettingUploadBufferKB: "256"})).uploadBufferSize)
+	assert.Equal(t, 0, newOptions(WithUploadBufferSize(-1)).uploadBufferSize)
+}
+
+// countingReader counts the reads of the source
+type countingReader struct {
+	r     io.Reader
+	reads atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.reads.Add(1)
+	return c.r.Read(p)
+}
+
+// blockingReader blocks the reads until it's closed, e.g. the body of a stalled source registry
+type blockingReader struct {
+	closed chan struct{}
+}
+
+func (b *blockingReader) Read([]byte) (int, error) {
+	<-b.closed
+	return 0, errors.New("read on closed body")
+}
+
+func (b *blockingReader) Close() error {
+	close(b.closed)
+	return nil
+}
+
+func TestAdapter_ReadAheadBounded(t *testing.T) {
+	a := &adapter{opts: newOptions(WithUploadBufferSize(4))}
+	source := &countingReader{r: strings.NewReader(strings.Repeat("layer content ", 100))}
+	_, closeBlob := a.readAhead(source)
+	defer closeBlob()
+
+	// the source runs ahead of the consumer by the buffered chunks plus the one waiting to be buffered
+	assert.Eventually(t, func() bool {
+		return source.reads.Load() == readAheadChunks+1
+	}, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, int64(readAheadChunks+1), source.reads.Load())
+}
+
+func TestAdapter_ReadAheadStalledSource(t *testing.T) {
+	a := &adapter{opts: newOptions(WithUploadBufferSize(4))}
+	source := &blockingReader{closed: make(chan struct{})}
+	r, closeBlob := a.readAhead(source)
+
+	// the upload gives up while the source is stalled, the source is closed so the goroutine returns
+	closeBlob()
+	select {
+	case <-r.(*readAheadReader).finished:
+	case <-time.After(time.Second):
+		t.Fatal("the goroutine reading ahead leaks")
+	}
+	_, err := r.Read(make([]byte, 4))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+// pushBlobClient consumes the pushed blobs with the function, the testify mock isn't used as it
+// formats the pipe read ahead concurrently
+type pushBlobClient struct {
+	*registry.Client
+	push func(blob io.Reader)
+}
+
+func (c *pushBlobClient) PushBlob(_, _ string, _ int64, blob io.Reader) error {
+	c.push(blob)
+	return nil
+}
+
+func TestAdapter_PushBlobReadAhead(t *testing.T) {
+	content := strings.Repeat("layer content ", 100)
+	var pushed string
+	a := getMockAdapter(t, WithUploadBufferSize(64))
+	a.Adapter.Client = &pushBlobClient{push: func(blob io.Reader) {
+		data, err := io.ReadAll(blob)
+		assert.NoError(t, err)
+		pushed = string(data)
+	}}
+	assert.NoError(t, a.PushBlob("ns/app", "sha256:layer", int64(len(content)), strings.NewReader(content)))
+	assert.Equal(t, content, pushed)
+	assert.Equal(t, int64(1), a.PushStats().BlobsPushed)
+}
+
+// latencyReader and latencyWriter delay every read and write of at most 32 KiB, which simulates
+// streaming a blob from the source registry to SWR over the high RTT links
+type latencyReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (l *latencyReader) Read(p []byte) (int, error) {
+	time.Sleep(l.delay)
+	if len(p) > 32<<10 {
+		p = p[:32<<10]
+	}
+	return l.r.Read(p)
+}
+
+type latencyWriter struct {
+	delay time.Duration
+}
+
+func (l *latencyWriter) Write(p []byte) (int, error) {
+	for n := len(p); n > 0; n -= 32 << 10 {
+		time.Sleep(l.delay)
+	}
+	return len(p), nil
+}
+
+func BenchmarkPushBlobReadAhead(b *testing.B) {
+	content := bytes.Repeat([]byte("x"), 8<<20)
+	for name, size := range map[string]int{
+		"default": 0,
+		"1MiB":    1 << 20,
+	} {
+		b.Run(name, func(b *testing.B) {
+			client := &pushBlobClient{push: func(blob io.Reader) {
+				_, _ = io.Copy(&latencyWriter{delay: 200 * time.Microsecond}, blob)
+			}}
+			adp, err := newAdapter(&model.Registry{
+				URL:        "https://swr.cn-north-1.myhuaweicloud.com",
+				Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+			}, WithUploadBufferSize(size))
+			require.NoError(b, err)
+			a := adp.(*adapter)
+			a.Adapter.Client = client
+
+			b.SetBytes(int64(len(content)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				blob := &latencyReader{r: bytes.NewReader(content), delay: 200 * time.Microsecond}
+				if err := a.PushBlob("ns/app", "sha256:blob", int64(len(content)), blob); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
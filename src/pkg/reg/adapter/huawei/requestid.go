@@ -0,0 +1,41 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// requestIDHeader carries the ID correlating the request sent to Huawei SWR with the traces of Harbor,
+// SWR echoes it back in the response
+const requestIDHeader = "X-Request-Id"
+
+// requestIDModifier sets a unique ID generated per request, see WithRequestIDs
+type requestIDModifier struct {
+	generate func() string
+}
+
+// Modify ...
+func (m *requestIDModifier) Modify(req *http.Request) error {
+	req.Header.Set(requestIDHeader, m.generate())
+	return nil
+}
+
+// newRequestID generates a random UUID as the request ID
+func newRequestID() string {
+	return uuid.NewString()
+}
@@ -0,0 +1,113 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gock "gopkg.in/h2non/gock.v1"
+
+	"github.com/goharbor/harbor/src/lib/log"
+)
+
+func TestAdapter_WithRequestIDs(t *testing.T) {
+	defer gock.Off()
+	mockRequest().Post("/dockyard/v2/namespaces").
+		MatchHeader(requestIDHeader, "^req-1$").
+		Reply(201).
+		SetHeader(requestIDHeader, "req-1")
+	mockRequest().Post("/dockyard/v2/namespaces").
+		MatchHeader(requestIDHeader, "^req-2$").
+		Reply(201).
+		SetHeader(requestIDHeader, "gateway-id")
+
+	var n int
+	buf := &bytes.Buffer{}
+	a := getMockAdapter(t, WithHeaders(map[string]string{requestIDHeader: "static"}), WithRequestIDs(func() string {
+		n++
+		return fmt.Sprintf("req-%d", n)
+	}))
+	a.baseLogger = log.New(buf, log.NewTextFormatter(), log.DebugLevel)
+
+	assert.NoError(t, a.CreateNamespace("ns1", NamespaceAuthPrivate))
+	assert.Contains(t, buf.String(), `requestID="req-1"`)
+	assert.NotContains(t, buf.String(), "[WARNING]")
+
+	// the mismatched echo is logged
+	buf.Reset()
+	assert.NoError(t, a.CreateNamespace("ns1", NamespaceAuthPrivate))
+	assert.Contains(t, buf.String(), `requestID="req-2"`)
+	assert.Contains(t, buf.String(), "echoed the request id gateway-id instead of req-2")
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_WithRequestIDsNativeClient(t *testing.T) {
+	m := newMockRegistry(t, func(s *httptest.Server) {
+		next := s.Config.Handler
+		s.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestIDHeader)
+			if r.Method == http.MethodPut {
+				id = "gateway-id"
+			}
+			w.Header().Set(requestIDHeader, id)
+			next.ServeHTTP(w, r)
+		})
+	})
+	var n atomic.Int64
+	buf := &bytes.Buffer{}
+	a := m.adapter(t, WithRequestIDs(func() string {
+		return fmt.Sprintf("req-%d", n.Add(1))
+	}))
+	a.baseLogger = log.New(buf, log.NewTextFormatter(), log.DebugLevel)
+
+	_, err := a.PushManifest("ns/app", "v1", "application/vnd.oci.image.manifest.v1+json", []byte(`{}`))
+	require.NoError(t, err)
+	pushes := m.received(http.MethodPut, "/manifests/")
+	require.Len(t, pushes, 1)
+	id := pushes[0].Header.Get(requestIDHeader)
+	assert.Regexp(t, "^req-[0-9]+$", id)
+	assert.Contains(t, buf.String(), fmt.Sprintf(`requestID="%s"`, id))
+	assert.Contains(t, buf.String(), "echoed the request id gateway-id instead of "+id)
+
+	// each request of the native client, the token included, carries its own ID
+	ids := map[string]bool{}
+	for _, r := range m.received(http.MethodGet, "") {
+		ids[r.Header.Get(requestIDHeader)] = true
+	}
+	assert.NotContains(t, ids, "")
+	assert.Len(t, ids, len(m.received(http.MethodGet, "")))
+}
+
+func TestAdapter_WithRequestIDsSetting(t *testing.T) {
+	defer gock.Off()
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		MatchHeader(requestIDHeader, "^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$").
+		Reply(200).
+		BodyString("[]")
+
+	a := getMockAdapter(t, WithSettings(map[string]string{SettingRequestIDs: "true"}))
+	assert.NoError(t, a.PingRegistry())
+	assert.True(t, gock.IsDone())
+
+	assert.Nil(t, newOptions().requestID)
+	assert.Nil(t, newOptions(WithRequestIDs(nil), WithSettings(map[string]string{SettingRequestIDs: "false"})).requestID)
+}
@@ -0,0 +1,181 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goharbor/harbor/src/lib/log"
+)
+
+// uploadSession is the chunked blob upload interrupted in the middle, see WithResumableUploads
+type uploadSession struct {
+	location string
+	// offset is the first byte of the blob not acknowledged by SWR yet
+	offset    int64
+	updatedAt time.Time
+}
+
+// uploadSessions tracks the interrupted blob uploads per repository and digest
+type uploadSessions struct {
+	sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*uploadSession
+}
+
+// record keeps the progress of the upload, the sessions expired are dropped meanwhile
+func (s *uploadSessions) record(key, location string, offset int64) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	for k, session := range s.sessions {
+		if now.Sub(session.updatedAt) > s.ttl {
+			delete(s.sessions, k)
+		}
+	}
+	if s.sessions == nil {
+		s.sessions = map[string]*uploadSession{}
+	}
+	s.sessions[key] = &uploadSession{location: location, offset: offset, updatedAt: now}
+}
+
+// get returns the session of the upload unless it's expired
+func (s *uploadSessions) get(key string) (*uploadSession, bool) {
+	s.Lock()
+	defer s.Unlock()
+	session, ok := s.sessions[key]
+	if !ok || time.Since(session.updatedAt) > s.ttl {
+		return nil, false
+	}
+	return session, true
+}
+
+func (s *uploadSessions) forget(key string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.sessions, key)
+}
+
+// pushBlobChunk pushes the chunk and resumes the upload interrupted before if WithResumableUploads is set.
+// The first chunk of a blob whose upload is tracked continues the session from the offset SWR reports,
+// so the chunks or the bytes acknowledged already are skipped rather than uploaded again
+func (a *adapter) pushBlobChunk(repository, digest string, size int64, chunk io.Reader, start, end int64, location string) (string, int64, error) {
+	if a.opts.uploadSessionTTL <= 0 {
+		return a.Adapter.PushBlobChunk(repository, digest, size, chunk, start, end, location)
+	}
+	key := repository + "@" + digest
+	if start == 0 {
+		if resumed, ok := a.resumeUpload(repository, digest, key); ok {
+			location = resumed
+		}
+	}
+	if session, ok := a.uploads.get(key); ok && session.location == location && session.offset > start && session.offset < size {
+		if session.offset > end {
+			log.Debugf("the chunk %d-%d of the blob %s is acknowledged by %s already, skip", start, end, digest, repository)
+			return location, end, nil
+		}
+		if _, err := io.CopyN(io.Discard, chunk, session.offset-start); err != nil {
+			return location, start - 1, err
+		}
+		start = session.offset
+	}
+
+	nextLocation, endRange, err := a.Adapter.PushBlobChunk(repository, digest, size, chunk, start, end, location)
+	switch {
+	case err == nil && end == size-1:
+		a.uploads.forget(key)
+	case err == nil:
+		a.uploads.record(key, nextLocation, end+1)
+	case endRange >= 0:
+		a.uploads.record(key, nextLocation, endRange+1)
+	}
+	return nextLocation, endRange, err
+}
+
+// resumeUpload verifies the tracked session of the upload with SWR, the location to continue the upload
+// is returned if the session is still alive and has bytes acknowledged. The sessions expired on SWR are
+// dropped, so the upload starts over
+func (a *adapter) resumeUpload(repository, digest, key string) (string, bool) {
+	session, ok := a.uploads.get(key)
+	if !ok {
+		return "", false
+	}
+	location, offset, err := a.uploadStatus(repository, session.location)
+	if err != nil {
+		log.Infof("failed to resume the upload of the blob %s to %s, starting over: %v", digest, repository, err)
+		a.uploads.forget(key)
+		return "", false
+	}
+	if offset <= 0 {
+		a.uploads.forget(key)
+		return "", false
+	}
+	log.Infof("resuming the upload of the blob %s to %s from the offset %d", digest, repository, offset)
+	a.uploads.record(key, location, offset)
+	return location, true
+}
+
+// uploadStatus queries the progress of the upload session, the location of the session and the first
+// byte not acknowledged are returned
+func (a *adapter) uploadStatus(repository, location string) (string, int64, error) {
+	base, err := url.Parse(a.registry.URL)
+	if err != nil {
+		return "", 0, err
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid location %s of the upload: %w", location, err)
+	}
+	token, err := getJwtToken(a, repository)
+	if err != nil {
+		return "", 0, err
+	}
+	r, err := http.NewRequest(http.MethodGet, base.ResolveReference(ref).String(), nil)
+	if err != nil {
+		return "", 0, err
+	}
+	r.Header.Add("Authorization", "Bearer "+token.Token)
+
+	start := time.Now()
+	resp, err := a.doRegistry(r)
+	logResponse(a.logger("GetUploadStatus", log.Fields{"repository": repository}), r, resp, err, start)
+	if err != nil {
+		return "", 0, classifyTransportError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
+		return "", 0, classifyStatusError(a.newError(resp))
+	}
+	// the range is "0-<the last byte received>"
+	_, last, found := strings.Cut(resp.Header.Get("Range"), "-")
+	if !found {
+		return "", 0, fmt.Errorf("invalid range %q of the upload", resp.Header.Get("Range"))
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid range %q of the upload: %w", resp.Header.Get("Range"), err)
+	}
+	if next := resp.Header.Get("Location"); len(next) > 0 {
+		location = next
+	}
+	return location, end + 1, nil
+}
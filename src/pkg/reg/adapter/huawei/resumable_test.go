@@ -0,0 +1,129 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	gock "gopkg.in/h2non/gock.v1"
+
+	"github.com/goharbor/harbor/src/testing/pkg/registry"
+)
+
+type chunkCall struct {
+	start, end int64
+	location   string
+	data       string
+}
+
+// chunkClient records the chunks pushed and replies them by the reply function
+type chunkClient struct {
+	*registry.Client
+	calls []chunkCall
+	reply func(call chunkCall) (string, int64, error)
+}
+
+func (c *chunkClient) PushBlobChunk(_, _ string, _ int64, chunk io.Reader, start, end int64, location string) (string, int64, error) {
+	data, _ := io.ReadAll(chunk)
+	call := chunkCall{start: start, end: end, location: location, data: string(data)}
+	c.calls = append(c.calls, call)
+	return c.reply(call)
+}
+
+func TestAdapter_PushBlobChunkResumable(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	blob := "0123456789abcdefghijKLMNOPQRST"
+	chunk := func(start, end int64) io.Reader {
+		return strings.NewReader(blob[start : end+1])
+	}
+	a := getMockAdapter(t, WithResumableUploads(time.Hour))
+	client := &chunkClient{}
+	a.Adapter.Client = client
+
+	// the first job is interrupted after SWR acknowledges "0-14"
+	client.reply = func(call chunkCall) (string, int64, error) {
+		if call.start == 10 {
+			return "/v2/ns/app/blobs/uploads/u2", 14, errors.New("connection reset")
+		}
+		return "/v2/ns/app/blobs/uploads/u1", call.end, nil
+	}
+	_, _, err := a.PushBlobChunk("ns/app", "sha256:blob", 30, chunk(0, 9), 0, 9, "")
+	assert.NoError(t, err)
+	_, _, err = a.PushBlobChunk("ns/app", "sha256:blob", 30, chunk(10, 19), 10, 19, "/v2/ns/app/blobs/uploads/u1")
+	assert.Error(t, err)
+
+	// the retried job resumes from the offset verified with SWR
+	mockGetJwtToken("ns/app")
+	mockRequest().Get("/v2/ns/app/blobs/uploads/u2").
+		Reply(204).
+		SetHeader("Range", "0-14").
+		SetHeader("Location", "/v2/ns/app/blobs/uploads/u3")
+	client.calls = nil
+	client.reply = func(call chunkCall) (string, int64, error) {
+		return "/v2/ns/app/blobs/uploads/u4", call.end, nil
+	}
+	location, end, err := a.PushBlobChunk("ns/app", "sha256:blob", 30, chunk(0, 9), 0, 9, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "/v2/ns/app/blobs/uploads/u3", location)
+	assert.Equal(t, int64(9), end)
+	location, _, err = a.PushBlobChunk("ns/app", "sha256:blob", 30, chunk(10, 19), 10, 19, location)
+	assert.NoError(t, err)
+	_, _, err = a.PushBlobChunk("ns/app", "sha256:blob", 30, chunk(20, 29), 20, 29, location)
+	assert.NoError(t, err)
+	assert.Equal(t, []chunkCall{
+		{start: 15, end: 19, location: "/v2/ns/app/blobs/uploads/u3", data: "fghij"},
+		{start: 20, end: 29, location: "/v2/ns/app/blobs/uploads/u4", data: "KLMNOPQRST"},
+	}, client.calls)
+	assert.True(t, gock.IsDone())
+
+	// the completed upload isn't tracked any more
+	_, ok := a.uploads.get("ns/app@sha256:blob")
+	assert.False(t, ok)
+}
+
+func TestAdapter_PushBlobChunkSessionExpired(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	a := getMockAdapter(t, WithSettings(map[string]string{SettingResumableUploadTTLMinutes: "60"}))
+	client := &chunkClient{reply: func(call chunkCall) (string, int64, error) {
+		return "/v2/ns/app/blobs/uploads/u2", call.end, nil
+	}}
+	a.Adapter.Client = client
+	a.uploads.record("ns/app@sha256:blob", "/v2/ns/app/blobs/uploads/u1", 5)
+
+	// the session expired on SWR, the upload starts over
+	mockGetJwtToken("ns/app")
+	mockRequest().Get("/v2/ns/app/blobs/uploads/u1").
+		Reply(404)
+	_, _, err := a.PushBlobChunk("ns/app", "sha256:blob", 20, strings.NewReader("0123456789"), 0, 9, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []chunkCall{{start: 0, end: 9, data: "0123456789"}}, client.calls)
+	assert.True(t, gock.IsDone())
+
+	// the sessions expired locally aren't resumed
+	a.uploads.ttl = time.Nanosecond
+	a.uploads.record("ns/app@sha256:other", "/v2/ns/app/blobs/uploads/u3", 5)
+	time.Sleep(time.Millisecond)
+	_, ok := a.uploads.get("ns/app@sha256:other")
+	assert.False(t, ok)
+}
@@ -0,0 +1,171 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goharbor/harbor/src/lib/log"
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+// Severity is the highest severity of the vulnerabilities found by the scan of an artifact
+type Severity int
+
+// the severities in the ascending order
+const (
+	// SeverityUnknown means the artifact isn't scanned, the scan isn't finished or SWR has no scan data
+	SeverityUnknown Severity = iota
+	// SeverityNone means the scan found no vulnerability
+	SeverityNone
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+// severityNames are the names of the severities reported by SWR and accepted by ParseSeverity
+var severityNames = map[Severity]string{
+	SeverityUnknown:  "unknown",
+	SeverityNone:     "none",
+	SeverityLow:      "low",
+	SeverityMedium:   "medium",
+	SeverityHigh:     "high",
+	SeverityCritical: "critical",
+}
+
+// String ...
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return severityNames[SeverityUnknown]
+}
+
+// ParseSeverity parses the severity name case-insensitively, e.g. "High", "negligible" is taken as
+// SeverityNone, false is returned if the name isn't recognized
+func ParseSeverity(name string) (Severity, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "negligible" {
+		return SeverityNone, true
+	}
+	for s, n := range severityNames {
+		if n == name {
+			return s, true
+		}
+	}
+	return SeverityUnknown, false
+}
+
+// scanStatusFinished is the status of the finished scans, the severities of the others are unknown
+const scanStatusFinished = "finished"
+
+// ScanStatus is the status of the vulnerability scan of an artifact in Huawei SWR
+type ScanStatus struct {
+	// Status is the status reported by SWR, e.g. "finished" or "running", empty if SWR has no scan data
+	Status   string
+	Severity Severity
+	// Scanned is the time the scan finishes, zero if SWR doesn't report it
+	Scanned time.Time
+}
+
+// hwScanResult is the scan result of the management API of Huawei SWR
+type hwScanResult struct {
+	Status    string    `json:"status"`
+	Severity  string    `json:"severity"`
+	ScannedAt time.Time `json:"scanned_at"`
+}
+
+// GetScanStatus gets the status of the vulnerability scan of the tag of the repository, e.g. "namespace/repository",
+// the severity is SeverityUnknown if the artifact isn't scanned, the scan isn't finished or SWR has no scan API
+func (a *adapter) GetScanStatus(repository, tag string) (*ScanStatus, error) {
+	namespace, repo, found := strings.Cut(repository, "/")
+	if !found {
+		return nil, fmt.Errorf("invalid repository %s, the namespace is missing", repository)
+	}
+	urls := a.apiURL("namespaces", pathSegment(namespace), "repositories", pathSegment(encodeRepository(repo)),
+		"tags", pathSegment(tag), "scan")
+	r, err := http.NewRequest(http.MethodGet, urls, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Add("content-type", "application/json; charset=utf-8")
+
+	start := time.Now()
+	resp, err := a.client.Do(r)
+	logResponse(a.logger("GetScanStatus", log.Fields{"repository": repository, "tag": tag}), r, resp, err, start)
+	if err != nil {
+		return nil, classifyTransportError(err)
+	}
+	defer resp.Body.Close()
+	code := resp.StatusCode
+	if code == http.StatusNotFound || code == http.StatusMethodNotAllowed || code == http.StatusNotImplemented {
+		return &ScanStatus{Severity: SeverityUnknown}, nil
+	}
+	if code >= 300 || code < 200 {
+		return nil, classifyStatusError(a.newError(resp))
+	}
+	result := &hwScanResult{}
+	if err = a.decodeBody(resp, result); err != nil {
+		return nil, err
+	}
+	status := &ScanStatus{Status: result.Status, Severity: SeverityUnknown, Scanned: result.ScannedAt}
+	if strings.EqualFold(result.Status, scanStatusFinished) {
+		if severity, ok := ParseSeverity(result.Severity); ok {
+			status.Severity = severity
+		}
+	}
+	return status, nil
+}
+
+// filterVulnerableArtifacts drops the artifacts whose scan found the vulnerabilities at or above the severity
+// threshold set by WithVulnerabilityThreshold, the artifacts of the unknown severity are kept or dropped as
+// configured. The tags of an artifact are checked one by one as SWR scans the images by tag
+func (a *adapter) filterVulnerableArtifacts(repository string, artifacts []*model.Artifact) ([]*model.Artifact, error) {
+	if a.opts.severityThreshold == SeverityUnknown {
+		return artifacts, nil
+	}
+	var result []*model.Artifact
+	for _, artifact := range artifacts {
+		var tags []string
+		for _, tag := range artifact.Tags {
+			status, err := a.GetScanStatus(repository, tag)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get the scan status of %s:%s: %w", repository, tag, err)
+			}
+			if a.severityAllowed(status.Severity) {
+				tags = append(tags, tag)
+				continue
+			}
+			log.Debugf("skip %s:%s as its scan severity %s isn't allowed", repository, tag, status.Severity)
+		}
+		if len(tags) > 0 {
+			artifact.Tags = tags
+			result = append(result, artifact)
+		}
+	}
+	return result, nil
+}
+
+// severityAllowed reports whether the artifact of the severity is replicated, see WithVulnerabilityThreshold
+func (a *adapter) severityAllowed(severity Severity) bool {
+	if severity == SeverityUnknown {
+		return !a.opts.excludeUnscanned
+	}
+	return severity < a.opts.severityThreshold
+}
@@ -0,0 +1,124 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func mockScanStatus(repository, tag string, status int, body string) {
+	mockRequest().Get("/dockyard/v2/namespaces/ns1/repositories/" + repository + "/tags/" + tag + "/scan").
+		Reply(status).
+		BodyString(body)
+}
+
+func TestParseSeverity(t *testing.T) {
+	for name, expected := range map[string]Severity{
+		"critical":   SeverityCritical,
+		"High":       SeverityHigh,
+		" medium ":   SeverityMedium,
+		"low":        SeverityLow,
+		"negligible": SeverityNone,
+		"none":       SeverityNone,
+		"unknown":    SeverityUnknown,
+	} {
+		severity, ok := ParseSeverity(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, expected, severity, name)
+	}
+	_, ok := ParseSeverity("severe")
+	assert.False(t, ok)
+	assert.Equal(t, "high", SeverityHigh.String())
+	assert.Equal(t, "unknown", Severity(42).String())
+}
+
+func TestAdapter_GetScanStatus(t *testing.T) {
+	defer gock.Off()
+	mockScanStatus("app", "v1", 200, `{"status":"finished","severity":"High","scanned_at":"2024-05-01T10:00:00Z"}`)
+	mockScanStatus("app", "v2", 200, `{"status":"running","severity":"critical"}`)
+	mockScanStatus("app", "v3", 404, `{"errors":"no scan result"}`)
+	mockScanStatus("app", "v4", 500, "internal error")
+
+	a := getHwMockAdapter(t)
+	status, err := a.GetScanStatus("ns1/app", "v1")
+	require.NoError(t, err)
+	assert.Equal(t, SeverityHigh, status.Severity)
+	assert.Equal(t, "finished", status.Status)
+	assert.False(t, status.Scanned.IsZero())
+
+	// the severity of the unfinished scan isn't final
+	status, err = a.GetScanStatus("ns1/app", "v2")
+	require.NoError(t, err)
+	assert.Equal(t, SeverityUnknown, status.Severity)
+
+	status, err = a.GetScanStatus("ns1/app", "v3")
+	require.NoError(t, err)
+	assert.Equal(t, SeverityUnknown, status.Severity)
+
+	_, err = a.GetScanStatus("ns1/app", "v4")
+	assert.ErrorIs(t, err, ErrServer)
+	_, err = a.GetScanStatus("app", "v1")
+	assert.Error(t, err)
+}
+
+func TestAdapter_FetchArtifactsWithVulnerabilityThreshold(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		settings map[string]string
+		expected []string
+	}{
+		{name: "include unscanned", settings: map[string]string{SettingVulnerabilityThreshold: "critical"}, expected: []string{"v1", "v3"}},
+		{name: "exclude unscanned", settings: map[string]string{SettingVulnerabilityThreshold: "high", SettingExcludeUnscanned: "true"}, expected: []string{"v1"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer gock.Off()
+			mockRequest().Get("/dockyard/v2/visible/namespaces").
+				Reply(200).
+				JSON(hwNamespaceList{Namespace: []hwNamespace{{Name: "ns1"}}})
+			mockListRepositories("ns1", 0, []hwRepoQueryResult{{Name: "app", NamespaceName: "ns1"}})
+			mockListTags("ns1", "app", 0, []hwTag{{Tag: "v1"}, {Tag: "v2"}, {Tag: "v3"}})
+			mockScanStatus("app", "v1", 200, `{"status":"finished","severity":"medium"}`)
+			mockScanStatus("app", "v2", 200, `{"status":"finished","severity":"critical"}`)
+			mockScanStatus("app", "v3", 404, "")
+
+			a := getMockAdapter(t, WithSettings(c.settings))
+			resources, err := a.FetchArtifacts(nil)
+			require.NoError(t, err)
+			require.Len(t, resources, 1)
+			assert.Equal(t, c.expected, resources[0].Metadata.Vtags)
+			assert.True(t, gock.IsDone())
+		})
+	}
+}
+
+func TestWithVulnerabilityThreshold(t *testing.T) {
+	o := newOptions(WithVulnerabilityThreshold(SeverityHigh, true))
+	assert.Equal(t, SeverityHigh, o.severityThreshold)
+	assert.True(t, o.excludeUnscanned)
+	assert.True(t, (&adapter{opts: o}).severityAllowed(SeverityMedium))
+	assert.False(t, (&adapter{opts: o}).severityAllowed(SeverityHigh))
+	assert.False(t, (&adapter{opts: o}).severityAllowed(SeverityUnknown))
+
+	// the threshold below low disables the filter
+	o = newOptions(WithVulnerabilityThreshold(SeverityHigh, true), WithVulnerabilityThreshold(SeverityNone, true))
+	assert.Equal(t, SeverityUnknown, o.severityThreshold)
+	assert.False(t, o.excludeUnscanned)
+	o = newOptions(WithSettings(map[string]string{SettingVulnerabilityThreshold: "severe"}))
+	assert.Equal(t, SeverityUnknown, o.severityThreshold)
+}
@@ -0,0 +1,182 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// const definition
+const (
+	signAlgorithm      = "SDK-HMAC-SHA256"
+	signDateHeader     = "X-Sdk-Date"
+	signDateFormat     = "20060102T150405Z"
+	signHostHeader     = "host"
+	signContentTypeKey = "content-type"
+)
+
+// signer signs the requests with the AK/SK as the API gateway of Huawei Cloud expects,
+// which is the native authentication of the management API of SWR
+type signer struct {
+	ak  string
+	sk  string
+	now func() time.Time
+}
+
+func newSigner(ak, sk string) *signer {
+	return &signer{
+		ak:  ak,
+		sk:  sk,
+		now: time.Now,
+	}
+}
+
+// Modify signs the request, the "X-Sdk-Date" and "Authorization" headers are set
+func (s *signer) Modify(req *http.Request) error {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(signDateHeader, s.now().UTC().Format(signDateFormat))
+
+	signedHeaders := s.signedHeaders(req)
+	canonicalRequest := s.canonicalRequest(req, signedHeaders, body)
+	stringToSign := fmt.Sprintf("%s\n%s\n%s", signAlgorithm, req.Header.Get(signDateHeader), hashHex([]byte(canonicalRequest)))
+	mac := hmac.New(sha256.New, []byte(s.sk))
+	mac.Write([]byte(stringToSign))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Access=%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, s.ak, strings.Join(signedHeaders, ";"), signature))
+	return nil
+}
+
+// signedHeaders returns the lower case names of the signed headers in order, only the headers
+// which aren't changed after signing are signed, the others may be added by the transport
+func (s *signer) signedHeaders(req *http.Request) []string {
+	headers := []string{signHostHeader, strings.ToLower(signDateHeader)}
+	if len(req.Header.Get(signContentTypeKey)) > 0 {
+		headers = append(headers, signContentTypeKey)
+	}
+	sort.Strings(headers)
+	return headers
+}
+
+// canonicalRequest builds the canonical request:
+// method \n canonical URI \n canonical query string \n canonical headers \n signed headers \n hex(sha256(body))
+func (s *signer) canonicalRequest(req *http.Request, signedHeaders []string, body []byte) string {
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		value := req.Header.Get(name)
+		if name == signHostHeader {
+			value = req.Host
+			if len(value) == 0 {
+				value = req.URL.Host
+			}
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	return strings.Join([]string{
+		req.Method,
+		canonicalURI(req),
+		canonicalQueryString(req),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		hashHex(body),
+	}, "\n")
+}
+
+// canonicalURI escapes each segment of the path, the path always ends with "/"
+func canonicalURI(req *http.Request) string {
+	segments := strings.Split(req.URL.Path, "/")
+	for i, segment := range segments {
+		segments[i] = signEscape(segment)
+	}
+	uri := strings.Join(segments, "/")
+	if !strings.HasSuffix(uri, "/") {
+		uri += "/"
+	}
+	return uri
+}
+
+// canonicalQueryString sorts the query parameters by the names and then the values
+func canonicalQueryString(req *http.Request) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, signEscape(key)+"="+signEscape(value))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// signEscape percent-encodes all the bytes except the unreserved characters of RFC 3986
+func signEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// readRequestBody reads the body of the request for hashing and restores it
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,93 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func newTestSigner() *signer {
+	s := newSigner("QTWAOYTTINDUT2QVKYUC", "MFyfvK41ba2giqM7Uio6PznpdUKGpownRZlmVmHc")
+	s.now = func() time.Time {
+		return time.Date(2019, 11, 15, 3, 36, 55, 0, time.UTC)
+	}
+	return s
+}
+
+func TestSigner_Modify(t *testing.T) {
+	cases := []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		body        string
+		expected    string
+	}{
+		{
+			name:     "get",
+			method:   http.MethodGet,
+			url:      "https://swr.cn-north-4.myhuaweicloud.com/dockyard/v2/visible/namespaces",
+			expected: "SDK-HMAC-SHA256 Access=QTWAOYTTINDUT2QVKYUC, SignedHeaders=host;x-sdk-date, Signature=fac5c76113c07355b8cf733f6890000eb8dbd9c05e810c2d66f89127384ac4e3",
+		},
+		{
+			name:        "post with query and body",
+			method:      http.MethodPost,
+			url:         "https://swr.cn-north-4.myhuaweicloud.com/dockyard/v2/namespaces?b=2&a=x%20y",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"namespace":"ns"}`,
+			expected:    "SDK-HMAC-SHA256 Access=QTWAOYTTINDUT2QVKYUC, SignedHeaders=content-type;host;x-sdk-date, Signature=bd093d76066e773ae9efc9e5b3d3d0d482c1c3fd687131c0262274d54e36f8b6",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, err := http.NewRequest(c.method, c.url, strings.NewReader(c.body))
+			require.NoError(t, err)
+			if len(c.contentType) > 0 {
+				req.Header.Set("Content-Type", c.contentType)
+			}
+			require.NoError(t, newTestSigner().Modify(req))
+			assert.Equal(t, "20191115T033655Z", req.Header.Get("X-Sdk-Date"))
+			assert.Equal(t, c.expected, req.Header.Get("Authorization"))
+		})
+	}
+}
+
+func TestCanonicalURI(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://swr.cn-north-4.myhuaweicloud.com/dockyard/v2/namespaces/ns/repositories/a$b/tags", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "/dockyard/v2/namespaces/ns/repositories/a%24b/tags/", canonicalURI(req))
+}
+
+func TestAdapter_WithAKSK(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		MatchHeader("Authorization", "^SDK-HMAC-SHA256 Access=QTWAOYTTINDUT2QVKYUC, SignedHeaders=content-type;host;x-sdk-date, Signature=[0-9a-f]{64}$").
+		MatchHeader("X-Sdk-Date", ".+").
+		Reply(200).BodyString(`{"namespaces":[]}`)
+
+	a := getMockAdapter(t, WithAKSK("QTWAOYTTINDUT2QVKYUC", "MFyfvK41ba2giqM7Uio6PznpdUKGpownRZlmVmHc"))
+	_, err := a.ListNamespaces(nil)
+	assert.NoError(t, err)
+	assert.True(t, gock.IsDone())
+}
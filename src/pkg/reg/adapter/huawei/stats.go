@@ -0,0 +1,188 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/goharbor/harbor/src/lib/log"
+	adp "github.com/goharbor/harbor/src/pkg/reg/adapter"
+)
+
+// PushStats counts how the blobs and manifests are handled by the adapter as the destination of
+// the replications, the skipped blobs already exist on Huawei SWR. The manifests existing with the
+// same digest are skipped by the transfer according to ManifestExist and aren't pushed at all
+type PushStats struct {
+	BlobsPushed     int64
+	BlobsSkipped    int64
+	ManifestsPushed int64
+}
+
+// pushStats is the concurrency safe counterpart of PushStats
+type pushStats struct {
+	blobsPushed     atomic.Int64
+	blobsSkipped    atomic.Int64
+	manifestsPushed atomic.Int64
+}
+
+// String summarizes the statistics for the logs
+func (s PushStats) String() string {
+	return fmt.Sprintf("%d blobs pushed, %d blobs skipped as they exist, %d manifests pushed",
+		s.BlobsPushed, s.BlobsSkipped, s.ManifestsPushed)
+}
+
+// PushStats returns the statistics of the pushes since the adapter is created, so the operators
+// can see how much content is skipped because its digest already exists on Huawei SWR. The cached
+// adapter is shared by the jobs, see jobAdapter for the statistics of a job
+func (a *adapter) PushStats() PushStats {
+	return PushStats{
+		BlobsPushed:     a.stats.blobsPushed.Load(),
+		BlobsSkipped:    a.stats.blobsSkipped.Load(),
+		ManifestsPushed: a.stats.manifestsPushed.Load(),
+	}
+}
+
+// BlobExist checks the existence of the blob by its digest, the existing blobs
+// are skipped by the transfer so they're counted as skipped
+func (a *adapter) BlobExist(repository, digest string) (bool, error) {
+	repository = a.destinationRepository(repository)
+	release := a.limiter.acquire()
+	exist, err := a.Adapter.BlobExist(repository, digest)
+	release(err)
+	if err == nil && exist {
+		a.stats.blobsSkipped.Add(1)
+		log.Debugf("the blob %s already exists in %s, skip", digest, repository)
+	}
+	return exist, err
+}
+
+// PushBlob pushes the blob to Huawei SWR, the upload waits for a slot of the repository before the
+// one of the adaptive concurrency, so the uploads queued for a busy repository don't hold the latter
+func (a *adapter) PushBlob(repository, digest string, size int64, blob io.Reader) error {
+	repository = a.destinationRepository(repository)
+	releaseUpload := a.blobUploads.acquire(repository)
+	release := a.limiter.acquire()
+	blob, closeBlob := a.readAhead(blob)
+	err := a.Adapter.PushBlob(repository, digest, size, blob)
+	closeBlob()
+	release(err)
+	releaseUpload()
+	if err != nil {
+		return err
+	}
+	a.stats.blobsPushed.Add(1)
+	return nil
+}
+
+// PushBlobChunk pushes the chunk of the blob to Huawei SWR, the blob is counted once its last chunk is pushed.
+// Each chunk takes a slot of the repository like PushBlob
+func (a *adapter) PushBlobChunk(repository, digest string, size int64, chunk io.Reader, start, end int64, location string) (string, int64, error) {
+	repository = a.destinationRepository(repository)
+	releaseUpload := a.blobUploads.acquire(repository)
+	release := a.limiter.acquire()
+	chunk, closeChunk := a.readAhead(chunk)
+	nextLocation, endRange, err := a.pushBlobChunk(repository, digest, size, chunk, start, end, location)
+	closeChunk()
+	release(err)
+	releaseUpload()
+	if err == nil && end == size-1 {
+		a.stats.blobsPushed.Add(1)
+	}
+	return nextLocation, endRange, err
+}
+
+// PushManifest pushes the manifest to Huawei SWR, ErrImmutableTag is returned if the tag is protected
+// by the immutability rules of the namespace
+func (a *adapter) PushManifest(repository, reference, mediaType string, payload []byte) (string, error) {
+	repository = a.destinationRepository(repository)
+	release := a.limiter.acquire()
+	dgt, err := a.Adapter.PushManifest(repository, reference, mediaType, payload)
+	release(err)
+	if err != nil {
+		return dgt, classifyPushError(repository, reference, err)
+	}
+	a.stats.manifestsPushed.Add(1)
+	a.reportProgress(ProgressEvent{Type: ProgressManifestPushed, Repository: repository, Reference: reference})
+	return dgt, nil
+}
+
+// jobAdapter is the adapter handed out by the factory for each use, e.g. a replication job, it shares
+// the cached adapter while counting the pushes of the job alone, so the statistics logged once the job
+// ends don't accumulate across the jobs, see adp.PushStatsReporter
+type jobAdapter struct {
+	*adapter
+	stats *pushStats
+}
+
+// newJobAdapter wraps the single region adapter for a job, the multiple region adapter reports no
+// statistics so it's returned as is
+func newJobAdapter(a adp.Adapter) adp.Adapter {
+	if single, ok := a.(*adapter); ok {
+		return &jobAdapter{adapter: single, stats: &pushStats{}}
+	}
+	return a
+}
+
+// PushStats returns the statistics of the pushes of the job
+func (j *jobAdapter) PushStats() PushStats {
+	return PushStats{
+		BlobsPushed:     j.stats.blobsPushed.Load(),
+		BlobsSkipped:    j.stats.blobsSkipped.Load(),
+		ManifestsPushed: j.stats.manifestsPushed.Load(),
+	}
+}
+
+// PushStatsSummary summarizes the statistics of the pushes of the job
+func (j *jobAdapter) PushStatsSummary() string {
+	return j.PushStats().String()
+}
+
+// BlobExist ...
+func (j *jobAdapter) BlobExist(repository, digest string) (bool, error) {
+	exist, err := j.adapter.BlobExist(repository, digest)
+	if err == nil && exist {
+		j.stats.blobsSkipped.Add(1)
+	}
+	return exist, err
+}
+
+// PushBlob ...
+func (j *jobAdapter) PushBlob(repository, digest string, size int64, blob io.Reader) error {
+	err := j.adapter.PushBlob(repository, digest, size, blob)
+	if err == nil {
+		j.stats.blobsPushed.Add(1)
+	}
+	return err
+}
+
+// PushBlobChunk ...
+func (j *jobAdapter) PushBlobChunk(repository, digest string, size int64, chunk io.Reader, start, end int64, location string) (string, int64, error) {
+	nextLocation, endRange, err := j.adapter.PushBlobChunk(repository, digest, size, chunk, start, end, location)
+	if err == nil && end == size-1 {
+		j.stats.blobsPushed.Add(1)
+	}
+	return nextLocation, endRange, err
+}
+
+// PushManifest ...
+func (j *jobAdapter) PushManifest(repository, reference, mediaType string, payload []byte) (string, error) {
+	dgt, err := j.adapter.PushManifest(repository, reference, mediaType, payload)
+	if err == nil {
+		j.stats.manifestsPushed.Add(1)
+	}
+	return dgt, err
+}
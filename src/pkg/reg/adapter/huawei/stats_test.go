@@ -0,0 +1,103 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	liberrors "github.com/goharbor/harbor/src/lib/errors"
+	"github.com/goharbor/harbor/src/testing/pkg/registry"
+)
+
+func TestAdapter_PushStats(t *testing.T) {
+	a := getMockAdapter(t)
+	client := &registry.Client{}
+	a.Adapter.Client = client
+
+	client.On("BlobExist", "ns/app", "sha256:existing").Return(true, nil)
+	client.On("BlobExist", "ns/app", "sha256:new").Return(false, nil)
+	client.On("PushBlob", "ns/app", "sha256:new", int64(3), mock.Anything).Return(nil)
+	client.On("PushBlobChunk", "ns/app", "sha256:chunked", int64(10), mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return("location", int64(0), nil)
+	client.On("PushManifest", "ns/app", "v1", "application/vnd.oci.image.manifest.v1+json", mock.Anything).
+		Return("sha256:manifest", nil)
+
+	exist, err := a.BlobExist("ns/app", "sha256:existing")
+	assert.NoError(t, err)
+	assert.True(t, exist)
+	exist, err = a.BlobExist("ns/app", "sha256:new")
+	assert.NoError(t, err)
+	assert.False(t, exist)
+	assert.NoError(t, a.PushBlob("ns/app", "sha256:new", 3, bytes.NewReader([]byte("abc"))))
+	// only the last chunk completes the blob
+	_, _, err = a.PushBlobChunk("ns/app", "sha256:chunked", 10, bytes.NewReader(nil), 0, 4, "")
+	assert.NoError(t, err)
+	_, _, err = a.PushBlobChunk("ns/app", "sha256:chunked", 10, bytes.NewReader(nil), 5, 9, "location")
+	assert.NoError(t, err)
+	_, err = a.PushManifest("ns/app", "v1", "application/vnd.oci.image.manifest.v1+json", []byte("{}"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, PushStats{BlobsPushed: 2, BlobsSkipped: 1, ManifestsPushed: 1}, a.PushStats())
+}
+
+func TestJobAdapter_PushStats(t *testing.T) {
+	a := getMockAdapter(t)
+	client := &registry.Client{}
+	a.Adapter.Client = client
+	client.On("BlobExist", "ns/app", "sha256:existing").Return(true, nil)
+	client.On("PushBlob", "ns/app", "sha256:new", int64(3), mock.Anything).Return(nil)
+	client.On("PushManifest", "ns/app", "v1", "application/vnd.oci.image.manifest.v1+json", mock.Anything).
+		Return("sha256:manifest", nil)
+
+	// the jobs sharing the cached adapter count their own pushes
+	job1 := newJobAdapter(a).(*jobAdapter)
+	job2 := newJobAdapter(a).(*jobAdapter)
+	_, err := job1.BlobExist("ns/app", "sha256:existing")
+	assert.NoError(t, err)
+	assert.NoError(t, job1.PushBlob("ns/app", "sha256:new", 3, bytes.NewReader([]byte("abc"))))
+	_, err = job2.PushManifest("ns/app", "v1", "application/vnd.oci.image.manifest.v1+json", []byte("{}"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, PushStats{BlobsPushed: 1, BlobsSkipped: 1}, job1.PushStats())
+	assert.Equal(t, PushStats{ManifestsPushed: 1}, job2.PushStats())
+	assert.Equal(t, "0 blobs pushed, 0 blobs skipped as they exist, 1 manifests pushed", job2.PushStatsSummary())
+	assert.Equal(t, PushStats{BlobsPushed: 1, BlobsSkipped: 1, ManifestsPushed: 1}, a.PushStats())
+}
+
+func TestAdapter_PushManifestImmutable(t *testing.T) {
+	a := getMockAdapter(t)
+	client := &registry.Client{}
+	a.Adapter.Client = client
+
+	rejected := liberrors.New(nil).WithCode(liberrors.ConflictCode).
+		WithMessage(`http status code: 409, body: {"errors":[{"code":"DENIED","message":"The tag v1 is immutable"}]}`)
+	client.On("PushManifest", "ns/app", "v1", mock.Anything, mock.Anything).Return("", rejected)
+	client.On("PushManifest", "ns/app", "v2", mock.Anything, mock.Anything).Return("", liberrors.New("http status code: 500"))
+
+	_, err := a.PushManifest("ns/app", "v1", "application/vnd.oci.image.manifest.v1+json", []byte("{}"))
+	assert.True(t, errors.Is(err, ErrImmutableTag))
+	assert.True(t, liberrors.IsConflictErr(err))
+	assert.Contains(t, err.Error(), "ns/app:v1")
+	assert.False(t, isTransient(err))
+
+	_, err = a.PushManifest("ns/app", "v2", "application/vnd.oci.image.manifest.v1+json", []byte("{}"))
+	assert.False(t, errors.Is(err, ErrImmutableTag))
+	assert.Equal(t, PushStats{}, a.PushStats())
+}
@@ -0,0 +1,95 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	common_http "github.com/goharbor/harbor/src/common/http"
+	"github.com/goharbor/harbor/src/common/http/modifier"
+)
+
+// cancelBody cancels the context of the request once the body of the response is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close ...
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// doWithTimeout sends the request to the management API bounded by the timeout of the operation, i.e.
+// the listing, the get or the push timeout the caller passes, instead of the timeout of the client,
+// which may be either shorter or longer than it. The request is sent by the client as is if the
+// operation has no timeout, see WithOperationTimeouts
+func (a *adapter) doWithTimeout(r *http.Request, timeout time.Duration) (*http.Response, error) {
+	if timeout <= 0 || a.untimedClient == nil {
+		return a.client.Do(r)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	resp, err := a.untimedClient.Do(r.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// newUntimedClient builds the client of the management API with no timeout of its own, the requests
+// sent by it are bounded by their contexts instead, nil is returned if no operation has a timeout
+func newUntimedClient(transport http.RoundTripper, o *options, modifiers ...modifier.Modifier) *common_http.Client {
+	if o.listTimeout <= 0 && o.getTimeout <= 0 && o.pushTimeout <= 0 {
+		return nil
+	}
+	return common_http.NewClient(&http.Client{Transport: transport}, modifiers...)
+}
+
+// pushTimeoutTransport bounds the requests of the blob and manifest pushes sent by the native registry
+// client by the push timeout. The client takes no context, so the timeout is applied per request here
+// rather than by doWithTimeout, the pulls and the existence checks aren't bounded by it
+type pushTimeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// RoundTrip sends the request bounded by the push timeout unless it's a GET or HEAD request
+func (t *pushTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return t.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport
+func (t *pushTimeoutTransport) CloseIdleConnections() {
+	if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+func newSlowAdapter(t *testing.T, delay time.Duration, opts ...Option) *adapter {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/repositories") {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"namespaces":[{"name":"ns"}],"name":"ns"}`))
+	}))
+	t.Cleanup(server.Close)
+	adp, err := newAdapter(&model.Registry{
+		URL:        server.URL,
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+	}, opts...)
+	require.NoError(t, err)
+	return adp.(*adapter)
+}
+
+func TestAdapter_OperationTimeouts(t *testing.T) {
+	// the operations with no timeout of their own keep the client timeout
+	a := newSlowAdapter(t, 50*time.Millisecond, WithTimeout(10*time.Millisecond))
+	assert.Nil(t, a.untimedClient)
+	_, err := a.ListNamespaces(nil)
+	assert.Error(t, err)
+
+	// the listings fail fast while the slow namespace creations are tolerated
+	a = newSlowAdapter(t, 50*time.Millisecond, WithTimeout(10*time.Millisecond),
+		WithOperationTimeouts(0, time.Second, time.Second))
+	_, err = a.ListNamespaces(nil)
+	assert.Error(t, err)
+	ns, err := a.GetNamespace("ns")
+	require.NoError(t, err)
+	assert.Equal(t, "ns", ns.Name)
+	assert.NoError(t, a.CreateNamespace("ns", NamespaceAuthPrivate))
+
+	a = newSlowAdapter(t, 50*time.Millisecond, WithOperationTimeouts(10*time.Millisecond, 0, 0))
+	_, err = a.ListNamespaces(nil)
+	assert.Error(t, err)
+	_, err = a.GetNamespace("ns")
+	assert.NoError(t, err)
+}
+
+func TestAdapter_ListTimeoutRepositories(t *testing.T) {
+	// the repository listings are bounded by the listing timeout rather than the client timeout
+	a := newSlowAdapter(t, 50*time.Millisecond, WithTimeout(10*time.Millisecond), WithOperationTimeouts(time.Second, 0, 0))
+	_, err := a.listRepositories(context.Background(), "ns")
+	assert.NoError(t, err)
+
+	a = newSlowAdapter(t, 50*time.Millisecond, WithOperationTimeouts(10*time.Millisecond, 0, 0))
+	_, err = a.listRepositories(context.Background(), "ns")
+	assert.Error(t, err)
+}
+
+func TestAdapter_PushTimeout(t *testing.T) {
+	m := newMockRegistry(t, func(s *httptest.Server) {
+		next := s.Config.Handler
+		s.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut {
+				time.Sleep(50 * time.Millisecond)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	dgt := "sha256:" + strings.Repeat("b", 64)
+	push := func(a *adapter) error {
+		if err := a.PushBlob("ns/app", dgt, 4, strings.NewReader("blob")); err != nil {
+			return err
+		}
+		_, err := a.PushManifest("ns/app", "v1", "application/vnd.oci.image.manifest.v1+json", []byte(`{}`))
+		return err
+	}
+	assert.NoError(t, push(m.adapter(t, WithOperationTimeouts(0, 0, time.Second))))
+
+	a := m.adapter(t, WithOperationTimeouts(0, 0, 10*time.Millisecond))
+	err := a.PushBlob("ns/app", dgt, 4, strings.NewReader("blob"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = a.PushManifest("ns/app", "v1", "application/vnd.oci.image.manifest.v1+json", []byte(`{}`))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	// the pulls aren't bounded by the push timeout
+	_, _, err = a.PullManifest("ns/app", "v1")
+	assert.NoError(t, err)
+}
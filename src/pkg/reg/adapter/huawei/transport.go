@@ -0,0 +1,120 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	common_http "github.com/goharbor/harbor/src/common/http"
+	"github.com/goharbor/harbor/src/common/http/modifier"
+	"github.com/goharbor/harbor/src/lib/log"
+	"github.com/goharbor/harbor/src/lib/trace"
+)
+
+// newTransport builds a dedicated transport for Huawei SWR rather than using the global one,
+// as all the requests of the adapter go to the same host, the idle connections are tuned
+// to be reused by the sustained replications. HTTP/2 is attempted as the concurrent requests
+// are multiplexed over a few connections then, unless it's disabled by WithForceHTTP1
+func newTransport(insecure bool, o *options) (http.RoundTripper, error) {
+	opts := []func(*http.Transport){
+		common_http.WithInsecureSkipVerify(insecure),
+		common_http.WithMaxIdleConns(o.maxIdleConns),
+		common_http.WithIdleconnectionTimeout(o.idleConnTimeout),
+		func(tr *http.Transport) {
+			tr.MaxIdleConnsPerHost = o.maxIdleConnsPerHost
+			tr.DialContext = (&net.Dialer{
+				Timeout:   o.connectTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext
+		},
+	}
+	if o.forceHTTP1 {
+		// a non-nil empty map disables HTTP/2 of the transport
+		opts = append(opts, func(tr *http.Transport) {
+			tr.ForceAttemptHTTP2 = false
+			tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		})
+	} else {
+		opts = append(opts, func(tr *http.Transport) {
+			tr.ForceAttemptHTTP2 = true
+		})
+	}
+	if !insecure && common_http.InternalTLSEnabled() {
+		tlsConfig, err := common_http.GetInternalTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append([]func(*http.Transport){func(tr *http.Transport) {
+			tr.TLSClientConfig = tlsConfig
+		}}, opts...)
+	}
+	// applied after the TLS config is replaced by the internal one
+	opts = append(opts, func(tr *http.Transport) {
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.MinVersion = o.tlsMinVersion
+		if len(o.tlsServerName) > 0 {
+			tr.TLSClientConfig.ServerName = o.tlsServerName
+		}
+	})
+
+	transport := common_http.NewTransport(opts...)
+	if trace.Enabled() {
+		transport = otelhttp.NewTransport(transport, trace.HarborHTTPTraceOptions...)
+	}
+	return transport, nil
+}
+
+// nativeTransport applies the modifiers to the requests sent by the native registry client, i.e.
+// the blobs, the manifests and the tokens, which don't go through the clients of the adapter, and
+// logs the responses like the requests of the management API, see logResponse
+type nativeTransport struct {
+	next      http.RoundTripper
+	modifiers []modifier.Modifier
+	// logger returns the logger of the responses, they aren't logged if it's nil
+	logger func() *log.Logger
+}
+
+// RoundTrip applies the modifiers to a copy of the request, as a transport mustn't change the request
+func (t *nativeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for _, m := range t.modifiers {
+		if err := m.Modify(req); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if t.logger != nil {
+		logResponse(t.logger(), req, resp, err, start)
+	}
+	return resp, err
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport
+func (t *nativeTransport) CloseIdleConnections() {
+	if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
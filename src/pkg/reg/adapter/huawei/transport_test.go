@@ -0,0 +1,369 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goharbor/harbor/src/pkg/reg/model"
+)
+
+func TestNewTransport(t *testing.T) {
+	transport, err := newTransport(true, newOptions())
+	require.NoError(t, err)
+	tr, ok := transport.(*http.Transport)
+	require.True(t, ok)
+	assert.True(t, tr.TLSClientConfig.InsecureSkipVerify)
+	assert.Equal(t, defaultMaxIdleConns, tr.MaxIdleConns)
+	assert.Equal(t, defaultMaxIdleConnsPerHost, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, defaultIdleConnTimeout, tr.IdleConnTimeout)
+
+	transport, err = newTransport(false, newOptions(WithIdleConns(10, 5), WithIdleConnTimeout(time.Minute)))
+	require.NoError(t, err)
+	tr = transport.(*http.Transport)
+	assert.False(t, tr.TLSClientConfig.InsecureSkipVerify)
+	assert.Equal(t, 10, tr.MaxIdleConns)
+	assert.Equal(t, 5, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, tr.IdleConnTimeout)
+}
+
+func TestNewTransportHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	// the servers not supporting HTTP/2 fall back to HTTP/1.1
+	server11 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	defer server11.Close()
+
+	proto := func(url string, opts ...Option) string {
+		transport, err := newTransport(true, newOptions(opts...))
+		require.NoError(t, err)
+		client := &http.Client{Transport: transport}
+		resp, err := client.Get(url)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	assert.Equal(t, "HTTP/2.0", proto(server.URL))
+	assert.Equal(t, "HTTP/1.1", proto(server.URL, WithForceHTTP1(true)))
+	assert.Equal(t, "HTTP/1.1", proto(server11.URL))
+}
+
+func TestAdapter_HTTP2(t *testing.T) {
+	push := func(opts ...Option) string {
+		m := newMockRegistry(t)
+		require.NoError(t, m.adapter(t, opts...).PushBlob("ns/app", "sha256:"+strings.Repeat("b", 64), 4, strings.NewReader("blob")))
+		pushes := m.received(http.MethodPut, "/blobs/uploads/")
+		require.Len(t, pushes, 1)
+		return pushes[0].Proto
+	}
+	assert.Equal(t, "HTTP/2.0", push())
+	assert.Equal(t, "HTTP/1.1", push(WithForceHTTP1(true)))
+}
+
+func TestNewTransportConnectTimeout(t *testing.T) {
+	// the slow response isn't limited by the connect timeout
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	transport, err := newTransport(false, newOptions(WithConnectTimeout(50*time.Millisecond)))
+	require.NoError(t, err)
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the non-routable address is given up after the connect timeout rather than the request timeout
+	start := time.Now()
+	_, err = client.Get("http://10.255.255.1:81")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	assert.Equal(t, defaultConnectTimeout, newOptions(WithConnectTimeout(0)).connectTimeout)
+	assert.Equal(t, 5*time.Second, newOptions(WithSettings(map[string]string{
+		SettingConnectTimeoutSeconds: "5",
+	})).connectTimeout)
+}
+
+func TestAdapter_ConnectTimeout(t *testing.T) {
+	a, err := newAdapter(&model.Registry{
+		Type:       model.RegistryTypeHuawei,
+		URL:        "https://10.255.255.1:81",
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+	}, WithConnectTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+
+	// the blob push is given up after the connect timeout rather than the timeout of the registry client
+	start := time.Now()
+	err = a.(*adapter).PushBlob("ns/app", "sha256:"+strings.Repeat("b", 64), 4, strings.NewReader("blob"))
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestNewTransportTLSMinVersion(t *testing.T) {
+	transport, err := newTransport(true, newOptions())
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), transport.(*http.Transport).TLSClientConfig.MinVersion)
+
+	// the versions below TLS 1.2 aren't allowed
+	assert.Equal(t, uint16(tls.VersionTLS12), newOptions(WithTLSMinVersion(tls.VersionTLS11)).tlsMinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS13), newOptions(WithSettings(map[string]string{
+		SettingTLSMinVersion: "1.3",
+	})).tlsMinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS12), newOptions(WithSettings(map[string]string{
+		SettingTLSMinVersion: "1.0",
+	})).tlsMinVersion)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(opts ...Option) error {
+		transport, err := newTransport(true, newOptions(opts...))
+		require.NoError(t, err)
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err != nil {
+			return classifyTransportError(err)
+		}
+		return resp.Body.Close()
+	}
+	assert.NoError(t, get())
+	err = get(WithTLSMinVersion(tls.VersionTLS13))
+	assert.True(t, errors.Is(err, ErrTLS))
+	assert.Contains(t, err.Error(), "minimum")
+}
+
+func TestAdapter_TLSMinVersion(t *testing.T) {
+	m := newMockRegistry(t, func(s *httptest.Server) {
+		s.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	})
+	dgt := "sha256:" + strings.Repeat("b", 64)
+
+	a := m.adapter(t)
+	assert.NoError(t, a.PushBlob("ns/app", dgt, 4, strings.NewReader("blob")))
+	_, _, err := a.PullManifest("ns/app", "v1")
+	assert.NoError(t, err)
+
+	// the blobs and the manifests are refused by the native client as well as the API
+	a = m.adapter(t, WithTLSMinVersion(tls.VersionTLS13))
+	err = a.PushBlob("ns/app", dgt, 4, strings.NewReader("blob"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "protocol version")
+	_, _, err = a.PullManifest("ns/app", "v1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "protocol version")
+}
+
+func TestNewTransportTLSServerName(t *testing.T) {
+	// the certificate of the test server is issued for "example.com"
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	get := func(opts ...Option) error {
+		transport, err := newTransport(false, newOptions(opts...))
+		require.NoError(t, err)
+		tr := transport.(*http.Transport)
+		tr.TLSClientConfig.RootCAs = pool
+		resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+		if err != nil {
+			return classifyTransportError(err)
+		}
+		return resp.Body.Close()
+	}
+	assert.NoError(t, get(WithTLSServerName("example.com")))
+	// the certificate is still verified against the overridden name
+	assert.True(t, errors.Is(get(WithTLSServerName("swr.example.org")), ErrTLS))
+
+	assert.Equal(t, "example.com", newOptions(WithSettings(map[string]string{
+		SettingTLSServerName: "example.com",
+	})).tlsServerName)
+}
+
+func TestAdapter_TLSServerName(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		names []string
+	)
+	m := newMockRegistry(t, func(s *httptest.Server) {
+		s.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			names = append(names, hello.ServerName)
+			return nil, nil
+		}}
+	})
+
+	a := m.adapter(t, WithTLSServerName("swr.example.org"))
+	require.NoError(t, a.PushBlob("ns/app", "sha256:"+strings.Repeat("b", 64), 4, strings.NewReader("blob")))
+	_, err := a.PushManifest("ns/app", "v1", "application/vnd.oci.image.manifest.v1+json", []byte(`{}`))
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, names)
+	for _, name := range names {
+		assert.Equal(t, "swr.example.org", name)
+	}
+}
+
+func TestNewAdapterInsecureOverride(t *testing.T) {
+	registry := &model.Registry{
+		Type:       model.RegistryTypeHuawei,
+		URL:        "https://swr.cn-north-1.myhuaweicloud.com",
+		Credential: &model.Credential{AccessKey: "ak", AccessSecret: "sk"},
+	}
+	insecure := func(c *http.Client) bool {
+		return c.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify
+	}
+
+	adp, err := newAdapter(registry)
+	require.NoError(t, err)
+	a := adp.(*adapter)
+	assert.False(t, insecure(a.client.GetClient()))
+	assert.False(t, insecure(a.authClient.GetClient()))
+
+	adp, err = newAdapter(registry, WithAuthInsecure(true))
+	require.NoError(t, err)
+	a = adp.(*adapter)
+	assert.False(t, insecure(a.client.GetClient()))
+	assert.False(t, insecure(a.oriClient))
+	assert.True(t, insecure(a.authClient.GetClient()))
+
+	registry.Insecure = true
+	adp, err = newAdapter(registry, WithAPIInsecure(false))
+	require.NoError(t, err)
+	a = adp.(*adapter)
+	assert.False(t, insecure(a.client.GetClient()))
+	assert.True(t, insecure(a.authClient.GetClient()))
+}
+
+// BenchmarkConnectionReuse reports the number of the TCP connections opened for
+// the concurrent requests, compare the result of the net/http default per host
+// idle connections with the tuned one
+func BenchmarkConnectionReuse(b *testing.B) {
+	for name, opts := range map[string][]Option{
+		"default": {WithIdleConns(defaultMaxIdleConns, http.DefaultMaxIdleConnsPerHost)},
+		"tuned":   {},
+	} {
+		b.Run(name, func(b *testing.B) {
+			var conns int64
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(`{"namespaces":[]}`))
+			}))
+			server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt64(&conns, 1)
+				}
+			}
+			server.Start()
+			defer server.Close()
+
+			transport, err := newTransport(false, newOptions(opts...))
+			require.NoError(b, err)
+			client := &http.Client{Transport: transport}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				for j := 0; j < 16; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						resp, err := client.Get(server.URL)
+						if err != nil {
+							return
+						}
+						_, _ = io.Copy(io.Discard, resp.Body)
+						resp.Body.Close()
+					}()
+				}
+				wg.Wait()
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&conns))/float64(b.N), "conns/op")
+		})
+	}
+}
+
+// BenchmarkHTTP2ConnectionUsage reports the total number of the TCP connections opened for the
+// concurrent manifest pulls of the adapter from a HTTP/2 capable registry, compare HTTP/2 with the
+// forced HTTP/1.1. A warm-up pull is sent first, so HTTP/2 is negotiated and the token is fetched
+// before the concurrent requests are multiplexed
+func BenchmarkHTTP2ConnectionUsage(b *testing.B) {
+	for name, opts := range map[string][]Option{
+		"http1": {WithForceHTTP1(true)},
+		"http2": {},
+	} {
+		b.Run(name, func(b *testing.B) {
+			var conns int64
+			m := newMockRegistry(b, func(s *httptest.Server) {
+				s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+					if state == http.StateNew {
+						atomic.AddInt64(&conns, 1)
+					}
+				}
+			})
+			a := m.adapter(b, opts...)
+			_, _, err := a.PullManifest("ns/app", "v1")
+			require.NoError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				for j := 0; j < 16; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						_, _, _ = a.PullManifest("ns/app", "v1")
+					}()
+				}
+				wg.Wait()
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&conns)), "conns")
+		})
+	}
+}
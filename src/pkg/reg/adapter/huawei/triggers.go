@@ -0,0 +1,173 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goharbor/harbor/src/lib/log"
+)
+
+// triggerAppTypeWebhook is the type of the triggers notifying an endpoint of the pushes
+const triggerAppTypeWebhook = "webhook"
+
+// the conditions of the pushes a trigger fires on
+const (
+	// TriggerConditionAll fires the trigger on the pushes of all the tags
+	TriggerConditionAll = "all"
+	// TriggerConditionTag fires the trigger on the pushes of the tag set as the condition value
+	TriggerConditionTag = "tag"
+	// TriggerConditionRegular fires the trigger on the pushes of the tags matching the regular expression set as the condition value
+	TriggerConditionRegular = "regular"
+)
+
+// Trigger is a webhook trigger of a repository in Huawei SWR, which notifies the address of the pushes
+// to the repository, e.g. to replicate them back to Harbor
+type Trigger struct {
+	Name string
+	// Address is the URL of the webhook notified of the pushes
+	Address string
+	// Condition is one of the TriggerCondition constants, TriggerConditionAll if it's empty
+	Condition      string
+	ConditionValue string
+	Enabled        bool
+	// Created is the time the trigger is created, zero if SWR doesn't report it
+	Created time.Time
+}
+
+// hwTrigger is the trigger of the management API of Huawei SWR, the booleans are sent as strings
+type hwTrigger struct {
+	Name           string     `json:"name"`
+	Enable         string     `json:"enable"`
+	AppType        string     `json:"app_type"`
+	Address        string     `json:"address"`
+	ConditionType  string     `json:"condition_type"`
+	ConditionValue string     `json:"condition_value"`
+	Created        *time.Time `json:"created_at,omitempty"`
+}
+
+// CreateTrigger registers the webhook trigger on the repository, e.g. "namespace/repository", so SWR
+// notifies the address of the pushes to it. ErrUnsupported is returned if the SWR deployment has no trigger API
+func (a *adapter) CreateTrigger(repository string, trigger Trigger) error {
+	if len(trigger.Name) == 0 || len(trigger.Address) == 0 {
+		return fmt.Errorf("the name and the address of the trigger are required")
+	}
+	condition := trigger.Condition
+	if len(condition) == 0 {
+		condition = TriggerConditionAll
+	}
+	body, err := json.Marshal(hwTrigger{
+		Name:           trigger.Name,
+		Enable:         fmt.Sprint(trigger.Enabled),
+		AppType:        triggerAppTypeWebhook,
+		Address:        trigger.Address,
+		ConditionType:  condition,
+		ConditionValue: trigger.ConditionValue,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := a.sendTriggerRequest("CreateTrigger", http.MethodPost, repository, "", body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ListTriggers lists the webhook triggers of the repository, e.g. "namespace/repository", the triggers of
+// the other types, e.g. the deployments to CCE, are skipped. ErrUnsupported is returned if the SWR deployment
+// has no trigger API
+func (a *adapter) ListTriggers(repository string) ([]Trigger, error) {
+	resp, err := a.sendTriggerRequest("ListTriggers", http.MethodGet, repository, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	hwTriggers := []hwTrigger{}
+	if err = a.decodeBody(resp, &hwTriggers); err != nil {
+		return nil, err
+	}
+	triggers := make([]Trigger, 0, len(hwTriggers))
+	for _, t := range hwTriggers {
+		if t.AppType != triggerAppTypeWebhook {
+			continue
+		}
+		triggers = append(triggers, Trigger{
+			Name:           t.Name,
+			Address:        t.Address,
+			Condition:      t.ConditionType,
+			ConditionValue: t.ConditionValue,
+			Enabled:        t.Enable == "true",
+		})
+		if t.Created != nil {
+			triggers[len(triggers)-1].Created = *t.Created
+		}
+	}
+	return triggers, nil
+}
+
+// DeleteTrigger deletes the trigger of the repository, e.g. "namespace/repository", ErrNotFound is returned
+// if it doesn't exist and ErrUnsupported if the SWR deployment has no trigger API
+func (a *adapter) DeleteTrigger(repository, name string) error {
+	resp, err := a.sendTriggerRequest("DeleteTrigger", http.MethodDelete, repository, name, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// sendTriggerRequest sends the request to the triggers of the repository, or to the trigger if the name is
+// set, and returns the response of the 2xx status code. The deployments without the trigger API respond
+// with 405, 501 or the 404 of the gateway, whose body isn't a JSON object unlike the 404 of a missing repository
+func (a *adapter) sendTriggerRequest(operation, method, repository, name string, body []byte) (*http.Response, error) {
+	namespace, repo, found := strings.Cut(repository, "/")
+	if !found {
+		return nil, fmt.Errorf("invalid repository %s, the namespace is missing", repository)
+	}
+	elem := []string{"namespaces", pathSegment(namespace), "repositories", pathSegment(encodeRepository(repo)), "triggers"}
+	if len(name) > 0 {
+		elem = append(elem, pathSegment(name))
+	}
+	r, err := http.NewRequest(method, a.apiURL(elem...), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Add("content-type", "application/json; charset=utf-8")
+
+	start := time.Now()
+	resp, err := a.client.Do(r)
+	logResponse(a.logger(operation, log.Fields{"repository": repository, "trigger": name}), r, resp, err, start)
+	if err != nil {
+		return nil, classifyTransportError(err)
+	}
+	code := resp.StatusCode
+	if code >= 200 && code < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	e := a.newError(resp)
+	if code == http.StatusMethodNotAllowed || code == http.StatusNotImplemented ||
+		(code == http.StatusNotFound && !strings.HasPrefix(strings.TrimSpace(e.Body), "{")) {
+		return nil, fmt.Errorf("%w: the triggers of repository %s: %w", ErrUnsupported, repository, e)
+	}
+	return nil, classifyStatusError(e)
+}
@@ -0,0 +1,72 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+const triggersPath = "/dockyard/v2/namespaces/ns1/repositories/team\\$app/triggers"
+
+func TestAdapter_TriggerLifecycle(t *testing.T) {
+	defer gock.Off()
+	mockRequest().Post(triggersPath).
+		BodyString(`{"name":"harbor","enable":"true","app_type":"webhook","address":"https://harbor.example.com/hook","condition_type":"all","condition_value":""}`).
+		Reply(201)
+	mockRequest().Get(triggersPath).
+		Reply(200).
+		JSON([]map[string]string{
+			{"name": "harbor", "enable": "true", "app_type": "webhook", "address": "https://harbor.example.com/hook", "condition_type": "all"},
+			{"name": "deploy", "enable": "true", "app_type": "deployments", "condition_type": "tag", "condition_value": "v1"},
+		})
+	mockRequest().Delete(triggersPath + "/harbor").Reply(200)
+
+	a := getHwMockAdapter(t)
+	require.NoError(t, a.CreateTrigger("ns1/team/app", Trigger{Name: "harbor", Address: "https://harbor.example.com/hook", Enabled: true}))
+	triggers, err := a.ListTriggers("ns1/team/app")
+	require.NoError(t, err)
+	assert.Equal(t, []Trigger{{Name: "harbor", Address: "https://harbor.example.com/hook", Condition: TriggerConditionAll, Enabled: true}}, triggers)
+	assert.NoError(t, a.DeleteTrigger("ns1/team/app", "harbor"))
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_TriggerErrors(t *testing.T) {
+	defer gock.Off()
+	a := getHwMockAdapter(t)
+	assert.Error(t, a.CreateTrigger("ns1/team/app", Trigger{Name: "harbor"}))
+	_, err := a.ListTriggers("app")
+	assert.Error(t, err)
+
+	// the trigger doesn't exist
+	mockRequest().Delete(triggersPath + "/missing").
+		Reply(404).
+		BodyString(`{"errorCode":"SVCSTG.SWR.4040001","errorMessage":"trigger not found"}`)
+	err = a.DeleteTrigger("ns1/team/app", "missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrUnsupported))
+
+	// the deployment has no trigger API
+	mockRequest().Get(triggersPath).Reply(404).BodyString("<html>404 Not Found</html>")
+	_, err = a.ListTriggers("ns1/team/app")
+	assert.True(t, errors.Is(err, ErrUnsupported))
+	mockRequest().Post(triggersPath).Reply(405)
+	err = a.CreateTrigger("ns1/team/app", Trigger{Name: "harbor", Address: "https://harbor.example.com/hook"})
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
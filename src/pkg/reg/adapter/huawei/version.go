@@ -0,0 +1,104 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// versionProbe keeps the conclusive result of probing the management API, so the probe runs once per adapter
+type versionProbe struct {
+	sync.Mutex
+	done       bool
+	compatible bool
+}
+
+// probeAPIVersion checks whether the management API under the base path is the one the adapter speaks,
+// the namespace listing is requested and its response must be a JSON object containing the "namespaces".
+// The result is cached once it's conclusive, the transport and server errors are inconclusive and the
+// probe runs again next time.
+func (a *adapter) probeAPIVersion() (bool, error) {
+	a.version.Lock()
+	defer a.version.Unlock()
+	if a.version.done {
+		return a.version.compatible, nil
+	}
+
+	r, err := http.NewRequest(http.MethodGet, a.apiURL("visible", "namespaces"), nil)
+	if err != nil {
+		return false, err
+	}
+	r.Header.Add("content-type", "application/json; charset=utf-8")
+	resp, err := a.client.Do(r)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	compatible := false
+	switch code := resp.StatusCode; {
+	case code == http.StatusNotFound || code == http.StatusMethodNotAllowed:
+	case code >= 200 && code < 300:
+		body, err := a.readBody(resp)
+		if err != nil {
+			return false, err
+		}
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(body, &fields) == nil {
+			_, compatible = fields["namespaces"]
+		}
+	default:
+		return false, a.newError(resp)
+	}
+	a.version.done = true
+	a.version.compatible = compatible
+	return compatible, nil
+}
+
+// checkAPIVersion is called when a request to the management API fails in the way an incompatible API
+// would cause, e.g. 404 or the unexpected response body, ErrUnsupportedAPIVersion is wrapped along with
+// the original error if the probe confirms the API isn't compatible, otherwise the error is returned as is
+func (a *adapter) checkAPIVersion(err error) error {
+	if err == nil || errors.Is(err, ErrUnsupportedAPIVersion) {
+		return err
+	}
+	compatible, probeErr := a.probeAPIVersion()
+	if probeErr != nil || compatible {
+		return err
+	}
+	return fmt.Errorf("%w: the API under %s isn't compatible: %w", ErrUnsupportedAPIVersion, a.apiBaseURL, err)
+}
+
+// isAPIMismatch reports whether the error may be caused by an incompatible management API,
+// which are 404 and the errors decoding the response body
+func isAPIMismatch(err error) bool {
+	var (
+		e         *Error
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &e):
+		return e.StatusCode == http.StatusNotFound
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return true
+	default:
+		return false
+	}
+}
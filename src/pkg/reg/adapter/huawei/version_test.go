@@ -0,0 +1,82 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package huawei
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestAdapter_UnsupportedAPIVersion(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// the listing and the probe both get 404, the probe runs only once
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Times(3).Reply(404).BodyString("not found")
+
+	a := getMockAdapter(t)
+	for i := 0; i < 2; i++ {
+		_, err := a.ListNamespaces(nil)
+		assert.ErrorIs(t, err, ErrUnsupportedAPIVersion)
+		var e *Error
+		assert.ErrorAs(t, err, &e)
+	}
+	assert.True(t, gock.IsDone())
+}
+
+func TestAdapter_UnsupportedAPIVersionResponse(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// the namespaces are returned in a different shape
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Times(2).Reply(200).BodyString(`{"items":[{"name":"ns1"}]}`)
+	mockRequest().Get("/dockyard/v2/repositories").
+		Reply(200).BodyString(`{"items":[]}`)
+
+	a := getMockAdapter(t)
+	var repos []hwRepoQueryResult
+	err := a.getJSON(context.Background(), a.apiBaseURL+"/repositories", &repos)
+	assert.ErrorIs(t, err, ErrUnsupportedAPIVersion)
+	var typeErr *json.UnmarshalTypeError
+	assert.ErrorAs(t, err, &typeErr)
+
+	// cached
+	compatible, err := a.probeAPIVersion()
+	assert.NoError(t, err)
+	assert.False(t, compatible)
+}
+
+func TestAdapter_CompatibleAPIVersion(t *testing.T) {
+	defer gock.Off()
+	gock.Observe(gock.DumpRequest)
+
+	// the tags of a missing repository, the API is fine
+	mockRequest().Get("/dockyard/v2/namespaces/ns/repositories/missing/tags").
+		Reply(404).BodyString("repository not found")
+	mockRequest().Get("/dockyard/v2/visible/namespaces").
+		Reply(200).BodyString(`{"namespaces":[]}`)
+
+	a := getMockAdapter(t)
+	_, err := a.listTags(context.Background(), "ns", "missing")
+	assert.NotErrorIs(t, err, ErrUnsupportedAPIVersion)
+	assert.EqualError(t, err, "[404][repository not found]")
+	assert.True(t, gock.IsDone())
+}
@@ -16,6 +16,7 @@ package native
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/goharbor/harbor/src/common/utils"
 	"github.com/goharbor/harbor/src/lib"
@@ -84,6 +85,15 @@ func NewAdapterWithAuthorizer(reg *model.Registry, authorizer lib.Authorizer) *A
 	}
 }
 
+// NewAdapterWithTransport returns an instance of the Adapter with provided authorizer, the requests
+// are sent through the provided transport rather than the global one
+func NewAdapterWithTransport(reg *model.Registry, authorizer lib.Authorizer, transport http.RoundTripper) *Adapter {
+	return &Adapter{
+		registry: reg,
+		Client:   registry.NewClientWithTransport(reg.URL, authorizer, transport),
+	}
+}
+
 // Info returns the basic information about the adapter
 func (a *Adapter) Info() (info *model.RegistryInfo, err error) {
 	return &model.RegistryInfo{
@@ -16,6 +16,7 @@ package reg
 
 import (
 	"context"
+	"encoding/json"
 
 	commonthttp "github.com/goharbor/harbor/src/common/http"
 	"github.com/goharbor/harbor/src/common/utils"
@@ -229,6 +230,12 @@ func fromDaoModel(registry *dao.Registry) (*model.Registry, error) {
 		UpdateTime:   registry.UpdateTime,
 	}
 
+	if len(registry.Settings) != 0 {
+		if err := json.Unmarshal([]byte(registry.Settings), &r.Settings); err != nil {
+			return nil, err
+		}
+	}
+
 	if len(registry.AccessKey) != 0 {
 		credentialType := registry.CredentialType
 		if len(credentialType) == 0 {
@@ -263,6 +270,14 @@ func toDaoModel(registry *model.Registry) (*dao.Registry, error) {
 		UpdateTime:   registry.UpdateTime,
 	}
 
+	if len(registry.Settings) != 0 {
+		settings, err := json.Marshal(registry.Settings)
+		if err != nil {
+			return nil, err
+		}
+		m.Settings = string(settings)
+	}
+
 	if registry.Credential != nil && len(registry.Credential.AccessKey) != 0 {
 		credentialType := registry.Credential.Type
 		if len(credentialType) == 0 {
@@ -90,6 +90,24 @@ func (m *managerTestSuite) TestUpdate() {
 	m.dao.AssertExpectations(m.T())
 }
 
+func (m *managerTestSuite) TestSettings() {
+	r, err := toDaoModel(&model.Registry{Settings: map[string]string{"timeout_seconds": "10"}})
+	m.Require().Nil(err)
+	m.Equal(`{"timeout_seconds":"10"}`, r.Settings)
+
+	registry, err := fromDaoModel(r)
+	m.Require().Nil(err)
+	m.Equal(map[string]string{"timeout_seconds": "10"}, registry.Settings)
+
+	// the registries without settings
+	r, err = toDaoModel(&model.Registry{})
+	m.Require().Nil(err)
+	m.Empty(r.Settings)
+	registry, err = fromDaoModel(r)
+	m.Require().Nil(err)
+	m.Nil(registry.Settings)
+}
+
 func TestManager(t *testing.T) {
 	suite.Run(t, &managerTestSuite{})
 }
@@ -37,7 +37,31 @@ func (n *Namespace) GetStringMetadata(key string, defaultValue string) string {
 	return defaultValue
 }
 
+// const definition
+const (
+	// NamespaceMatchStyleSubstring matches the namespaces whose name contains the query name
+	NamespaceMatchStyleSubstring = "substring"
+	// NamespaceMatchStyleGlob matches the namespaces whose name matches the query name as a glob pattern
+	NamespaceMatchStyleGlob = "glob"
+)
+
 // NamespaceQuery defines the query condition for listing namespaces
 type NamespaceQuery struct {
 	Name string
+	// MatchStyle decides how the Name is matched, NamespaceMatchStyleSubstring is used if it's empty
+	MatchStyle string
+	// Creator and Domain filter the namespaces by the exact name of the creator and the owning
+	// domain (account) respectively if not empty, they are ignored by the adapters which don't
+	// know the owners of the namespaces
+	Creator string
+	Domain  string
+	// MinImageCount and MaxImageCount filter the namespaces by the number of the images in them if
+	// not nil, both bounds are inclusive, e.g. MaxImageCount of 0 selects the empty namespaces. They
+	// are ignored by the adapters which don't know the image counts of the namespaces
+	MinImageCount *int64
+	MaxImageCount *int64
+	// Page (starting from 1) and PageSize select a slice of the matched namespaces,
+	// all the matched namespaces are returned if PageSize isn't positive
+	Page     int64
+	PageSize int64
 }
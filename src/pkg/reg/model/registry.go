@@ -101,8 +101,11 @@ type Registry struct {
 	Credential      *Credential `json:"credential"`
 	Insecure        bool        `json:"insecure"`
 	Status          string      `json:"status"`
-	CreationTime    time.Time   `json:"creation_time"`
-	UpdateTime      time.Time   `json:"update_time"`
+	// Settings are the adapter specific settings of the registry, e.g. the timeouts,
+	// the adapters ignore the keys they don't know
+	Settings     map[string]string `json:"settings,omitempty"`
+	CreationTime time.Time         `json:"creation_time"`
+	UpdateTime   time.Time         `json:"update_time"`
 }
 
 // FilterStyle ...
@@ -141,6 +144,10 @@ type RegistryInfo struct {
 	SupportedTriggers                    []string       `json:"supported_triggers"`
 	SupportedRepositoryPathComponentType string         `json:"supported_repository_path_component_type"` // how many path components are allowed in the repository name
 	SupportedCopyByChunk                 bool           `json:"supported_copy_by_chunk,omitempty"`
+	// SafeConcurrency and AdvisoryRateLimit advise the scheduler how many concurrent jobs and how many
+	// requests per second the registry can take safely, zero means no advice
+	SafeConcurrency   int     `json:"safe_concurrency,omitempty"`
+	AdvisoryRateLimit float64 `json:"advisory_rate_limit,omitempty"`
 }
 
 // AdapterPattern provides base info and capability declarations of the registry
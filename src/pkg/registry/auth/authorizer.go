@@ -33,11 +33,17 @@ import (
 
 // NewAuthorizer creates an authorizer that can handle different auth schemes
 func NewAuthorizer(username, password string, insecure bool) lib.Authorizer {
+	return NewAuthorizerWithTransport(username, password, commonhttp.GetHTTPTransport(commonhttp.WithInsecure(insecure)))
+}
+
+// NewAuthorizerWithTransport creates an authorizer that can handle different auth schemes, the
+// auth scheme is determined and the tokens are fetched through the provided transport
+func NewAuthorizerWithTransport(username, password string, transport http.RoundTripper) lib.Authorizer {
 	return &authorizer{
 		username: username,
 		password: password,
 		client: &http.Client{
-			Transport: commonhttp.GetHTTPTransport(commonhttp.WithInsecure(insecure)),
+			Transport: transport,
 		},
 	}
 }
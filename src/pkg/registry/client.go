@@ -137,12 +137,18 @@ func NewClient(url, username, password string, insecure bool, interceptors ...in
 
 // NewClientWithAuthorizer creates a registry client with the provided authorizer
 func NewClientWithAuthorizer(url string, authorizer lib.Authorizer, insecure bool, interceptors ...interceptor.Interceptor) Client {
+	return NewClientWithTransport(url, authorizer, commonhttp.GetHTTPTransport(commonhttp.WithInsecure(insecure)), interceptors...)
+}
+
+// NewClientWithTransport creates a registry client with the provided authorizer which sends the requests
+// through the provided transport rather than the global one
+func NewClientWithTransport(url string, authorizer lib.Authorizer, transport http.RoundTripper, interceptors ...interceptor.Interceptor) Client {
 	return &client{
 		url:          url,
 		authorizer:   authorizer,
 		interceptors: interceptors,
 		client: &http.Client{
-			Transport: commonhttp.GetHTTPTransport(commonhttp.WithInsecure(insecure)),
+			Transport: transport,
 			Timeout:   registryHTTPClientTimeout,
 		},
 	}
@@ -52,6 +52,7 @@ func (r *registryAPI) CreateRegistry(ctx context.Context, params operation.Creat
 		Type:        params.Registry.Type,
 		URL:         params.Registry.URL,
 		Insecure:    params.Registry.Insecure,
+		Settings:    params.Registry.Settings,
 	}
 	if params.Registry.Credential != nil {
 		registry.Credential = &model.Credential{
@@ -143,6 +144,9 @@ func (r *registryAPI) UpdateRegistry(ctx context.Context, params operation.Updat
 		if params.Registry.Insecure != nil {
 			registry.Insecure = *params.Registry.Insecure
 		}
+		if params.Registry.Settings != nil {
+			registry.Settings = params.Registry.Settings
+		}
 		if registry.Credential == nil {
 			registry.Credential = &model.Credential{}
 		}
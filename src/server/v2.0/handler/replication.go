@@ -483,6 +483,7 @@ func convertRegistry(registry *model.Registry) *models.Registry {
 		ID:           registry.ID,
 		Insecure:     registry.Insecure,
 		Name:         registry.Name,
+		Settings:     registry.Settings,
 		Status:       registry.Status,
 		Type:         string(registry.Type),
 		UpdateTime:   strfmt.DateTime(registry.UpdateTime),